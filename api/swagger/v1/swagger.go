@@ -0,0 +1,11 @@
+// Package swagger embeds the OpenAPI spec generated from api/proto/v1/redeam-rest.proto.
+package swagger
+
+import (
+	_ "embed"
+)
+
+// Spec is the OpenAPI v2 document of the REST gateway, regenerated by protoc-gen-swagger
+//
+//go:embed redeam-rest.swagger.json
+var Spec []byte
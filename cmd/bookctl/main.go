@@ -0,0 +1,22 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/radean0909/redeam-rest/pkg/bookctl"
+)
+
+func main() {
+	err := bookctl.Run(context.Background(), os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
+	switch err {
+	case nil, flag.ErrHelp:
+	case bookctl.ErrUsage:
+		os.Exit(2)
+	default:
+		fmt.Fprintf(os.Stderr, "bookctl: %v\n", err)
+		os.Exit(1)
+	}
+}
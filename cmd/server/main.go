@@ -13,6 +13,6 @@ func main() {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
 		os.Exit(1)
 	} else {
-		log.Println("Starting Redeam Server")
+		log.Println("Redeam Server stopped")
 	}
 }
@@ -1,9 +1,138 @@
-CREATE TABLE Book (
+-- Applying this file again upgrades a database created by an older one, every statement is
+-- idempotent. Bump SchemaVersion along with v1.SchemaVersion when changing the schema.
+
+CREATE TABLE IF NOT EXISTS Book (
   ID serial PRIMARY KEY,
   Title varchar(200) DEFAULT NULL,
   Author varchar(200) DEFAULT NULL,
   Publisher varchar(200) DEFAULT NULL,
   PublishDate timestamp NULL DEFAULT NULL,
   Rating float DEFAULT NULL,
-  Status int
-);
\ No newline at end of file
+  Status int,
+  Isbn varchar(20) NOT NULL DEFAULT '',
+  -- set by the server, By holds the subject of the caller
+  CreatedAt timestamptz NOT NULL DEFAULT now(),
+  UpdatedAt timestamptz NOT NULL DEFAULT now(),
+  CreatedBy varchar(200) NOT NULL DEFAULT '',
+  UpdatedBy varchar(200) NOT NULL DEFAULT ''
+);
+
+-- columns added after the first release
+ALTER TABLE Book ADD COLUMN IF NOT EXISTS Isbn varchar(20) NOT NULL DEFAULT '';
+ALTER TABLE Book ADD COLUMN IF NOT EXISTS CreatedAt timestamptz NOT NULL DEFAULT now();
+ALTER TABLE Book ADD COLUMN IF NOT EXISTS UpdatedAt timestamptz NOT NULL DEFAULT now();
+ALTER TABLE Book ADD COLUMN IF NOT EXISTS CreatedBy varchar(200) NOT NULL DEFAULT '';
+ALTER TABLE Book ADD COLUMN IF NOT EXISTS UpdatedBy varchar(200) NOT NULL DEFAULT '';
+
+-- delta syncs read the books updated since their last one
+CREATE INDEX IF NOT EXISTS Book_UpdatedAt ON Book (UpdatedAt);
+
+-- Append-only log of Book changes, Seq lets watchers resume where they left off
+CREATE TABLE IF NOT EXISTS BookChange (
+  Seq bigserial PRIMARY KEY,
+  ChangeType int NOT NULL,
+  BookId int NOT NULL,
+  Title varchar(200) DEFAULT NULL,
+  Author varchar(200) DEFAULT NULL,
+  Publisher varchar(200) DEFAULT NULL,
+  PublishDate timestamp NULL DEFAULT NULL,
+  Rating float DEFAULT NULL,
+  Status int,
+  Isbn varchar(20) NOT NULL DEFAULT '',
+  CreatedAt timestamptz NOT NULL DEFAULT now(),
+  UpdatedAt timestamptz NOT NULL DEFAULT now(),
+  CreatedBy varchar(200) NOT NULL DEFAULT '',
+  UpdatedBy varchar(200) NOT NULL DEFAULT '',
+  -- when the change was logged, taken under the lock of lock_book_changes() so it grows with Seq
+  ChangedAt timestamptz NOT NULL DEFAULT clock_timestamp()
+);
+
+ALTER TABLE BookChange ADD COLUMN IF NOT EXISTS Isbn varchar(20) NOT NULL DEFAULT '';
+ALTER TABLE BookChange ADD COLUMN IF NOT EXISTS CreatedAt timestamptz NOT NULL DEFAULT now();
+ALTER TABLE BookChange ADD COLUMN IF NOT EXISTS UpdatedAt timestamptz NOT NULL DEFAULT now();
+ALTER TABLE BookChange ADD COLUMN IF NOT EXISTS CreatedBy varchar(200) NOT NULL DEFAULT '';
+ALTER TABLE BookChange ADD COLUMN IF NOT EXISTS UpdatedBy varchar(200) NOT NULL DEFAULT '';
+-- local times of the database before schema version 4
+ALTER TABLE BookChange ALTER COLUMN ChangedAt TYPE timestamptz;
+ALTER TABLE BookChange ALTER COLUMN ChangedAt SET DEFAULT clock_timestamp();
+
+-- changes are pruned by age, see v1.PruneChanges
+CREATE INDEX IF NOT EXISTS BookChange_ChangedAt ON BookChange (ChangedAt);
+
+-- Statement level, so a batch or an import logs its rows with one INSERT and notifies once per
+-- transaction: identical notifications of a transaction are delivered once.
+-- ChangeType values match WatchBooksResponse.ChangeType in the proto definition
+CREATE OR REPLACE FUNCTION log_book_changes() RETURNS trigger AS $$
+BEGIN
+  IF TG_OP = 'INSERT' THEN
+    INSERT INTO BookChange (ChangeType, BookId, Title, Author, Publisher, PublishDate, Rating, Status, Isbn, CreatedAt, UpdatedAt, CreatedBy, UpdatedBy)
+      SELECT 1, ID, Title, Author, Publisher, PublishDate, Rating, Status, Isbn, CreatedAt, UpdatedAt, CreatedBy, UpdatedBy FROM new_rows ORDER BY ID;
+  ELSIF TG_OP = 'UPDATE' THEN
+    INSERT INTO BookChange (ChangeType, BookId, Title, Author, Publisher, PublishDate, Rating, Status, Isbn, CreatedAt, UpdatedAt, CreatedBy, UpdatedBy)
+      SELECT 2, ID, Title, Author, Publisher, PublishDate, Rating, Status, Isbn, CreatedAt, UpdatedAt, CreatedBy, UpdatedBy FROM new_rows ORDER BY ID;
+  ELSE
+    INSERT INTO BookChange (ChangeType, BookId, Title, Author, Publisher, PublishDate, Rating, Status, Isbn, CreatedAt, UpdatedAt, CreatedBy, UpdatedBy)
+      SELECT 3, ID, Title, Author, Publisher, PublishDate, Rating, Status, Isbn, CreatedAt, UpdatedAt, CreatedBy, UpdatedBy FROM old_rows ORDER BY ID;
+  END IF;
+  PERFORM pg_notify('book_changes', '');
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Seq is taken when a change is logged, not when its transaction commits. Writers lock the log
+-- before their statement touches Book, until they commit, so changes commit in Seq order and a
+-- watcher past a Seq never misses a change committed later. Readers are not blocked.
+CREATE OR REPLACE FUNCTION lock_book_changes() RETURNS trigger AS $$
+BEGIN
+  LOCK TABLE BookChange IN EXCLUSIVE MODE;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+-- the row level trigger of schema version 1
+DROP TRIGGER IF EXISTS book_change ON Book;
+DROP FUNCTION IF EXISTS log_book_change();
+
+DROP TRIGGER IF EXISTS book_lock ON Book;
+CREATE TRIGGER book_lock BEFORE INSERT OR UPDATE OR DELETE ON Book
+  FOR EACH STATEMENT EXECUTE PROCEDURE lock_book_changes();
+DROP TRIGGER IF EXISTS book_insert ON Book;
+CREATE TRIGGER book_insert AFTER INSERT ON Book
+  REFERENCING NEW TABLE AS new_rows FOR EACH STATEMENT EXECUTE PROCEDURE log_book_changes();
+DROP TRIGGER IF EXISTS book_update ON Book;
+CREATE TRIGGER book_update AFTER UPDATE ON Book
+  REFERENCING NEW TABLE AS new_rows FOR EACH STATEMENT EXECUTE PROCEDURE log_book_changes();
+DROP TRIGGER IF EXISTS book_delete ON Book;
+CREATE TRIGGER book_delete AFTER DELETE ON Book
+  REFERENCING OLD TABLE AS old_rows FOR EACH STATEMENT EXECUTE PROCEDURE log_book_changes();
+
+-- API keys of machine clients, only the SHA-256 hash of the secret is stored
+CREATE TABLE IF NOT EXISTS ApiKey (
+  ID serial PRIMARY KEY,
+  Name varchar(200) NOT NULL,
+  Prefix varchar(16) NOT NULL,
+  Hash char(64) NOT NULL UNIQUE,
+  Scopes text[] NOT NULL DEFAULT '{}',
+  ExpiresAt timestamptz NULL DEFAULT NULL,
+  CreatedAt timestamptz NOT NULL DEFAULT now(),
+  RevokedAt timestamptz NULL DEFAULT NULL
+);
+
+-- Responses of calls made with an Idempotency-Key, Key hashes the key with the method and caller.
+-- Response is NULL while the first call runs.
+CREATE TABLE IF NOT EXISTS IdempotencyKey (
+  Key char(64) PRIMARY KEY,
+  RequestHash char(64) NOT NULL,
+  Response bytea NULL DEFAULT NULL,
+  ExpiresAt timestamptz NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS IdempotencyKey_ExpiresAt ON IdempotencyKey (ExpiresAt);
+
+-- Version of the schema, the server reports not ready while it is older than it expects
+CREATE TABLE IF NOT EXISTS SchemaVersion (
+  Version int NOT NULL
+);
+
+DELETE FROM SchemaVersion;
+INSERT INTO SchemaVersion (Version) VALUES (4);
@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+)
+
+const (
+	// apiKeyPrefix marks secrets issued by this server, making leaked keys easy to scan for
+	apiKeyPrefix = "rdk_"
+	// apiKeyDisplayLength is how much of a secret is kept in clear to tell keys apart
+	apiKeyDisplayLength = len(apiKeyPrefix) + 8
+)
+
+// ErrInvalidAPIKey is returned for unknown, revoked or expired API keys
+var ErrInvalidAPIKey = errors.New("auth: invalid API key")
+
+// KeyVerifier resolves an API key to the identity it was issued for
+type KeyVerifier interface {
+	VerifyKey(ctx context.Context, secret string) (*Claims, error)
+}
+
+// NewAPIKey generates a random API key secret along with its display prefix and the hash to store
+func NewAPIKey() (secret, prefix, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", "", err
+	}
+	secret = apiKeyPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return secret, secret[:apiKeyDisplayLength], HashAPIKey(secret), nil
+}
+
+// HashAPIKey returns the hex SHA-256 of a secret. The secrets are random so a fast hash
+// is enough, and it lets keys be looked up by hash.
+func HashAPIKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
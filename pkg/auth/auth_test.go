@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func writeJWKS(t *testing.T, kid string, key *rsa.PublicKey) string {
+	set := jwks{Keys: []jwk{{
+		Kty: "RSA",
+		Kid: kid,
+		Use: "sig",
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}}}
+	data, _ := json.Marshal(set)
+
+	dir, err := ioutil.TempDir("", "jwks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "jwks.json")
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestVerifier_Verify(t *testing.T) {
+	secret := []byte("sn34kyp4ssw0rD")
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	v, err := NewVerifier(secret, writeJWKS(t, "k1", &rsaKey.PublicKey))
+	if err != nil {
+		t.Fatalf("NewVerifier() error = %v", err)
+	}
+	rsaOnly, _ := NewVerifier(nil, writeJWKS(t, "k1", &rsaKey.PublicKey))
+	scoped, _ := NewVerifier(secret, "", WithIssuer("https://issuer.example.com"), WithAudience("redeam-rest"))
+
+	claims := func(exp time.Duration) *Claims {
+		return &Claims{
+			Roles: []string{"librarian"},
+			RegisteredClaims: jwt.RegisteredClaims{
+				Subject:   "jdoe",
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(exp).Truncate(time.Second)),
+			},
+		}
+	}
+	sign := func(method jwt.SigningMethod, kid string, key interface{}, c *Claims) string {
+		tok := jwt.NewWithClaims(method, c)
+		if kid != "" {
+			tok.Header["kid"] = kid
+		}
+		s, err := tok.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	scopedClaims := func(iss string, aud ...string) *Claims {
+		c := claims(time.Hour)
+		c.Issuer, c.Audience = iss, aud
+		return c
+	}
+
+	valid := claims(time.Hour)
+	scopedValid := scopedClaims("https://issuer.example.com", "other", "redeam-rest")
+	noExp := claims(time.Hour)
+	noExp.ExpiresAt = nil
+	tests := []struct {
+		name    string
+		v       *Verifier
+		token   string
+		want    *Claims
+		wantErr bool
+	}{
+		{"HS256", v, sign(jwt.SigningMethodHS256, "", secret, valid), valid, false},
+		{"RS256", v, sign(jwt.SigningMethodRS256, "k1", rsaKey, valid), valid, false},
+		{"RS256 without key id", v, sign(jwt.SigningMethodRS256, "", rsaKey, valid), valid, false},
+		{"Expired", v, sign(jwt.SigningMethodHS256, "", secret, claims(-time.Hour)), nil, true},
+		{"Without exp", v, sign(jwt.SigningMethodHS256, "", secret, noExp), nil, true},
+		{"Issuer and audience", scoped, sign(jwt.SigningMethodHS256, "", secret, scopedValid), scopedValid, false},
+		{"Wrong issuer", scoped, sign(jwt.SigningMethodHS256, "", secret, scopedClaims("https://evil.example.com", "redeam-rest")), nil, true},
+		{"Wrong audience", scoped, sign(jwt.SigningMethodHS256, "", secret, scopedClaims("https://issuer.example.com", "other")), nil, true},
+		{"Without issuer and audience", scoped, sign(jwt.SigningMethodHS256, "", secret, valid), nil, true},
+		{"Wrong secret", v, sign(jwt.SigningMethodHS256, "", []byte("guess"), valid), nil, true},
+		{"Unknown key", v, sign(jwt.SigningMethodRS256, "k1", otherKey, valid), nil, true},
+		{"Unknown key id", v, sign(jwt.SigningMethodRS256, "k2", rsaKey, valid), nil, true},
+		{"HS256 not configured", rsaOnly, sign(jwt.SigningMethodHS256, "", secret, valid), nil, true},
+		{"Unsupported algorithm", v, sign(jwt.SigningMethodHS512, "", secret, valid), nil, true},
+		{"Garbage", v, "not.a.token", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.v.Verify(tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Verifier.Verify() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Verifier.Verify() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
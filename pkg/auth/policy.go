@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Policy maps roles to the gRPC methods they may call
+type Policy struct {
+	roles map[string][]string
+}
+
+type policyFile struct {
+	Roles map[string][]string `yaml:"roles"`
+}
+
+// LoadPolicy reads a YAML policy file, see configs/policy.yaml
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("auth: reading policy: %v", err)
+	}
+
+	var f policyFile
+	if err := yaml.UnmarshalStrict(data, &f); err != nil {
+		return nil, fmt.Errorf("auth: parsing policy %s: %v", path, err)
+	}
+	return NewPolicy(f.Roles)
+}
+
+// NewPolicy builds a policy from role names to method patterns: a full method name
+// such as "/v1.BookService/Read", "/v1.BookService/*" or "*"
+func NewPolicy(roles map[string][]string) (*Policy, error) {
+	for role, methods := range roles {
+		for _, m := range methods {
+			if m != "*" && (!strings.HasPrefix(m, "/") || strings.Count(m, "/") != 2) {
+				return nil, fmt.Errorf("auth: role %s has invalid method %q", role, m)
+			}
+		}
+	}
+	return &Policy{roles: roles}, nil
+}
+
+// Allowed reports whether any of the roles may call the full gRPC method name
+func (p *Policy) Allowed(roles []string, method string) bool {
+	service := method[:strings.LastIndex(method, "/")+1] + "*"
+	for _, r := range roles {
+		for _, m := range p.roles[r] {
+			if m == "*" || m == method || m == service {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+package auth
+
+import "testing"
+
+func TestPolicy_Allowed(t *testing.T) {
+	p, err := NewPolicy(map[string][]string{
+		"patron":    {"/v1.BookService/Read"},
+		"librarian": {"/v1.BookService/*"},
+		"admin":     {"*"},
+	})
+	if err != nil {
+		t.Fatalf("NewPolicy() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		roles  []string
+		method string
+		want   bool
+	}{
+		{"Exact method", []string{"patron"}, "/v1.BookService/Read", true},
+		{"Unlisted method", []string{"patron"}, "/v1.BookService/Delete", false},
+		{"Service wildcard", []string{"librarian"}, "/v1.BookService/Delete", true},
+		{"Service wildcard of another service", []string{"librarian"}, "/v1.ApiKeyService/Issue", false},
+		{"Global wildcard", []string{"admin"}, "/v1.ApiKeyService/Issue", true},
+		{"Any of several roles", []string{"guest", "patron"}, "/v1.BookService/Read", true},
+		{"Unknown role", []string{"guest"}, "/v1.BookService/Read", false},
+		{"No roles", nil, "/v1.BookService/Read", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.Allowed(tt.roles, tt.method); got != tt.want {
+				t.Errorf("Allowed(%v, %s) = %v, want %v", tt.roles, tt.method, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewPolicy_Invalid(t *testing.T) {
+	for _, m := range []string{"Read", "v1.BookService/Read", "/v1.BookService/Read/x"} {
+		if _, err := NewPolicy(map[string][]string{"patron": {m}}); err == nil {
+			t.Errorf("NewPolicy() accepted method %q", m)
+		}
+	}
+}
+
+func TestLoadPolicy(t *testing.T) {
+	p, err := LoadPolicy("../../configs/policy.yaml")
+	if err != nil {
+		t.Fatalf("LoadPolicy() error = %v", err)
+	}
+	if !p.Allowed([]string{"admin"}, "/v1.BookService/Delete") || p.Allowed([]string{"librarian"}, "/v1.BookService/Delete") {
+		t.Errorf("LoadPolicy() does not match configs/policy.yaml")
+	}
+}
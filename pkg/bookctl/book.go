@@ -0,0 +1,213 @@
+package bookctl
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"gopkg.in/yaml.v2"
+
+	"github.com/radean0909/redeam-rest/pkg/api/v1"
+)
+
+// dateLayout is how publish dates are read and printed
+const dateLayout = "2006-01-02"
+
+// bookDoc is the JSON and YAML form of a book, read by -f and import and printed by -o json and -o yaml
+type bookDoc struct {
+	ID          int64   `json:"id,omitempty" yaml:"id,omitempty"`
+	Title       string  `json:"title" yaml:"title"`
+	Author      string  `json:"author" yaml:"author"`
+	Publisher   string  `json:"publisher" yaml:"publisher"`
+	PublishDate string  `json:"publish_date,omitempty" yaml:"publish_date,omitempty"` // YYYY-MM-DD or RFC 3339
+	Rating      float64 `json:"rating" yaml:"rating"`
+	Status      string  `json:"status,omitempty" yaml:"status,omitempty"` // CHECKED_IN or CHECKED_OUT
+	ISBN        string  `json:"isbn,omitempty" yaml:"isbn,omitempty"`
+
+	// set by the server, ignored when read
+	CreatedAt string `json:"created_at,omitempty" yaml:"created_at,omitempty"` // RFC 3339
+	UpdatedAt string `json:"updated_at,omitempty" yaml:"updated_at,omitempty"`
+	CreatedBy string `json:"created_by,omitempty" yaml:"created_by,omitempty"`
+	UpdatedBy string `json:"updated_by,omitempty" yaml:"updated_by,omitempty"`
+}
+
+func newBookDoc(b *v1.Book) bookDoc {
+	d := bookDoc{
+		ID:        b.Id,
+		Title:     b.Title,
+		Author:    b.Author,
+		Publisher: b.Publisher,
+		Rating:    b.Rating,
+		Status:    b.Status.String(),
+		ISBN:      b.Isbn,
+		CreatedAt: formatTime(b.CreatedAt),
+		UpdatedAt: formatTime(b.UpdatedAt),
+		CreatedBy: b.CreatedBy,
+		UpdatedBy: b.UpdatedBy,
+	}
+	if b.PublishDate != nil {
+		if t, err := ptypes.Timestamp(b.PublishDate); err == nil {
+			d.PublishDate = t.UTC().Format(dateLayout)
+		}
+	}
+	return d
+}
+
+// formatTime prints a server set time in RFC 3339, empty when it is unset
+func formatTime(ts *timestamp.Timestamp) string {
+	if ts == nil {
+		return ""
+	}
+	t, err := ptypes.Timestamp(ts)
+	if err != nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func (d bookDoc) book() (*v1.Book, error) {
+	b := &v1.Book{
+		Id:        d.ID,
+		Title:     d.Title,
+		Author:    d.Author,
+		Publisher: d.Publisher,
+		Rating:    d.Rating,
+		Isbn:      d.ISBN,
+	}
+	var err error
+	if d.PublishDate != "" {
+		if b.PublishDate, err = parseDate(d.PublishDate); err != nil {
+			return nil, err
+		}
+	}
+	if d.Status != "" {
+		if b.Status, err = parseStatus(d.Status); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// readBook reads a single book from a JSON or YAML file, - is stdin
+func (c *client) readBook(path string) (*v1.Book, error) {
+	data, err := c.readFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var d bookDoc
+	if err := yaml.UnmarshalStrict(data, &d); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	b, err := d.book()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return b, nil
+}
+
+// readBooks reads a list of books from a JSON or YAML file, - is stdin
+func (c *client) readBooks(path string) ([]*v1.Book, error) {
+	data, err := c.readFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var docs []bookDoc
+	if err := yaml.UnmarshalStrict(data, &docs); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	books := make([]*v1.Book, len(docs))
+	for i, d := range docs {
+		if books[i], err = d.book(); err != nil {
+			return nil, fmt.Errorf("%s: book %d: %v", path, i+1, err)
+		}
+	}
+	return books, nil
+}
+
+func (c *client) readFile(path string) ([]byte, error) {
+	var (
+		data []byte
+		err  error
+	)
+	if path == "-" {
+		data, err = ioutil.ReadAll(c.stdin)
+	} else {
+		data, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	return data, nil
+}
+
+// bookFlags are the flags setting the fields of a book
+type bookFlags struct {
+	title, author, publisher, published, status, isbn string
+	rating                                            float64
+}
+
+func addBookFlags(fs *flag.FlagSet) *bookFlags {
+	f := new(bookFlags)
+	fs.StringVar(&f.title, "title", "", "title of the book")
+	fs.StringVar(&f.author, "author", "", "author of the book")
+	fs.StringVar(&f.publisher, "publisher", "", "publisher of the book")
+	fs.StringVar(&f.published, "published", "", "publish date as YYYY-MM-DD")
+	fs.Float64Var(&f.rating, "rating", 0, "rating of the book")
+	fs.StringVar(&f.status, "status", "", "checked_in or checked_out")
+	fs.StringVar(&f.isbn, "isbn", "", "ISBN-10 or ISBN-13 of the book")
+	return f
+}
+
+// apply sets the fields of b whose flags were given on the command line
+func (f *bookFlags) apply(fs *flag.FlagSet, b *v1.Book) error {
+	var err error
+	fs.Visit(func(fl *flag.Flag) {
+		if err != nil {
+			return
+		}
+		switch fl.Name {
+		case "title":
+			b.Title = f.title
+		case "author":
+			b.Author = f.author
+		case "publisher":
+			b.Publisher = f.publisher
+		case "published":
+			b.PublishDate, err = parseDate(f.published)
+		case "rating":
+			b.Rating = f.rating
+		case "status":
+			b.Status, err = parseStatus(f.status)
+		case "isbn":
+			b.Isbn = f.isbn
+		}
+	})
+	return err
+}
+
+func parseDate(s string) (*timestamp.Timestamp, error) {
+	t, err := time.Parse(dateLayout, s)
+	if err != nil {
+		if t, err = time.Parse(time.RFC3339, s); err != nil {
+			return nil, fmt.Errorf("date %q is neither YYYY-MM-DD nor RFC 3339", s)
+		}
+	}
+	return ptypes.TimestampProto(t)
+}
+
+func parseStatus(s string) (v1.Book_Status, error) {
+	v, ok := v1.Book_Status_value[strings.ToUpper(strings.Replace(s, "-", "_", -1))]
+	if !ok || v == int32(v1.Book_UNKNOWN) {
+		return v1.Book_UNKNOWN, fmt.Errorf("status %q is not checked_in or checked_out", s)
+	}
+	return v1.Book_Status(v), nil
+}
+
+// statusName is how a status reads in messages, e.g. "checked out"
+func statusName(s v1.Book_Status) string {
+	return strings.ToLower(strings.Replace(s.String(), "_", " ", -1))
+}
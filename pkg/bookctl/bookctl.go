@@ -0,0 +1,218 @@
+// Package bookctl implements bookctl, the command line client of the Book service.
+package bookctl
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+
+	"github.com/radean0909/redeam-rest/pkg/certs"
+	bookclient "github.com/radean0909/redeam-rest/pkg/client"
+)
+
+// ErrUsage is returned for invalid command lines, after the usage was printed
+var ErrUsage = errors.New("invalid usage")
+
+// dial connects to the server, tests replace it with an in-memory connection
+var dial = grpc.DialContext
+
+const usage = `Usage: bookctl [flags] <command> [command flags] [arguments]
+
+Commands:
+  create    create a book from flags or a JSON/YAML file
+  get       print books by id
+  list      print all books
+  update    change fields of a book from flags or a JSON/YAML file
+  delete    delete books by id
+  checkout  mark a book as checked out
+  checkin   mark a book as checked in
+  import    create the books listed in a JSON/YAML file
+
+Run 'bookctl <command> -h' for the flags of a command.
+
+Flags:
+`
+
+// globals are the flags shared by all commands
+type globals struct {
+	server        string
+	timeout       time.Duration
+	token         string
+	apiKey        string
+	output        string
+	tls           bool
+	tlsCA         string
+	tlsCert       string
+	tlsKey        string
+	tlsServerName string
+}
+
+// client is what commands work with
+type client struct {
+	books  *bookclient.Client
+	out    *printer
+	stdin  io.Reader
+	stderr io.Writer
+}
+
+type command func(ctx context.Context, c *client, args []string) error
+
+var commands = map[string]command{
+	"create":   create,
+	"get":      get,
+	"list":     list,
+	"update":   update,
+	"delete":   remove,
+	"checkout": checkout,
+	"checkin":  checkin,
+	"import":   importBooks,
+}
+
+// Run executes the command line args, without the program name. Results are printed to stdout,
+// usage and flag errors to stderr.
+func Run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("bookctl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		fs.PrintDefaults()
+	}
+
+	var g globals
+	fs.StringVar(&g.server, "server", "localhost:9090", "gRPC server in format host:port")
+	fs.DurationVar(&g.timeout, "timeout", 5*time.Second, "deadline of each call, retries included, e.g. of each page read by list")
+	fs.StringVar(&g.token, "token", os.Getenv("BOOKCTL_TOKEN"), "bearer token sent with every call, defaults to $BOOKCTL_TOKEN")
+	fs.StringVar(&g.apiKey, "api-key", os.Getenv("BOOKCTL_API_KEY"), "API key sent with every call, defaults to $BOOKCTL_API_KEY")
+	fs.StringVar(&g.output, "o", "table", "output format: table, json or yaml")
+	fs.BoolVar(&g.tls, "tls", false, "connect over TLS, verifying the server with the system roots")
+	fs.StringVar(&g.tlsCA, "tls-ca", "", "PEM CA bundle the server certificate is verified with, implies -tls")
+	fs.StringVar(&g.tlsCert, "tls-cert", "", "PEM client certificate for servers requiring mTLS, implies -tls")
+	fs.StringVar(&g.tlsKey, "tls-key", "", "PEM private key of -tls-cert")
+	fs.StringVar(&g.tlsServerName, "tls-server-name", "", "name expected in the server certificate, defaults to the host of -server")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return ErrUsage
+	}
+	cmd, ok := commands[fs.Arg(0)]
+	if !ok {
+		fmt.Fprintf(stderr, "unknown command %q\n", fs.Arg(0))
+		fs.Usage()
+		return ErrUsage
+	}
+	out, err := newPrinter(stdout, g.output)
+	if err != nil {
+		return err
+	}
+
+	opts, err := g.dialOptions()
+	if err != nil {
+		return err
+	}
+	conn, err := dial(ctx, g.server, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %v", g.server, err)
+	}
+	defer conn.Close()
+
+	c := &client{
+		books:  bookclient.NewFromConn(conn, bookclient.WithTimeout(g.timeout), bookclient.WithToken(g.token), bookclient.WithAPIKey(g.apiKey)),
+		out:    out,
+		stdin:  stdin,
+		stderr: stderr,
+	}
+	return cmd(ctx, c, fs.Args()[1:])
+}
+
+// dialOptions secures the connection when any TLS flag is given
+func (g *globals) dialOptions() ([]grpc.DialOption, error) {
+	if !g.tls && g.tlsCA == "" && g.tlsCert == "" {
+		return []grpc.DialOption{grpc.WithInsecure()}, nil
+	}
+
+	cfg := &tls.Config{ServerName: g.tlsServerName, MinVersion: tls.VersionTLS12}
+	if g.tlsCA != "" {
+		roots, err := certs.LoadPool(g.tlsCA)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = roots
+	}
+	if g.tlsCert != "" {
+		cert, err := tls.LoadX509KeyPair(g.tlsCert, g.tlsKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %v", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return []grpc.DialOption{grpc.WithTransportCredentials(credentials.NewTLS(cfg))}, nil
+}
+
+// flags returns the flag set of a command, printing its usage line and flags on errors
+func (c *client) flags(name, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(c.stderr, "Usage: bookctl %s %s\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parse parses the flags of fs, errors other than -h were already printed with the usage
+func parse(fs *flag.FlagSet, args []string) error {
+	err := fs.Parse(args)
+	if err != nil && err != flag.ErrHelp {
+		return ErrUsage
+	}
+	return err
+}
+
+// parseIDs reads the book ids given as arguments, at least one is required
+func parseIDs(fs *flag.FlagSet) ([]int64, error) {
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return nil, ErrUsage
+	}
+	ids := make([]int64, fs.NArg())
+	for i, arg := range fs.Args() {
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil || id <= 0 {
+			return nil, fmt.Errorf("invalid book id %q", arg)
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+// parseID reads the single book id given as argument
+func parseID(fs *flag.FlagSet) (int64, error) {
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return 0, ErrUsage
+	}
+	ids, err := parseIDs(fs)
+	if err != nil {
+		return 0, err
+	}
+	return ids[0], nil
+}
+
+// rpcError reports a failed call with the status code the server answered with
+func rpcError(call string, err error) error {
+	st := status.Convert(err)
+	return fmt.Errorf("%s failed: %s (%s)", call, st.Message(), st.Code())
+}
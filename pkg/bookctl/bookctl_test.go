@@ -0,0 +1,378 @@
+package bookctl
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/radean0909/redeam-rest/pkg/api/v1"
+	bookclient "github.com/radean0909/redeam-rest/pkg/client"
+)
+
+// fakeBooks keeps books in memory and records the authorization metadata of the last call
+type fakeBooks struct {
+	v1.UnimplementedBookServiceServer
+
+	mu      sync.Mutex
+	books   map[int64]*v1.Book
+	next    int64
+	auth    string
+	readAll []*v1.ReadAllRequest
+}
+
+func (f *fakeBooks) record(ctx context.Context) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	f.auth = strings.Join(md.Get("authorization"), ",")
+}
+
+func (f *fakeBooks) Create(ctx context.Context, req *v1.CreateRequest) (*v1.CreateResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record(ctx)
+	f.next++
+	req.Book.Id = f.next
+	f.books[f.next] = req.Book
+	return &v1.CreateResponse{Api: "v1", Id: f.next}, nil
+}
+
+func (f *fakeBooks) Read(ctx context.Context, req *v1.ReadRequest) (*v1.ReadResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record(ctx)
+	b, ok := f.books[req.Id]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "cannot find Id='%d'", req.Id)
+	}
+	return &v1.ReadResponse{Api: "v1", Book: b}, nil
+}
+
+func (f *fakeBooks) ReadAll(ctx context.Context, req *v1.ReadAllRequest) (*v1.ReadAllResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record(ctx)
+	f.readAll = append(f.readAll, req)
+	after, _ := strconv.ParseInt(req.PageToken, 10, 64)
+	res := &v1.ReadAllResponse{Api: "v1"}
+	for id := after + 1; id <= f.next; id++ {
+		b, ok := f.books[id]
+		if !ok || b.UpdatedAt.GetSeconds() < req.UpdatedSince.GetSeconds() {
+			continue
+		}
+		if len(res.Books) == int(req.PageSize) {
+			res.NextPageToken = strconv.FormatInt(res.Books[len(res.Books)-1].Id, 10)
+			break
+		}
+		res.Books = append(res.Books, b)
+	}
+	return res, nil
+}
+
+func (f *fakeBooks) Update(ctx context.Context, req *v1.UpdateRequest) (*v1.UpdateResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record(ctx)
+	if _, ok := f.books[req.Book.Id]; !ok {
+		return nil, status.Errorf(codes.NotFound, "Id='%d' is not found", req.Book.Id)
+	}
+	f.books[req.Book.Id] = req.Book
+	return &v1.UpdateResponse{Api: "v1", Updated: 1}, nil
+}
+
+func (f *fakeBooks) Delete(ctx context.Context, req *v1.DeleteRequest) (*v1.DeleteResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record(ctx)
+	if _, ok := f.books[req.Id]; !ok {
+		return nil, status.Errorf(codes.NotFound, "Id='%d' is not found", req.Id)
+	}
+	delete(f.books, req.Id)
+	return &v1.DeleteResponse{Api: "v1", Deleted: 1}, nil
+}
+
+func (f *fakeBooks) ImportBooks(stream v1.BookService_ImportBooksServer) error {
+	res := &v1.ImportBooksResponse{Api: "v1"}
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(res)
+		}
+		if err != nil {
+			return err
+		}
+		res.Received++
+		if req.Book.Title == "" {
+			res.Errors = append(res.Errors, &v1.ImportError{
+				Row:    res.Received,
+				Status: status.New(codes.InvalidArgument, "title is required").Proto(),
+			})
+			continue
+		}
+		if !req.DryRun {
+			if _, err := f.Create(stream.Context(), &v1.CreateRequest{Book: req.Book}); err != nil {
+				return err
+			}
+		}
+		res.Imported++
+	}
+}
+
+// add stores books under the next ids
+func (f *fakeBooks) add(books ...*v1.Book) {
+	for _, b := range books {
+		f.next++
+		b.Id = f.next
+		f.books[f.next] = b
+	}
+}
+
+// startServer serves f in memory and points dial at it
+func startServer(t *testing.T, f *fakeBooks) {
+	server := grpc.NewServer()
+	v1.RegisterBookServiceServer(server, f)
+	lis := bufconn.Listen(1 << 20)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	orig := dial
+	dial = func(ctx context.Context, target string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+		opts = append(opts, grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }))
+		return grpc.DialContext(ctx, "bufnet", opts...)
+	}
+	t.Cleanup(func() { dial = orig })
+}
+
+func newFake() *fakeBooks {
+	published, _ := ptypes.TimestampProto(mustDate("1954-07-29"))
+	return &fakeBooks{
+		next: 1,
+		books: map[int64]*v1.Book{1: {
+			Id:          1,
+			Title:       "The Fellowship of the Ring",
+			Author:      "J. R. R. Tolkien",
+			Publisher:   "Allen & Unwin",
+			PublishDate: published,
+			Rating:      4.5,
+			Status:      v1.Book_CHECKED_IN,
+			Isbn:        "9780261102354",
+		}},
+	}
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		stdin   string
+		want    []string // substrings of stdout
+		wantErr string   // substring of the error
+		setup   func(f *fakeBooks)
+		check   func(t *testing.T, f *fakeBooks)
+	}{
+		{
+			name: "get table",
+			args: []string{"get", "1"},
+			want: []string{"ID  TITLE", "1   The Fellowship of the Ring", "1954-07-29", "CHECKED_IN"},
+		},
+		{
+			name: "get json",
+			args: []string{"-o", "json", "get", "1"},
+			want: []string{`"id": 1`, `"publish_date": "1954-07-29"`, `"status": "CHECKED_IN"`},
+		},
+		{
+			name:    "get missing",
+			args:    []string{"get", "7"},
+			wantErr: "Read of book 7 failed: cannot find Id='7' (NotFound)",
+		},
+		{
+			name:    "get invalid id",
+			args:    []string{"get", "one"},
+			wantErr: `invalid book id "one"`,
+		},
+		{
+			name: "list yaml",
+			args: []string{"-o", "yaml", "list"},
+			want: []string{"- id: 1\n  title: The Fellowship of the Ring"},
+		},
+		{
+			name: "list pages",
+			args: []string{"list", "-page-size", "1"},
+			want: []string{"1   The Fellowship of the Ring", "2   The Two Towers", "3   The Return of the King"},
+			setup: func(f *fakeBooks) {
+				f.add(&v1.Book{Title: "The Two Towers"}, &v1.Book{Title: "The Return of the King"})
+			},
+			check: func(t *testing.T, f *fakeBooks) {
+				if len(f.readAll) != 3 || f.readAll[2].PageToken != "2" || f.readAll[2].PageSize != 1 {
+					t.Errorf("ReadAll calls = %v, want one per book", f.readAll)
+				}
+			},
+		},
+		{
+			name: "list updated since",
+			args: []string{"list", "-updated-since", "2020-01-02T15:04:05Z"},
+			want: []string{"3   The Return of the King"},
+			setup: func(f *fakeBooks) {
+				// within the overlap ListUpdatedSince reaches back, but before -updated-since
+				f.add(&v1.Book{Title: "The Two Towers", UpdatedAt: &timestamp.Timestamp{Seconds: 1577977445 - 60}})
+				f.add(&v1.Book{Title: "The Return of the King", UpdatedAt: &timestamp.Timestamp{Seconds: 1577977445}})
+			},
+			check: func(t *testing.T, f *fakeBooks) {
+				want := int64(1577977445) - int64(bookclient.SyncOverlap/time.Second)
+				if f.readAll[0].GetUpdatedSince().GetSeconds() != want {
+					t.Errorf("updated_since = %v, want 2020-01-02T15:04:05Z less the sync overlap", f.readAll[0].GetUpdatedSince())
+				}
+			},
+		},
+		{
+			name:    "list invalid page size",
+			args:    []string{"list", "-page-size", "0"},
+			wantErr: ErrUsage.Error(),
+		},
+		{
+			name:    "list updated since invalid date",
+			args:    []string{"list", "-updated-since", "soon"},
+			wantErr: `date "soon" is neither YYYY-MM-DD nor RFC 3339`,
+		},
+		{
+			name: "create from flags",
+			args: []string{"create", "-title", "The Two Towers", "-author", "J. R. R. Tolkien", "-published", "1954-11-11"},
+			want: []string{"2   The Two Towers"},
+			check: func(t *testing.T, f *fakeBooks) {
+				if b := f.books[2]; b == nil || b.Status != v1.Book_CHECKED_IN || b.PublishDate == nil {
+					t.Errorf("created book = %v, want checked in with a publish date", b)
+				}
+			},
+		},
+		{
+			name:  "create from stdin",
+			args:  []string{"-o", "json", "create", "-f", "-", "-rating", "5"},
+			stdin: `{"title": "The Return of the King", "status": "checked_out"}`,
+			want:  []string{`"id": 2`, `"rating": 5`, `"status": "CHECKED_OUT"`},
+		},
+		{
+			name:    "create unknown field",
+			args:    []string{"create", "-f", "-"},
+			stdin:   "name: The Hobbit\n",
+			wantErr: "failed to parse -",
+		},
+		{
+			name: "update keeps other fields",
+			args: []string{"update", "-rating", "5", "1"},
+			check: func(t *testing.T, f *fakeBooks) {
+				if b := f.books[1]; b.Rating != 5 || b.Title != "The Fellowship of the Ring" {
+					t.Errorf("updated book = %v, want rating 5 and the title kept", b)
+				}
+			},
+		},
+		{
+			name:    "update invalid status",
+			args:    []string{"update", "-status", "lost", "1"},
+			wantErr: `status "lost" is not checked_in or checked_out`,
+		},
+		{
+			name: "checkout",
+			args: []string{"checkout", "1"},
+			want: []string{"CHECKED_OUT"},
+		},
+		{
+			name:    "checkin of a checked in book",
+			args:    []string{"checkin", "1"},
+			wantErr: "book 1 is already checked in",
+		},
+		{
+			name: "delete",
+			args: []string{"delete", "1"},
+			want: []string{"deleted 1"},
+		},
+		{
+			name:  "import",
+			args:  []string{"import", "-"},
+			stdin: "- title: The Hobbit\n- author: nobody\n",
+			want:  []string{"imported 1 of 2 books", "2    InvalidArgument  title is required"},
+		},
+		{
+			name:  "import dry run",
+			args:  []string{"import", "-dry-run", "-"},
+			stdin: `[{"title": "The Hobbit"}]`,
+			check: func(t *testing.T, f *fakeBooks) {
+				if len(f.books) != 1 {
+					t.Errorf("%d books after a dry run, want 1", len(f.books))
+				}
+			},
+		},
+		{
+			name: "token",
+			args: []string{"-token", "abc", "list"},
+			check: func(t *testing.T, f *fakeBooks) {
+				if f.auth != "Bearer abc" {
+					t.Errorf("authorization = %q, want Bearer abc", f.auth)
+				}
+			},
+		},
+		{
+			name:    "unknown command",
+			args:    []string{"lend", "1"},
+			wantErr: ErrUsage.Error(),
+		},
+		{
+			name:    "unknown output",
+			args:    []string{"-o", "xml", "list"},
+			wantErr: `unknown output format "xml"`,
+		},
+		{
+			name:    "timeout",
+			args:    []string{"-timeout", "1ns", "list"},
+			wantErr: "DeadlineExceeded",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFake()
+			if tt.setup != nil {
+				tt.setup(f)
+			}
+			startServer(t, f)
+
+			var stdout, stderr bytes.Buffer
+			err := Run(context.Background(), tt.args, strings.NewReader(tt.stdin), &stdout, &stderr)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Run() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Run() error = %v, stderr %s", err, stderr.String())
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(stdout.String(), w) {
+					t.Errorf("Run() output\n%s\nwant it to contain %q", stdout.String(), w)
+				}
+			}
+			if tt.check != nil {
+				tt.check(t, f)
+			}
+		})
+	}
+}
+
+func mustDate(s string) time.Time {
+	t, err := time.Parse(dateLayout, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
@@ -0,0 +1,235 @@
+package bookctl
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/golang/protobuf/ptypes"
+
+	"github.com/radean0909/redeam-rest/pkg/api/v1"
+)
+
+// create adds a book from the -f file and the field flags, which take precedence
+func create(ctx context.Context, c *client, args []string) error {
+	fs := c.flags("create", "[-f FILE] [field flags]")
+	file := fs.String("f", "", "JSON or YAML file with the book, - for stdin")
+	fields := addBookFlags(fs)
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return ErrUsage
+	}
+
+	book := &v1.Book{Status: v1.Book_CHECKED_IN}
+	if *file != "" {
+		var err error
+		if book, err = c.readBook(*file); err != nil {
+			return err
+		}
+		if book.Status == v1.Book_UNKNOWN {
+			book.Status = v1.Book_CHECKED_IN
+		}
+	}
+	if err := fields.apply(fs, book); err != nil {
+		return err
+	}
+	book.Id = 0
+
+	id, err := c.books.Create(ctx, book)
+	if err != nil {
+		return rpcError("Create", err)
+	}
+	book.Id = id
+	return c.out.book(book)
+}
+
+// get prints the books with the given ids
+func get(ctx context.Context, c *client, args []string) error {
+	fs := c.flags("get", "ID...")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	ids, err := parseIDs(fs)
+	if err != nil {
+		return err
+	}
+
+	books := make([]*v1.Book, len(ids))
+	for i, id := range ids {
+		book, err := c.books.Read(ctx, id)
+		if err != nil {
+			return rpcError(fmt.Sprintf("Read of book %d", id), err)
+		}
+		books[i] = book
+	}
+	if len(books) == 1 {
+		return c.out.book(books[0])
+	}
+	return c.out.books(books)
+}
+
+// list prints all books, or those updated since -updated-since, read -page-size at a time
+func list(ctx context.Context, c *client, args []string) error {
+	fs := c.flags("list", "[-updated-since DATE] [-page-size N]")
+	since := fs.String("updated-since", "", "only books created or updated at or after this YYYY-MM-DD or RFC 3339 time")
+	pageSize := fs.Int("page-size", 100, "books read per call")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 || *pageSize <= 0 || *pageSize > math.MaxInt32 {
+		fs.Usage()
+		return ErrUsage
+	}
+
+	if *since == "" {
+		books, err := c.books.List(ctx, int32(*pageSize)).All()
+		if err != nil {
+			return rpcError("ReadAll", err)
+		}
+		return c.out.books(books)
+	}
+
+	ts, err := parseDate(*since)
+	if err != nil {
+		return err
+	}
+	from, err := ptypes.Timestamp(ts)
+	if err != nil {
+		return err
+	}
+	// ListUpdatedSince reaches back SyncOverlap for syncing clients, this lists what was asked for
+	var books []*v1.Book
+	it := c.books.ListUpdatedSince(ctx, from, int32(*pageSize))
+	for it.Next() {
+		if t, err := ptypes.Timestamp(it.Book().UpdatedAt); err == nil && t.Before(from) {
+			continue
+		}
+		books = append(books, it.Book())
+	}
+	if err := it.Err(); err != nil {
+		return rpcError("ReadAll", err)
+	}
+	return c.out.books(books)
+}
+
+// update changes the fields of a book given in the -f file and the field flags, the others are kept
+func update(ctx context.Context, c *client, args []string) error {
+	fs := c.flags("update", "[-f FILE] [field flags] ID")
+	file := fs.String("f", "", "JSON or YAML file with the book, replacing all its fields, - for stdin")
+	fields := addBookFlags(fs)
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	id, err := parseID(fs)
+	if err != nil {
+		return err
+	}
+
+	var book *v1.Book
+	if *file != "" {
+		if book, err = c.readBook(*file); err != nil {
+			return err
+		}
+	} else {
+		// Update replaces every field, start from the stored book
+		if book, err = c.books.Read(ctx, id); err != nil {
+			return rpcError("Read", err)
+		}
+	}
+	if err := fields.apply(fs, book); err != nil {
+		return err
+	}
+	book.Id = id
+
+	return c.save(ctx, book)
+}
+
+// remove deletes the books with the given ids
+func remove(ctx context.Context, c *client, args []string) error {
+	fs := c.flags("delete", "ID...")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	ids, err := parseIDs(fs)
+	if err != nil {
+		return err
+	}
+
+	var deleted int64
+	for _, id := range ids {
+		if err := c.books.Delete(ctx, id); err != nil {
+			return rpcError(fmt.Sprintf("Delete of book %d", id), err)
+		}
+		deleted++
+	}
+	return c.out.count("deleted", deleted)
+}
+
+// checkout marks a checked in book as checked out
+func checkout(ctx context.Context, c *client, args []string) error {
+	return setStatus(ctx, c, "checkout", v1.Book_CHECKED_OUT, args)
+}
+
+// checkin marks a checked out book as checked in
+func checkin(ctx context.Context, c *client, args []string) error {
+	return setStatus(ctx, c, "checkin", v1.Book_CHECKED_IN, args)
+}
+
+func setStatus(ctx context.Context, c *client, name string, s v1.Book_Status, args []string) error {
+	fs := c.flags(name, "ID")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	id, err := parseID(fs)
+	if err != nil {
+		return err
+	}
+
+	book, err := c.books.Read(ctx, id)
+	if err != nil {
+		return rpcError("Read", err)
+	}
+	if book.Status == s {
+		return fmt.Errorf("book %d is already %s", id, statusName(s))
+	}
+	book.Status = s
+	return c.save(ctx, book)
+}
+
+// save updates book and prints it
+func (c *client) save(ctx context.Context, book *v1.Book) error {
+	if err := c.books.Update(ctx, book); err != nil {
+		return rpcError("Update", err)
+	}
+	return c.out.book(book)
+}
+
+// importBooks streams the books of a JSON or YAML list to the server
+func importBooks(ctx context.Context, c *client, args []string) error {
+	fs := c.flags("import", "[-dry-run] FILE")
+	dryRun := fs.Bool("dry-run", false, "only validate the books, nothing is stored")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return ErrUsage
+	}
+
+	books, err := c.readBooks(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	for _, b := range books {
+		b.Id = 0
+	}
+	res, err := c.books.ImportBooks(ctx, books, *dryRun)
+	if err != nil {
+		return rpcError("ImportBooks", err)
+	}
+	return c.out.imported(res)
+}
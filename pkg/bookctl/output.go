@@ -0,0 +1,120 @@
+package bookctl
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+
+	"google.golang.org/grpc/status"
+	"gopkg.in/yaml.v2"
+
+	"github.com/radean0909/redeam-rest/pkg/api/v1"
+)
+
+// Output formats of -o
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+	formatYAML  = "yaml"
+)
+
+// printer writes results in the format chosen with -o
+type printer struct {
+	w      io.Writer
+	format string
+}
+
+func newPrinter(w io.Writer, format string) (*printer, error) {
+	switch format {
+	case formatTable, formatJSON, formatYAML:
+		return &printer{w: w, format: format}, nil
+	}
+	return nil, fmt.Errorf("unknown output format %q, use table, json or yaml", format)
+}
+
+// book prints a single book, as an object rather than a list in JSON and YAML
+func (p *printer) book(b *v1.Book) error {
+	if p.format == formatTable {
+		return p.books([]*v1.Book{b})
+	}
+	return p.encode(newBookDoc(b))
+}
+
+func (p *printer) books(books []*v1.Book) error {
+	docs := make([]bookDoc, len(books))
+	for i, b := range books {
+		docs[i] = newBookDoc(b)
+	}
+	if p.format != formatTable {
+		return p.encode(docs)
+	}
+
+	tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tTITLE\tAUTHOR\tPUBLISHER\tPUBLISHED\tRATING\tSTATUS\tISBN")
+	for _, d := range docs {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			d.ID, d.Title, d.Author, d.Publisher, d.PublishDate,
+			strconv.FormatFloat(d.Rating, 'f', -1, 64), d.Status, d.ISBN)
+	}
+	return tw.Flush()
+}
+
+// count prints how many books an operation affected, e.g. "deleted 2"
+func (p *printer) count(what string, n int64) error {
+	if p.format == formatTable {
+		_, err := fmt.Fprintf(p.w, "%s %d\n", what, n)
+		return err
+	}
+	return p.encode(map[string]int64{what: n})
+}
+
+// importError is the JSON and YAML form of a row the server rejected
+type importError struct {
+	Row     int64  `json:"row" yaml:"row"`
+	Code    string `json:"code" yaml:"code"`
+	Message string `json:"message" yaml:"message"`
+}
+
+type importResult struct {
+	Received int64         `json:"received" yaml:"received"`
+	Imported int64         `json:"imported" yaml:"imported"`
+	Errors   []importError `json:"errors,omitempty" yaml:"errors,omitempty"`
+}
+
+func (p *printer) imported(res *v1.ImportBooksResponse) error {
+	r := importResult{Received: res.Received, Imported: res.Imported}
+	for _, e := range res.Errors {
+		st := status.FromProto(e.Status)
+		r.Errors = append(r.Errors, importError{Row: e.Row, Code: st.Code().String(), Message: st.Message()})
+	}
+	if p.format != formatTable {
+		return p.encode(r)
+	}
+
+	fmt.Fprintf(p.w, "imported %d of %d books\n", r.Imported, r.Received)
+	if len(r.Errors) == 0 {
+		return nil
+	}
+	tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ROW\tCODE\tERROR")
+	for _, e := range r.Errors {
+		fmt.Fprintf(tw, "%d\t%s\t%s\n", e.Row, e.Code, e.Message)
+	}
+	return tw.Flush()
+}
+
+func (p *printer) encode(v interface{}) error {
+	if p.format == formatYAML {
+		data, err := yaml.Marshal(v)
+		if err != nil {
+			return err
+		}
+		_, err = p.w.Write(data)
+		return err
+	}
+	enc := json.NewEncoder(p.w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,121 @@
+// Package cache keeps encoded responses for a while so repeated reads skip the database.
+package cache
+
+import (
+	"container/list"
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cache stores values by key. Values may be dropped at any time, a missed Get only costs a read
+// of the source, so implementations handle their own failures. LRU keeps values in process, one
+// backed by e.g. Redis would share them between replicas.
+type Cache interface {
+	// Get returns the value of key, false when there is none or it expired
+	Get(ctx context.Context, key string) ([]byte, bool)
+	// Set stores value under key
+	Set(ctx context.Context, key string, value []byte)
+	// Delete drops keys
+	Delete(ctx context.Context, keys ...string)
+	// DeletePrefix drops every key starting with prefix
+	DeletePrefix(ctx context.Context, prefix string)
+}
+
+// LRU is an in-process Cache of at most size values, each kept for ttl. The least recently used
+// value makes room for new ones.
+type LRU struct {
+	size int
+	ttl  time.Duration
+	now  func() time.Time
+
+	mu    sync.Mutex
+	order *list.List // of *entry, most recently used first
+	items map[string]*list.Element
+}
+
+type entry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+var _ Cache = (*LRU)(nil)
+
+// NewLRU keeps at most size values for ttl each
+func NewLRU(size int, ttl time.Duration) *LRU {
+	return &LRU{size: size, ttl: ttl, now: time.Now, order: list.New(), items: make(map[string]*list.Element)}
+}
+
+// Get returns the value of key unless it expired
+func (c *LRU) Get(_ context.Context, key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*entry)
+	if !c.now().Before(e.expires) {
+		c.remove(el)
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return e.value, true
+}
+
+// Set stores value under key, evicting the least recently used value when the cache is full
+func (c *LRU) Set(_ context.Context, key string, value []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires := c.now().Add(c.ttl)
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*entry)
+		e.value, e.expires = value, expires
+		c.order.MoveToFront(el)
+		return
+	}
+	c.items[key] = c.order.PushFront(&entry{key: key, value: value, expires: expires})
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+// Delete drops keys
+func (c *LRU) Delete(_ context.Context, keys ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, key := range keys {
+		if el, ok := c.items[key]; ok {
+			c.remove(el)
+		}
+	}
+}
+
+// DeletePrefix drops every key starting with prefix
+func (c *LRU) DeletePrefix(_ context.Context, prefix string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, el := range c.items {
+		if strings.HasPrefix(key, prefix) {
+			c.remove(el)
+		}
+	}
+}
+
+// Len returns the number of values held, expired ones included until they are evicted
+func (c *LRU) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+func (c *LRU) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.items, el.Value.(*entry).key)
+}
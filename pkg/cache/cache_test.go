@@ -0,0 +1,68 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLRU(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewLRU(2, time.Minute)
+	c.now = func() time.Time { return now }
+
+	c.Set(ctx, "book:1", []byte("one"))
+	c.Set(ctx, "book:2", []byte("two"))
+	if v, ok := c.Get(ctx, "book:1"); !ok || string(v) != "one" {
+		t.Fatalf("Get(book:1) = %q, %v, want one", v, ok)
+	}
+
+	// book:2 is the least recently used now
+	c.Set(ctx, "book:3", []byte("three"))
+	if _, ok := c.Get(ctx, "book:2"); ok {
+		t.Error("Get(book:2) found it, want it evicted")
+	}
+	if c.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", c.Len())
+	}
+
+	c.Set(ctx, "book:1", []byte("uno"))
+	if v, _ := c.Get(ctx, "book:1"); string(v) != "uno" {
+		t.Errorf("Get(book:1) = %q after Set, want uno", v)
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok := c.Get(ctx, "book:1"); ok {
+		t.Error("Get(book:1) found it after the ttl, want it expired")
+	}
+	if c.Len() != 1 {
+		t.Errorf("Len() = %d, want the expired value dropped", c.Len())
+	}
+}
+
+func TestLRU_Delete(t *testing.T) {
+	ctx := context.Background()
+	c := NewLRU(10, time.Minute)
+	for _, key := range []string{"book:1", "book:2", "books:0:10", "books:10:10"} {
+		c.Set(ctx, key, []byte(key))
+	}
+
+	c.Delete(ctx, "book:1", "book:9")
+	c.DeletePrefix(ctx, "books:")
+
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{"book:1", false},
+		{"book:2", true},
+		{"books:0:10", false},
+		{"books:10:10", false},
+	}
+	for _, tt := range tests {
+		if _, ok := c.Get(ctx, tt.key); ok != tt.want {
+			t.Errorf("Get(%s) found = %v, want %v", tt.key, ok, tt.want)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+// Package certs loads TLS certificates and CA bundles and reloads them when their files change,
+// so rotated certificates are picked up without restarting the servers.
+package certs
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"sync"
+	"time"
+)
+
+// Store holds a certificate key pair and an optional CA bundle for verifying client certificates
+type Store struct {
+	certFile, keyFile, caFile string
+
+	mu   sync.RWMutex
+	raw  [][]byte // file contents the current state was parsed from
+	cert *tls.Certificate
+	pool *x509.CertPool // nil without a CA bundle
+}
+
+// NewStore loads the key pair and, when caFile is set, the CA bundle client certificates must chain to
+func NewStore(certFile, keyFile, caFile string) (*Store, error) {
+	s := &Store{certFile: certFile, keyFile: keyFile, caFile: caFile}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload reads the files again and swaps in their contents if they changed.
+// On error the previous certificates stay in use.
+func (s *Store) Reload() error {
+	files := []string{s.certFile, s.keyFile}
+	if s.caFile != "" {
+		files = append(files, s.caFile)
+	}
+	raw := make([][]byte, len(files))
+	for i, f := range files {
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			return fmt.Errorf("certs: %v", err)
+		}
+		raw[i] = data
+	}
+
+	s.mu.RLock()
+	unchanged := s.raw != nil && equal(s.raw, raw)
+	s.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	cert, err := tls.X509KeyPair(raw[0], raw[1])
+	if err != nil {
+		return fmt.Errorf("certs: loading %s: %v", s.certFile, err)
+	}
+	var pool *x509.CertPool
+	if s.caFile != "" {
+		if pool, err = parsePool(s.caFile, raw[2]); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	s.raw, s.cert, s.pool = raw, &cert, pool
+	s.mu.Unlock()
+	return nil
+}
+
+// Watch reloads the files every interval until ctx is done
+func (s *Store) Watch(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := s.Reload(); err != nil {
+				log.Printf("keeping current certificates: %v", err)
+			}
+		}
+	}
+}
+
+// ServerConfig returns a TLS config presenting the current certificate. With a CA bundle
+// clients must present a certificate it signed.
+func (s *Store) ServerConfig() *tls.Config {
+	c := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) { return s.current(), nil },
+	}
+	if s.caFile != "" {
+		// the bundle may be reloaded, so verification can't use the static ClientCAs
+		c.ClientAuth = tls.RequireAnyClientCert
+		c.VerifyPeerCertificate = s.verifyClient
+	}
+	return c
+}
+
+// ClientConfig returns a TLS config verifying the server against roots (the system pool when nil)
+// and presenting the current certificate when the server asks for one
+func (s *Store) ClientConfig(roots *x509.CertPool, serverName string) *tls.Config {
+	return &tls.Config{
+		MinVersion:           tls.VersionTLS12,
+		RootCAs:              roots,
+		ServerName:           serverName,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) { return s.current(), nil },
+	}
+}
+
+// ClientAuth reports whether the current certificate may be presented as a client certificate, verifying
+// servers require the clientAuth extended key usage when it lists any
+func (s *Store) ClientAuth() bool {
+	leaf, err := x509.ParseCertificate(s.current().Certificate[0])
+	if err != nil {
+		return false
+	}
+	if len(leaf.ExtKeyUsage) == 0 {
+		return true
+	}
+	for _, u := range leaf.ExtKeyUsage {
+		if u == x509.ExtKeyUsageClientAuth || u == x509.ExtKeyUsageAny {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Store) current() *tls.Certificate {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.cert
+}
+
+func (s *Store) verifyClient(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	if len(rawCerts) == 0 {
+		return errors.New("certs: client certificate required")
+	}
+	chain := make([]*x509.Certificate, len(rawCerts))
+	for i, raw := range rawCerts {
+		c, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return fmt.Errorf("certs: invalid client certificate: %v", err)
+		}
+		chain[i] = c
+	}
+
+	s.mu.RLock()
+	pool := s.pool
+	s.mu.RUnlock()
+
+	opts := x509.VerifyOptions{
+		Roots:         pool,
+		Intermediates: x509.NewCertPool(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	for _, c := range chain[1:] {
+		opts.Intermediates.AddCert(c)
+	}
+	_, err := chain[0].Verify(opts)
+	return err
+}
+
+// LoadPool reads a PEM CA bundle
+func LoadPool(path string) (*x509.CertPool, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("certs: %v", err)
+	}
+	return parsePool(path, data)
+}
+
+func parsePool(path string, data []byte) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("certs: no certificates in %s", path)
+	}
+	return pool, nil
+}
+
+func equal(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
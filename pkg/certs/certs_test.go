@@ -0,0 +1,191 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// issue creates a certificate for name signed by parent, or a self-signed CA when parent is nil.
+// Certificates get usages as extended key usages, serverAuth and clientAuth when none are given.
+func issue(t *testing.T, name string, serial int64, parent *testCert, usages ...x509.ExtKeyUsage) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	signer, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA, tmpl.BasicConstraintsValid = true, true
+		tmpl.KeyUsage = x509.KeyUsageCertSign
+	} else {
+		tmpl.DNSNames = []string{name}
+		tmpl.ExtKeyUsage = usages
+		if len(usages) == 0 {
+			tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+		}
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCert{cert: cert, key: key}
+}
+
+// write stores the certificate and key as PEM files in dir and returns their paths
+func (c *testCert) write(t *testing.T, dir, name string) (certFile, keyFile string) {
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile = filepath.Join(dir, name+".pem"), filepath.Join(dir, name+"-key.pem")
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+// handshake connects client and server over TCP and returns the certificate the server presented.
+// With TLS 1.3 the client may finish before the server rejects its certificate, so both sides are checked.
+func handshake(server, client *tls.Config) (*x509.Certificate, error) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	defer lis.Close()
+
+	errc := make(chan error, 1)
+	go func() {
+		sc, err := lis.Accept()
+		if err != nil {
+			errc <- err
+			return
+		}
+		defer sc.Close()
+		sc.SetDeadline(time.Now().Add(5 * time.Second))
+		errc <- tls.Server(sc, server).Handshake()
+	}()
+
+	cc, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		return nil, err
+	}
+	defer cc.Close()
+	cc.SetDeadline(time.Now().Add(5 * time.Second))
+
+	c := tls.Client(cc, client)
+	cerr := c.Handshake()
+	if serr := <-errc; serr != nil {
+		return nil, serr
+	}
+	if cerr != nil {
+		return nil, cerr
+	}
+	return c.ConnectionState().PeerCertificates[0], nil
+}
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca := issue(t, "ca", 1, nil)
+	otherCA := issue(t, "other ca", 2, nil)
+	caFile, _ := ca.write(t, dir, "ca")
+	certFile, keyFile := issue(t, "localhost", 10, ca).write(t, dir, "server")
+	clientFile, clientKeyFile := issue(t, "client", 20, ca).write(t, dir, "client")
+	strangerFile, strangerKeyFile := issue(t, "client", 30, otherCA).write(t, dir, "stranger")
+	serverOnlyFile, serverOnlyKeyFile := issue(t, "localhost", 40, ca, x509.ExtKeyUsageServerAuth).write(t, dir, "server-only")
+
+	server, err := NewStore(certFile, keyFile, caFile)
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+	roots, err := LoadPool(caFile)
+	if err != nil {
+		t.Fatalf("LoadPool() error = %v", err)
+	}
+	client, _ := NewStore(clientFile, clientKeyFile, "")
+	stranger, _ := NewStore(strangerFile, strangerKeyFile, "")
+	// like a gateway reusing a server certificate as its client certificate
+	serverOnly, _ := NewStore(serverOnlyFile, serverOnlyKeyFile, "")
+
+	tests := []struct {
+		name    string
+		client  *tls.Config
+		wantErr bool
+	}{
+		{"Client certificate", client.ClientConfig(roots, "localhost"), false},
+		{"Client certificate from another CA", stranger.ClientConfig(roots, "localhost"), true},
+		{"Server certificate without clientAuth", serverOnly.ClientConfig(roots, "localhost"), true},
+		{"No client certificate", &tls.Config{RootCAs: roots, ServerName: "localhost"}, true},
+		{"Wrong server name", client.ClientConfig(roots, "example.com"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := handshake(server.ServerConfig(), tt.client); (err != nil) != tt.wantErr {
+				t.Errorf("handshake() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("ClientAuth", func(t *testing.T) {
+		if !client.ClientAuth() {
+			t.Errorf("ClientAuth() = false for a clientAuth certificate")
+		}
+		if serverOnly.ClientAuth() {
+			t.Errorf("ClientAuth() = true for a serverAuth only certificate")
+		}
+	})
+
+	t.Run("Reload", func(t *testing.T) {
+		issue(t, "localhost", 11, ca).write(t, dir, "server")
+		if err := server.Reload(); err != nil {
+			t.Fatalf("Reload() error = %v", err)
+		}
+		got, err := handshake(server.ServerConfig(), client.ClientConfig(roots, "localhost"))
+		if err != nil {
+			t.Fatalf("handshake() error = %v", err)
+		}
+		if got.SerialNumber.Int64() != 11 {
+			t.Errorf("handshake() presented serial %v, want the reloaded certificate", got.SerialNumber)
+		}
+
+		// a broken file keeps the previous certificate in use
+		ioutil.WriteFile(certFile, []byte("not a certificate"), 0600)
+		if err := server.Reload(); err == nil {
+			t.Errorf("Reload() accepted an invalid certificate")
+		}
+		if got, err := handshake(server.ServerConfig(), client.ClientConfig(roots, "localhost")); err != nil || got.SerialNumber.Int64() != 11 {
+			t.Errorf("handshake() after a failed reload = %v, %v", got, err)
+		}
+	})
+}
@@ -0,0 +1,324 @@
+// Package client is the Go SDK of the Book service. It sets up the connection, fills in the API
+// version, retries calls while the server is unavailable, under one idempotency key for calls that
+// change books, and walks the pages of ReadAll.
+package client
+
+import (
+	"context"
+	crand "crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"io"
+	"math/rand"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/radean0909/redeam-rest/pkg/api/v1"
+)
+
+const (
+	// apiVersion is the version of the API the client speaks
+	apiVersion = "v1"
+
+	// defaultPageSize is the page size of List when none is given
+	defaultPageSize = 100
+
+	// idempotencyKeyMetadata carries the key that lets the server run a retried call once
+	idempotencyKeyMetadata = "idempotency-key"
+
+	// SyncOverlap is how far ListUpdatedSince reaches back before since. The server stamps UpdatedAt
+	// with the start of the writing transaction, so a long import commits books stamped before the
+	// latest UpdatedAt a client already synced. Books within the overlap are listed again,
+	// ListChangedSince needs no overlap.
+	SyncOverlap = 5 * time.Minute
+)
+
+// Books is the API of Client. Code that depends on it rather than on Client can be tested against Fake.
+type Books interface {
+	Create(ctx context.Context, book *v1.Book) (int64, error)
+	Read(ctx context.Context, id int64) (*v1.Book, error)
+	Update(ctx context.Context, book *v1.Book) error
+	Delete(ctx context.Context, id int64) error
+	List(ctx context.Context, pageSize int32) *BookIterator
+	ListUpdatedSince(ctx context.Context, since time.Time, pageSize int32) *BookIterator
+	ListChangedSince(ctx context.Context, seq int64, pageSize int32) *BookIterator
+}
+
+type options struct {
+	token     string
+	apiKey    string
+	tls       *tls.Config
+	timeout   time.Duration
+	attempts  int
+	baseDelay time.Duration
+	maxDelay  time.Duration
+	dialOpts  []grpc.DialOption
+}
+
+// Option configures a Client
+type Option func(*options)
+
+// WithToken sends token as bearer token with every call
+func WithToken(token string) Option {
+	return func(o *options) {
+		o.token = token
+	}
+}
+
+// WithAPIKey sends key in the x-api-key metadata with every call
+func WithAPIKey(key string) Option {
+	return func(o *options) {
+		o.apiKey = key
+	}
+}
+
+// WithTLS connects over TLS with cfg, the connection is plaintext otherwise
+func WithTLS(cfg *tls.Config) Option {
+	return func(o *options) {
+		o.tls = cfg
+	}
+}
+
+// WithTimeout sets the deadline of calls whose context has none, retries included. Defaults to 5s, zero disables it.
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.timeout = d
+	}
+}
+
+// WithRetry makes up to attempts tries of a call while the server answers Unavailable, waiting a random
+// time up to base, doubled after every try but never more than max. Defaults to 4 attempts, 100ms and 2s.
+func WithRetry(attempts int, base, max time.Duration) Option {
+	return func(o *options) {
+		o.attempts, o.baseDelay, o.maxDelay = attempts, base, max
+	}
+}
+
+// WithDialOptions adds options to the connection made by New
+func WithDialOptions(opts ...grpc.DialOption) Option {
+	return func(o *options) {
+		o.dialOpts = append(o.dialOpts, opts...)
+	}
+}
+
+// Client calls the Book service
+type Client struct {
+	conn  *grpc.ClientConn // nil when the connection belongs to the caller
+	books v1.BookServiceClient
+	opts  options
+}
+
+var _ Books = (*Client)(nil)
+
+// New connects to the Book service at target, e.g. "localhost:9090". Close the client when done.
+func New(ctx context.Context, target string, opts ...Option) (*Client, error) {
+	o := newOptions(opts)
+
+	dialOpts := append([]grpc.DialOption{grpc.WithInsecure()}, o.dialOpts...)
+	if o.tls != nil {
+		dialOpts[0] = grpc.WithTransportCredentials(credentials.NewTLS(o.tls))
+	}
+	conn, err := grpc.DialContext(ctx, target, dialOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn, books: v1.NewBookServiceClient(conn), opts: o}, nil
+}
+
+// NewFromConn calls the Book service over conn, which stays open when the client is closed.
+// Dial options given to it are ignored.
+func NewFromConn(conn grpc.ClientConnInterface, opts ...Option) *Client {
+	return &Client{books: v1.NewBookServiceClient(conn), opts: newOptions(opts)}
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		timeout:   5 * time.Second,
+		attempts:  4,
+		baseDelay: 100 * time.Millisecond,
+		maxDelay:  2 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.attempts < 1 {
+		o.attempts = 1
+	}
+	return o
+}
+
+// Close closes the connection made by New
+func (c *Client) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.Close()
+}
+
+// Create stores book and returns the id it was given
+func (c *Client) Create(ctx context.Context, book *v1.Book) (int64, error) {
+	var res *v1.CreateResponse
+	err := c.idempotentCall(ctx, func(ctx context.Context) (err error) {
+		res, err = c.books.Create(ctx, &v1.CreateRequest{Api: apiVersion, Book: book})
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return res.Id, nil
+}
+
+// Read returns the book with id, a codes.NotFound error when there is none
+func (c *Client) Read(ctx context.Context, id int64) (*v1.Book, error) {
+	var res *v1.ReadResponse
+	err := c.call(ctx, func(ctx context.Context) (err error) {
+		res, err = c.books.Read(ctx, &v1.ReadRequest{Api: apiVersion, Id: id})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.Book, nil
+}
+
+// Update replaces every field of the book with the id of book
+func (c *Client) Update(ctx context.Context, book *v1.Book) error {
+	return c.idempotentCall(ctx, func(ctx context.Context) error {
+		_, err := c.books.Update(ctx, &v1.UpdateRequest{Api: apiVersion, Book: book})
+		return err
+	})
+}
+
+// Delete removes the book with id, a codes.NotFound error when there is none
+func (c *Client) Delete(ctx context.Context, id int64) error {
+	return c.idempotentCall(ctx, func(ctx context.Context) error {
+		_, err := c.books.Delete(ctx, &v1.DeleteRequest{Api: apiVersion, Id: id})
+		return err
+	})
+}
+
+// List walks all books by id, reading pageSize of them per call. A pageSize of zero reads 100 per call.
+// Every page is a call of its own, with its own deadline and retries.
+func (c *Client) List(ctx context.Context, pageSize int32) *BookIterator {
+	return c.list(ctx, nil, 0, pageSize)
+}
+
+// ListUpdatedSince walks the books created or updated at or after since, less SyncOverlap, by id,
+// like List. Syncing clients pass the latest UpdatedAt they hold and must expect books they already
+// have, deleted books are only reported by WatchBooks.
+func (c *Client) ListUpdatedSince(ctx context.Context, since time.Time, pageSize int32) *BookIterator {
+	ts, err := ptypes.TimestampProto(since.Add(-SyncOverlap))
+	if err != nil {
+		return newBookIterator(ctx, func(context.Context, string) (*v1.ReadAllResponse, error) {
+			return nil, status.Error(codes.InvalidArgument, "since is out of range: "+err.Error())
+		})
+	}
+	return c.list(ctx, ts, 0, pageSize)
+}
+
+// ListChangedSince walks the books created or updated after the change log sequence seq by id, like
+// List. Syncing clients pass the Sequence of their last listing, and that of this one next time.
+// Deleted books are only reported by WatchBooks. It fails with codes.OutOfRange when the changes
+// after seq were pruned, List then reads all books again.
+func (c *Client) ListChangedSince(ctx context.Context, seq int64, pageSize int32) *BookIterator {
+	return c.list(ctx, nil, seq, pageSize)
+}
+
+// list pages through ReadAll, filtered by updatedSince and changedSince when they are set
+func (c *Client) list(ctx context.Context, updatedSince *timestamp.Timestamp, changedSince int64, pageSize int32) *BookIterator {
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+	return newBookIterator(ctx, func(ctx context.Context, token string) (*v1.ReadAllResponse, error) {
+		var res *v1.ReadAllResponse
+		err := c.call(ctx, func(ctx context.Context) (err error) {
+			res, err = c.books.ReadAll(ctx, &v1.ReadAllRequest{Api: apiVersion, PageSize: pageSize, PageToken: token, UpdatedSince: updatedSince, ChangedSince: changedSince})
+			return err
+		})
+		return res, err
+	})
+}
+
+// ImportBooks sends books to the server in a single ImportBooks stream and returns its report, with
+// dryRun the server only validates them. The call is not retried, the server may have stored part
+// of the books before it failed.
+func (c *Client) ImportBooks(ctx context.Context, books []*v1.Book, dryRun bool) (*v1.ImportBooksResponse, error) {
+	ctx, cancel := c.outgoing(ctx)
+	defer cancel()
+
+	stream, err := c.books.ImportBooks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range books {
+		if err := stream.Send(&v1.ImportBooksRequest{Api: apiVersion, Book: b, DryRun: dryRun}); err != nil {
+			if err == io.EOF {
+				// the server ended the call, CloseAndRecv returns why
+				break
+			}
+			return nil, err
+		}
+	}
+	return stream.CloseAndRecv()
+}
+
+// idempotentCall runs rpc like call, sending the same idempotency key with every attempt so a retry
+// of a call whose response was lost doesn't change books twice. A key set by the caller is kept.
+func (c *Client) idempotentCall(ctx context.Context, rpc func(context.Context) error) error {
+	if md, _ := metadata.FromOutgoingContext(ctx); len(md.Get(idempotencyKeyMetadata)) == 0 {
+		b := make([]byte, 16)
+		if _, err := crand.Read(b); err != nil {
+			return status.Error(codes.Internal, "failed to generate idempotency key: "+err.Error())
+		}
+		ctx = metadata.AppendToOutgoingContext(ctx, idempotencyKeyMetadata, hex.EncodeToString(b))
+	}
+	return c.call(ctx, rpc)
+}
+
+// call runs rpc with the credentials and deadline of the client, trying again while the server is unavailable
+func (c *Client) call(ctx context.Context, rpc func(context.Context) error) error {
+	ctx, cancel := c.outgoing(ctx)
+	defer cancel()
+
+	delay := c.opts.baseDelay
+	for attempt := 1; ; attempt++ {
+		err := rpc(ctx)
+		if status.Code(err) != codes.Unavailable || attempt == c.opts.attempts {
+			return err
+		}
+
+		// full jitter spreads the retries of many clients after an outage
+		t := time.NewTimer(time.Duration(rand.Int63n(int64(delay) + 1)))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+		if delay *= 2; delay > c.opts.maxDelay {
+			delay = c.opts.maxDelay
+		}
+	}
+}
+
+// outgoing adds the deadline of the client to ctx when it has none, and the credentials of the client
+func (c *Client) outgoing(ctx context.Context) (context.Context, context.CancelFunc) {
+	cancel := func() {}
+	if _, ok := ctx.Deadline(); !ok && c.opts.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, c.opts.timeout)
+	}
+	if c.opts.token != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+c.opts.token)
+	}
+	if c.opts.apiKey != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "x-api-key", c.opts.apiKey)
+	}
+	return ctx, cancel
+}
@@ -0,0 +1,334 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/radean0909/redeam-rest/pkg/api/v1"
+)
+
+// server answers Read with Unavailable for the first failures calls and pages ReadAll over books,
+// the id of a book is the sequence of its last change
+type server struct {
+	v1.UnimplementedBookServiceServer
+
+	mu       sync.Mutex
+	failures int
+	calls    int
+	auth     string
+	keys     []string // idempotency key of every Create
+	books    []*v1.Book
+}
+
+func (s *server) Create(ctx context.Context, req *v1.CreateRequest) (*v1.CreateResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	md, _ := metadata.FromIncomingContext(ctx)
+	s.keys = append(s.keys, md.Get(idempotencyKeyMetadata)...)
+	if s.calls <= s.failures {
+		return nil, status.Error(codes.Unavailable, "try again")
+	}
+	return &v1.CreateResponse{Api: apiVersion, Id: int64(s.calls)}, nil
+}
+
+func (s *server) Read(ctx context.Context, req *v1.ReadRequest) (*v1.ReadResponse, error) {
+	s.mu.Lock()
+	s.calls++
+	md, _ := metadata.FromIncomingContext(ctx)
+	if vals := md.Get("authorization"); len(vals) > 0 {
+		s.auth = vals[0]
+	}
+	fail := s.calls <= s.failures
+	s.mu.Unlock()
+
+	if req.Api != apiVersion {
+		return nil, status.Error(codes.Unimplemented, "unsupported API version")
+	}
+	if fail {
+		return nil, status.Error(codes.Unavailable, "try again")
+	}
+	// id 0 never answers, the client deadline ends the call
+	if req.Id == 0 {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return &v1.ReadResponse{Api: apiVersion, Book: &v1.Book{Id: req.Id}}, nil
+}
+
+func (s *server) ReadAll(ctx context.Context, req *v1.ReadAllRequest) (*v1.ReadAllResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	if s.calls <= s.failures {
+		return nil, status.Error(codes.Unavailable, "try again")
+	}
+
+	books := s.books
+	if req.UpdatedSince != nil {
+		books = nil
+		for _, b := range s.books {
+			if b.UpdatedAt.GetSeconds() >= req.UpdatedSince.Seconds {
+				books = append(books, b)
+			}
+		}
+	}
+	if req.ChangedSince > 0 {
+		books = nil
+		for _, b := range s.books {
+			if b.Id > req.ChangedSince {
+				books = append(books, b)
+			}
+		}
+	}
+
+	start := 0
+	if req.PageToken != "" {
+		start, _ = strconv.Atoi(req.PageToken)
+	}
+	end := start + int(req.PageSize)
+	res := &v1.ReadAllResponse{Api: apiVersion, Sequence: int64(len(s.books))}
+	if end < len(books) {
+		res.NextPageToken = strconv.Itoa(end)
+	} else {
+		end = len(books)
+	}
+	res.Books = books[start:end]
+	return res, nil
+}
+
+func (s *server) ImportBooks(stream v1.BookService_ImportBooksServer) error {
+	s.mu.Lock()
+	s.calls++
+	fail := s.calls <= s.failures
+	s.mu.Unlock()
+	if fail {
+		return status.Error(codes.Unavailable, "try again")
+	}
+
+	md, _ := metadata.FromIncomingContext(stream.Context())
+	res := &v1.ImportBooksResponse{Api: apiVersion}
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			s.mu.Lock()
+			s.auth = strings.Join(md.Get("authorization"), ",")
+			s.mu.Unlock()
+			return stream.SendAndClose(res)
+		}
+		if err != nil {
+			return err
+		}
+		res.Received++
+		if !req.DryRun {
+			res.Imported++
+		}
+	}
+}
+
+// seen returns the number of calls and the last authorization metadata
+func (s *server) seen() (int, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls, s.auth
+}
+
+func start(t *testing.T, s *server, opts ...Option) *Client {
+	srv := grpc.NewServer()
+	v1.RegisterBookServiceServer(srv, s)
+	lis := bufconn.Listen(1 << 20)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	opts = append([]Option{
+		WithRetry(3, time.Millisecond, 2*time.Millisecond),
+		WithDialOptions(grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) })),
+	}, opts...)
+	c, err := New(context.Background(), "bufnet", opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestClient_Read(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  int
+		id        int64
+		want      codes.Code
+		wantCalls int
+	}{
+		{"first try", 0, 1, codes.OK, 1},
+		{"after retries", 2, 1, codes.OK, 3},
+		{"out of attempts", 3, 1, codes.Unavailable, 3},
+		{"deadline", 0, 0, codes.DeadlineExceeded, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &server{failures: tt.failures}
+			c := start(t, s, WithToken("abc"), WithTimeout(50*time.Millisecond))
+
+			book, err := c.Read(context.Background(), tt.id)
+			if status.Code(err) != tt.want {
+				t.Fatalf("Read() error = %v, want %v", err, tt.want)
+			}
+			if err == nil && book.Id != tt.id {
+				t.Errorf("Read() = %v, want id %d", book, tt.id)
+			}
+			calls, auth := s.seen()
+			if calls != tt.wantCalls {
+				t.Errorf("%d calls, want %d", calls, tt.wantCalls)
+			}
+			if auth != "Bearer abc" {
+				t.Errorf("authorization = %q, want Bearer abc", auth)
+			}
+		})
+	}
+}
+
+func TestClient_CreateIdempotencyKey(t *testing.T) {
+	s := &server{failures: 2}
+	c := start(t, s)
+	ctx := context.Background()
+
+	if _, err := c.Create(ctx, &v1.Book{Title: "title"}); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if len(s.keys) != 3 || s.keys[0] == "" || s.keys[1] != s.keys[0] || s.keys[2] != s.keys[0] {
+		t.Fatalf("keys = %q, want one key for the call and its retries", s.keys)
+	}
+
+	if _, err := c.Create(ctx, &v1.Book{Title: "title"}); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if len(s.keys) != 4 || s.keys[3] == s.keys[0] {
+		t.Errorf("keys = %q, want a new key for the next call", s.keys)
+	}
+
+	// a key of the caller wins
+	ctx = metadata.AppendToOutgoingContext(ctx, idempotencyKeyMetadata, "mine")
+	if _, err := c.Create(ctx, &v1.Book{Title: "title"}); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if len(s.keys) != 5 || s.keys[4] != "mine" {
+		t.Errorf("keys = %q, want the key of the caller", s.keys)
+	}
+}
+
+func TestClient_List(t *testing.T) {
+	s := &server{failures: 1}
+	for id := int64(1); id <= 5; id++ {
+		s.books = append(s.books, &v1.Book{Id: id})
+	}
+	c := start(t, s)
+
+	books, err := c.List(context.Background(), 2).All()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(books) != 5 || books[0].Id != 1 || books[4].Id != 5 {
+		t.Errorf("List() = %v, want books 1 to 5", books)
+	}
+	// a failed try and three pages
+	if calls, _ := s.seen(); calls != 4 {
+		t.Errorf("%d calls, want 4", calls)
+	}
+}
+
+func TestClient_ListUpdatedSince(t *testing.T) {
+	s := &server{}
+	for id := int64(1); id <= 5; id++ {
+		s.books = append(s.books, &v1.Book{Id: id, UpdatedAt: &timestamp.Timestamp{Seconds: id * 60}})
+	}
+	c := start(t, s)
+
+	books, err := c.ListUpdatedSince(context.Background(), time.Unix(180, 0).Add(SyncOverlap), 2).All()
+	if err != nil {
+		t.Fatalf("ListUpdatedSince() error = %v", err)
+	}
+	if len(books) != 3 || books[0].Id != 3 || books[2].Id != 5 {
+		t.Errorf("ListUpdatedSince() = %v, want books 3 to 5", books)
+	}
+}
+
+func TestClient_ListChangedSince(t *testing.T) {
+	s := &server{}
+	for id := int64(1); id <= 5; id++ {
+		s.books = append(s.books, &v1.Book{Id: id})
+	}
+	c := start(t, s)
+
+	it := c.ListChangedSince(context.Background(), 3, 1)
+	books, err := it.All()
+	if err != nil {
+		t.Fatalf("ListChangedSince() error = %v", err)
+	}
+	if len(books) != 2 || books[0].Id != 4 || books[1].Id != 5 {
+		t.Errorf("ListChangedSince() = %v, want books 4 and 5", books)
+	}
+	if it.Sequence() != 5 {
+		t.Errorf("Sequence() = %d, want 5", it.Sequence())
+	}
+}
+
+func TestClient_ListError(t *testing.T) {
+	c := start(t, &server{failures: 10})
+
+	it := c.List(context.Background(), 2)
+	if it.Next() {
+		t.Fatalf("Next() = true, want false")
+	}
+	if status.Code(it.Err()) != codes.Unavailable {
+		t.Errorf("Err() = %v, want Unavailable", it.Err())
+	}
+}
+
+func TestClient_ImportBooks(t *testing.T) {
+	s := &server{}
+	c := start(t, s, WithToken("abc"))
+	books := []*v1.Book{{Title: "The Hobbit"}, {Title: "The Silmarillion"}}
+
+	res, err := c.ImportBooks(context.Background(), books, false)
+	if err != nil {
+		t.Fatalf("ImportBooks() error = %v", err)
+	}
+	if res.Received != 2 || res.Imported != 2 {
+		t.Errorf("ImportBooks() = %v, want 2 received and imported", res)
+	}
+	if _, auth := s.seen(); auth != "Bearer abc" {
+		t.Errorf("authorization = %q, want Bearer abc", auth)
+	}
+
+	res, err = c.ImportBooks(context.Background(), books, true)
+	if err != nil || res.Received != 2 || res.Imported != 0 {
+		t.Errorf("ImportBooks(dry run) = %v, %v, want 2 received and none imported", res, err)
+	}
+}
+
+func TestClient_ImportBooksNoRetry(t *testing.T) {
+	s := &server{failures: 1}
+	c := start(t, s)
+
+	_, err := c.ImportBooks(context.Background(), []*v1.Book{{Title: "The Hobbit"}}, false)
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("ImportBooks() error = %v, want Unavailable", err)
+	}
+	if calls, _ := s.seen(); calls != 1 {
+		t.Errorf("%d calls, want 1", calls)
+	}
+}
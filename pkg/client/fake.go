@@ -0,0 +1,194 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/radean0909/redeam-rest/pkg/api/v1"
+)
+
+// Fake keeps books in memory, for tests of code using Books. It answers with the status
+// codes of the service, e.g. codes.NotFound for unknown ids, and sets CreatedAt and UpdatedAt
+// like it does. Every write is a change of its own in the change log sequence.
+type Fake struct {
+	// Err, when set, is returned by every call instead of doing it
+	Err error
+	// Now is the time of changes, defaults to time.Now
+	Now func() time.Time
+
+	mu      sync.Mutex
+	books   map[int64]*v1.Book
+	next    int64
+	seq     int64
+	changed map[int64]int64 // sequence of the last change of each book
+}
+
+var _ Books = (*Fake)(nil)
+
+// NewFake holds books, those without an id get the next free one
+func NewFake(books ...*v1.Book) *Fake {
+	f := &Fake{books: make(map[int64]*v1.Book), changed: make(map[int64]int64)}
+	for _, b := range books {
+		b = proto.Clone(b).(*v1.Book)
+		if b.Id == 0 {
+			b.Id = f.next + 1
+		}
+		if b.Id > f.next {
+			f.next = b.Id
+		}
+		f.books[b.Id] = b
+		f.change(b.Id)
+	}
+	return f
+}
+
+// Create stores a copy of book under the next free id
+func (f *Fake) Create(ctx context.Context, book *v1.Book) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return 0, f.Err
+	}
+
+	f.next++
+	b := proto.Clone(book).(*v1.Book)
+	b.Id = f.next
+	b.CreatedAt = f.now()
+	b.UpdatedAt = b.CreatedAt
+	f.books[b.Id] = b
+	f.change(b.Id)
+	return b.Id, nil
+}
+
+// Read returns a copy of the book with id
+func (f *Fake) Read(ctx context.Context, id int64) (*v1.Book, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return nil, f.Err
+	}
+
+	b, ok := f.books[id]
+	if !ok {
+		return nil, status.Error(codes.NotFound, fmt.Sprintf("cannot find Id='%d'", id))
+	}
+	return proto.Clone(b).(*v1.Book), nil
+}
+
+// Update replaces the stored book with a copy of book
+func (f *Fake) Update(ctx context.Context, book *v1.Book) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return f.Err
+	}
+
+	old, ok := f.books[book.Id]
+	if !ok {
+		return status.Error(codes.NotFound, fmt.Sprintf("Id='%d' is not found", book.Id))
+	}
+	b := proto.Clone(book).(*v1.Book)
+	b.CreatedAt, b.CreatedBy = old.CreatedAt, old.CreatedBy
+	b.UpdatedAt = f.now()
+	f.books[book.Id] = b
+	f.change(book.Id)
+	return nil
+}
+
+// Delete removes the book with id
+func (f *Fake) Delete(ctx context.Context, id int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return f.Err
+	}
+
+	if _, ok := f.books[id]; !ok {
+		return status.Error(codes.NotFound, fmt.Sprintf("Id='%d' is not found", id))
+	}
+	delete(f.books, id)
+	delete(f.changed, id)
+	f.seq++
+	return nil
+}
+
+// List walks copies of the books by id, pageSize of them per page like Client does
+func (f *Fake) List(ctx context.Context, pageSize int32) *BookIterator {
+	return f.list(ctx, time.Time{}, 0, pageSize)
+}
+
+// ListUpdatedSince walks copies of the books updated at or after since by id. Writes to Fake are
+// visible at once, so it doesn't reach back by SyncOverlap.
+func (f *Fake) ListUpdatedSince(ctx context.Context, since time.Time, pageSize int32) *BookIterator {
+	return f.list(ctx, since, 0, pageSize)
+}
+
+// ListChangedSince walks copies of the books created or updated after the change sequence seq by id.
+// Fake keeps every change, it never fails with codes.OutOfRange.
+func (f *Fake) ListChangedSince(ctx context.Context, seq int64, pageSize int32) *BookIterator {
+	return f.list(ctx, time.Time{}, seq, pageSize)
+}
+
+func (f *Fake) list(ctx context.Context, since time.Time, changedSince int64, pageSize int32) *BookIterator {
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+	return newBookIterator(ctx, func(ctx context.Context, token string) (*v1.ReadAllResponse, error) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if f.Err != nil {
+			return nil, f.Err
+		}
+		if changedSince < 0 {
+			return nil, status.Error(codes.InvalidArgument, "changed_since must not be negative")
+		}
+
+		var after int64
+		if token != "" {
+			after, _ = strconv.ParseInt(token, 10, 64)
+		}
+		ids := make([]int64, 0, len(f.books))
+		for id, b := range f.books {
+			if updated, _ := ptypes.Timestamp(b.UpdatedAt); id > after && !updated.Before(since) && f.changed[id] > changedSince {
+				ids = append(ids, id)
+			}
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+		res := &v1.ReadAllResponse{Api: apiVersion, Sequence: f.seq}
+		if len(ids) > int(pageSize) {
+			ids = ids[:pageSize]
+			res.NextPageToken = strconv.FormatInt(ids[len(ids)-1], 10)
+		}
+		res.Books = make([]*v1.Book, len(ids))
+		for i, id := range ids {
+			res.Books[i] = proto.Clone(f.books[id]).(*v1.Book)
+		}
+		return res, nil
+	})
+}
+
+// change records a change of the book with id
+func (f *Fake) change(id int64) {
+	f.seq++
+	f.changed[id] = f.seq
+}
+
+func (f *Fake) now() *timestamp.Timestamp {
+	now := time.Now
+	if f.Now != nil {
+		now = f.Now
+	}
+	ts, _ := ptypes.TimestampProto(now())
+	return ts
+}
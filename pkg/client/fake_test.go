@@ -0,0 +1,125 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/radean0909/redeam-rest/pkg/api/v1"
+)
+
+func TestFake(t *testing.T) {
+	ctx := context.Background()
+	f := NewFake(&v1.Book{Title: "title1"}, &v1.Book{Id: 5, Title: "title5"})
+
+	id, err := f.Create(ctx, &v1.Book{Title: "title6"})
+	if err != nil || id != 6 {
+		t.Fatalf("Create() = %d, %v, want 6", id, err)
+	}
+
+	book, err := f.Read(ctx, 1)
+	if err != nil || book.Title != "title1" {
+		t.Fatalf("Read(1) = %v, %v, want title1", book, err)
+	}
+	// callers get copies
+	book.Title = "changed"
+	if b, _ := f.Read(ctx, 1); b.Title != "title1" {
+		t.Errorf("Read(1) after changing the returned book = %v, want title1", b)
+	}
+
+	if err := f.Update(ctx, &v1.Book{Id: 5, Title: "updated"}); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if err := f.Delete(ctx, 1); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := f.Read(ctx, 1); status.Code(err) != codes.NotFound {
+		t.Errorf("Read() of a deleted book error = %v, want NotFound", err)
+	}
+	if err := f.Update(ctx, &v1.Book{Id: 1}); status.Code(err) != codes.NotFound {
+		t.Errorf("Update() of a deleted book error = %v, want NotFound", err)
+	}
+
+	books, err := f.List(ctx, 1).All()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(books) != 2 || books[0].Title != "updated" || books[1].Id != 6 {
+		t.Errorf("List() = %v, want books 5 and 6", books)
+	}
+
+	f.Err = errors.New("boom")
+	if _, err := f.Read(ctx, 5); err != f.Err {
+		t.Errorf("Read() error = %v, want %v", err, f.Err)
+	}
+	if _, err := f.List(ctx, 1).All(); err != f.Err {
+		t.Errorf("List() error = %v, want %v", err, f.Err)
+	}
+}
+
+func TestFake_ListUpdatedSince(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := NewFake()
+	f.Now = func() time.Time { return now }
+
+	f.Create(ctx, &v1.Book{Title: "title1"})
+	f.Create(ctx, &v1.Book{Title: "title2"})
+	now = now.Add(time.Minute)
+	if err := f.Update(ctx, &v1.Book{Id: 1, Title: "updated"}); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	books, err := f.ListUpdatedSince(ctx, now, 10).All()
+	if err != nil {
+		t.Fatalf("ListUpdatedSince() error = %v", err)
+	}
+	if len(books) != 1 || books[0].Id != 1 {
+		t.Fatalf("ListUpdatedSince() = %v, want book 1", books)
+	}
+	created, _ := ptypes.Timestamp(books[0].CreatedAt)
+	if want := now.Add(-time.Minute); !created.Equal(want) {
+		t.Errorf("CreatedAt = %v after the update, want %v", created, want)
+	}
+}
+
+func TestFake_ListChangedSince(t *testing.T) {
+	ctx := context.Background()
+	f := NewFake(&v1.Book{Title: "title1"}, &v1.Book{Title: "title2"}, &v1.Book{Title: "title3"})
+
+	it := f.List(ctx, 2)
+	if !it.Next() {
+		t.Fatalf("List() error = %v, want books", it.Err())
+	}
+	seq := it.Sequence()
+	// a change while listing comes again in the next sync, the listing keeps its first sequence
+	if err := f.Update(ctx, &v1.Book{Id: 1, Title: "updated"}); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if _, err := it.All(); err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if it.Sequence() != seq {
+		t.Errorf("Sequence() = %d after the last page, want %d of the first", it.Sequence(), seq)
+	}
+
+	it = f.ListChangedSince(ctx, seq, 10)
+	books, err := it.All()
+	if err != nil {
+		t.Fatalf("ListChangedSince() error = %v", err)
+	}
+	if len(books) != 1 || books[0].Title != "updated" {
+		t.Errorf("ListChangedSince() = %v, want the updated book", books)
+	}
+	if it.Sequence() <= seq {
+		t.Errorf("Sequence() = %d, want after %d", it.Sequence(), seq)
+	}
+	if _, err := f.ListChangedSince(ctx, -1, 10).All(); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("ListChangedSince(-1) error = %v, want InvalidArgument", err)
+	}
+}
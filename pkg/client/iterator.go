@@ -0,0 +1,84 @@
+package client
+
+import (
+	"context"
+
+	"github.com/radean0909/redeam-rest/pkg/api/v1"
+)
+
+// pageFunc reads the page with token, its books, the token of the next page and the sequence of the list
+type pageFunc func(ctx context.Context, token string) (*v1.ReadAllResponse, error)
+
+// BookIterator walks books page by page:
+//
+//	it := c.List(ctx, 50)
+//	for it.Next() {
+//		book := it.Book()
+//	}
+//	if err := it.Err(); err != nil {
+//		return err
+//	}
+type BookIterator struct {
+	ctx   context.Context
+	fetch pageFunc
+
+	page  []*v1.Book
+	token string
+	seq   int64
+	read  bool // the first page was read
+	last  bool // the current page is the last one
+	book  *v1.Book
+	err   error
+}
+
+func newBookIterator(ctx context.Context, fetch pageFunc) *BookIterator {
+	return &BookIterator{ctx: ctx, fetch: fetch}
+}
+
+// Next advances to the next book, reading the next page when needed. It returns false when
+// there are no more books or reading a page failed, see Err.
+func (it *BookIterator) Next() bool {
+	for len(it.page) == 0 {
+		if it.last || it.err != nil {
+			it.book = nil
+			return false
+		}
+		var res *v1.ReadAllResponse
+		if res, it.err = it.fetch(it.ctx, it.token); it.err != nil {
+			continue
+		}
+		if !it.read {
+			it.seq, it.read = res.Sequence, true
+		}
+		it.page, it.token = res.Books, res.NextPageToken
+		it.last = it.token == ""
+	}
+	it.book, it.page = it.page[0], it.page[1:]
+	return true
+}
+
+// Book returns the current book
+func (it *BookIterator) Book() *v1.Book {
+	return it.book
+}
+
+// Sequence returns the position in the change log the books were listed at, once the first page
+// is read. ListChangedSince with it walks the books changed after the listing, WatchBooks with it
+// streams those changes.
+func (it *BookIterator) Sequence() int64 {
+	return it.seq
+}
+
+// Err returns the error that stopped the iteration, if any
+func (it *BookIterator) Err() error {
+	return it.err
+}
+
+// All reads the remaining books into a slice
+func (it *BookIterator) All() ([]*v1.Book, error) {
+	var books []*v1.Book
+	for it.Next() {
+		books = append(books, it.Book())
+	}
+	return books, it.Err()
+}
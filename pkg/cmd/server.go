@@ -1,40 +1,447 @@
 package cmd
 
 import (
+	"compress/gzip"
 	"context"
+	"crypto/x509"
 	"database/sql"
+	"flag"
 	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"syscall"
+	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 
-	"github.com/radean0909/redeam-rest/pkg/protocol/grpc"
+	api "github.com/radean0909/redeam-rest/pkg/api/v1"
+	"github.com/radean0909/redeam-rest/pkg/auth"
+	"github.com/radean0909/redeam-rest/pkg/cache"
+	"github.com/radean0909/redeam-rest/pkg/certs"
+	"github.com/radean0909/redeam-rest/pkg/health"
+	"github.com/radean0909/redeam-rest/pkg/lifecycle"
+	"github.com/radean0909/redeam-rest/pkg/logger"
+	grpcserver "github.com/radean0909/redeam-rest/pkg/protocol/grpc"
+	"github.com/radean0909/redeam-rest/pkg/protocol/grpc/middleware"
 	"github.com/radean0909/redeam-rest/pkg/protocol/rest"
+	"github.com/radean0909/redeam-rest/pkg/ratelimit"
 	"github.com/radean0909/redeam-rest/pkg/service/v1"
+	"github.com/radean0909/redeam-rest/pkg/tracing"
 )
 
+// Config is configuration for Server
+type Config struct {
+	// gRPC server start parameters section
+	// GRPCPort is TCP port to listen by gRPC server
+	GRPCPort string
+
+	// HTTP/REST gateway start parameters section
+	// HTTPPort is TCP port to listen by HTTP/REST gateway
+	HTTPPort string
+	// SinglePort serves gRPC on HTTPPort as well, GRPCPort is unused then
+	SinglePort bool
+
+	// Authentication parameters section
+	// JWTSecret is the shared secret of HS256 tokens
+	JWTSecret string
+	// JWKSFile is a JSON Web Key Set with the public keys of RS256 tokens
+	JWKSFile string
+	// JWTIssuer and JWTAudience, when set, must match the iss and aud claims of tokens
+	JWTIssuer   string
+	JWTAudience string
+	// PolicyFile is a YAML file with the gRPC methods each role may call, see configs/policy.yaml
+	PolicyFile string
+	// RateLimitFile is a YAML file with the calls per second each client may make, see configs/ratelimit.yaml
+	RateLimitFile string
+
+	// TLS parameters section
+	// TLSCert and TLSKey are the PEM key pair of the gRPC server and HTTPS gateway, reloaded when they change
+	TLSCert string
+	TLSKey  string
+	// TLSClientCA is a CA bundle, when set clients must present a certificate it signed (mTLS)
+	TLSClientCA string
+	// TLSClientCert and TLSClientKey are the PEM key pair the gateway presents to the gRPC server under
+	// mTLS. Without them it presents TLSCert, which then needs the clientAuth extended key usage too.
+	TLSClientCert string
+	TLSClientKey  string
+	// TLSCA is the CA bundle the gateway verifies the gRPC server with, defaults to the system roots
+	TLSCA string
+	// TLSServerName is the name the gateway expects in the gRPC server certificate
+	TLSServerName string
+
+	// GRPCWebOrigins are the comma separated origins browsers may call grpc-web from, * for any
+	GRPCWebOrigins string
+
+	// Gateway middleware section
+	// CORSOrigins, CORSMethods and CORSHeaders are comma separated, no origins disables CORS
+	CORSOrigins string
+	CORSMethods string
+	CORSHeaders string
+	// CORSCredentials lets browsers send cookies and client certificates cross-origin
+	CORSCredentials bool
+	// CORSMaxAge is how long browsers may cache a preflight answer
+	CORSMaxAge time.Duration
+	// GzipLevel is the compress/gzip level of gateway responses, 0 disables compression
+	GzipLevel int
+	// MaxBodyBytes bounds gateway request bodies, 0 disables the limit
+	MaxBodyBytes int64
+
+	// Cache parameters section
+	// CacheSize is how many Read and ReadAll responses are kept in memory, 0 disables the cache
+	CacheSize int
+	// CacheTTL is how long a cached response is served, changes made through other replicas show after it
+	CacheTTL time.Duration
+
+	// ChangeRetention is how long the Book change log keeps changes for WatchBooks, 0 keeps them all
+	ChangeRetention time.Duration
+	// IdempotencyWindow is how long responses to calls with an Idempotency-Key are replayed, 0 disables it
+	IdempotencyWindow time.Duration
+
+	// Database parameters section
+	// DBSSLMode is the libpq sslmode: disable, require, verify-ca or verify-full
+	DBSSLMode string
+	// DBSSLRootCert is the CA bundle the database certificate is verified with
+	DBSSLRootCert string
+	// DBSSLCert and DBSSLKey are the client key pair presented to the database
+	DBSSLCert string
+	DBSSLKey  string
+
+	// Tracing parameters section
+	// TraceExporter is where spans are sent: none, otlp, stdout or file
+	TraceExporter string
+	// TraceFile is the file spans are appended to by the file exporter
+	TraceFile string
+
+	// Log parameters section
+	// LogLevel is the minimum level logged: debug, info, warn or error
+	LogLevel string
+
+	// Deadline parameters section
+	// CallTimeout bounds unary calls whose method has no entry in MethodTimeouts, 0 leaves them unbounded
+	CallTimeout time.Duration
+	// MethodTimeouts are comma separated method=duration pairs, streams are only bounded when listed
+	MethodTimeouts string
+
+	// Shutdown parameters section
+	// ShutdownTimeout bounds draining the HTTP gateway, and then the gRPC server, on SIGINT or SIGTERM
+	ShutdownTimeout time.Duration
+}
+
+const (
+	// certReloadInterval is how often the TLS files are checked for changes
+	certReloadInterval = 30 * time.Second
+
+	// defaultMethodTimeouts give the calls reading or writing the whole library more time
+	defaultMethodTimeouts = "/v1.BookService/ReadAll=10s,/v1.BookService/ExportMarc=2m,/v1.BookService/ImportMarc=2m"
+)
+
+// idempotentMethods replay their response to calls retried with the same Idempotency-Key. Issuing and
+// rotating API keys are left out, replaying them would mean storing the secrets.
+var idempotentMethods = []string{
+	"/v1.BookService/Create",
+	"/v1.BookService/BatchCreate",
+	"/v1.BookService/Update",
+	"/v1.BookService/Delete",
+}
+
 // RunServer runs gRPC server and HTTP gateway
 func RunServer() error {
-	ctx := context.Background()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// get configuration
+	var cfg Config
+	flag.StringVar(&cfg.GRPCPort, "grpc-port", "9090", "gRPC port to bind")
+	flag.StringVar(&cfg.HTTPPort, "http-port", "8080", "HTTP port to bind")
+	flag.BoolVar(&cfg.SinglePort, "single-port", false, "serve gRPC on -http-port next to the REST gateway, which then calls it in-process")
+	flag.StringVar(&cfg.JWTSecret, "jwt-secret", os.Getenv("JWT_SECRET"), "shared secret of HS256 bearer tokens, defaults to $JWT_SECRET")
+	flag.StringVar(&cfg.JWKSFile, "jwks-file", "", "JWKS file with the public keys of RS256 bearer tokens")
+	flag.StringVar(&cfg.JWTIssuer, "jwt-issuer", "", "iss claim bearer tokens must carry, any when empty")
+	flag.StringVar(&cfg.JWTAudience, "jwt-audience", "", "audience the aud claim of bearer tokens must name, any when empty")
+	flag.StringVar(&cfg.PolicyFile, "policy-file", "", "YAML file with the methods each role may call, requires authentication")
+	flag.StringVar(&cfg.RateLimitFile, "rate-limit-file", "", "YAML file with the calls per second each client may make per method")
+	flag.StringVar(&cfg.TLSCert, "tls-cert", "", "PEM certificate of the gRPC server and HTTPS gateway, enables TLS")
+	flag.StringVar(&cfg.TLSKey, "tls-key", "", "PEM private key of -tls-cert")
+	flag.StringVar(&cfg.TLSClientCA, "tls-client-ca", "", "PEM CA bundle that must have signed client certificates, enables mTLS")
+	flag.StringVar(&cfg.TLSClientCert, "tls-client-cert", "", "PEM certificate the gateway presents to the gRPC server under mTLS, defaults to -tls-cert, which then needs both the serverAuth and clientAuth extended key usages")
+	flag.StringVar(&cfg.TLSClientKey, "tls-client-key", "", "PEM private key of -tls-client-cert")
+	flag.StringVar(&cfg.TLSCA, "tls-ca", "", "PEM CA bundle the gateway verifies the gRPC server with, defaults to the system roots")
+	flag.StringVar(&cfg.TLSServerName, "tls-server-name", "localhost", "name the gateway expects in the gRPC server certificate")
+	flag.StringVar(&cfg.GRPCWebOrigins, "grpc-web-origins", "", "comma separated origins allowed to make cross-origin grpc-web calls, * for any")
+	flag.StringVar(&cfg.CORSOrigins, "cors-origins", "", "comma separated origins browser apps may call the REST gateway from, * for any, enables CORS")
+	flag.StringVar(&cfg.CORSMethods, "cors-methods", "", "comma separated methods allowed cross-origin, defaults to GET,POST,PUT,PATCH,DELETE")
+	flag.StringVar(&cfg.CORSHeaders, "cors-headers", "", "comma separated request headers allowed cross-origin, defaults to Content-Type,Authorization,X-Api-Key,X-Request-Id,Idempotency-Key")
+	flag.BoolVar(&cfg.CORSCredentials, "cors-credentials", false, "let browsers send cookies and client certificates cross-origin")
+	flag.DurationVar(&cfg.CORSMaxAge, "cors-max-age", 10*time.Minute, "how long browsers may cache a CORS preflight answer")
+	flag.IntVar(&cfg.GzipLevel, "gzip-level", gzip.DefaultCompression, "gzip level of REST responses, 1 (fastest) to 9 (smallest), -1 for the default, 0 disables compression")
+	flag.Int64Var(&cfg.MaxBodyBytes, "max-body-bytes", 32<<20, "largest REST request body accepted, 0 for no limit")
+	flag.IntVar(&cfg.CacheSize, "cache-size", 0, "Read and ReadAll responses kept in memory, 0 disables the cache")
+	flag.DurationVar(&cfg.CacheTTL, "cache-ttl", 30*time.Second, "how long a cached response is served, bounds staleness across replicas")
+	flag.DurationVar(&cfg.ChangeRetention, "change-retention", 7*24*time.Hour, "how long Book changes are kept for WatchBooks to resume from, 0 keeps them all")
+	flag.DurationVar(&cfg.IdempotencyWindow, "idempotency-window", 24*time.Hour, "how long responses to calls with an Idempotency-Key are replayed to retries, 0 disables it")
+	flag.StringVar(&cfg.DBSSLMode, "db-sslmode", "disable", "libpq sslmode of the database connection")
+	flag.StringVar(&cfg.DBSSLRootCert, "db-sslrootcert", "", "PEM CA bundle the database certificate is verified with")
+	flag.StringVar(&cfg.DBSSLCert, "db-sslcert", "", "PEM client certificate presented to the database")
+	flag.StringVar(&cfg.DBSSLKey, "db-sslkey", "", "PEM private key of -db-sslcert")
+	flag.StringVar(&cfg.TraceExporter, "trace-exporter", tracing.ExporterNone, "where to send trace spans: none, otlp (see OTEL_EXPORTER_OTLP_ENDPOINT), stdout or file")
+	flag.StringVar(&cfg.TraceFile, "trace-file", "traces.json", "file the file trace exporter appends spans to")
+	flag.StringVar(&cfg.LogLevel, "log-level", "info", "minimum level logged: debug, info, warn or error")
+	flag.DurationVar(&cfg.CallTimeout, "call-timeout", 30*time.Second, "longest a unary gRPC call may run on the server, 0 for no limit")
+	flag.StringVar(&cfg.MethodTimeouts, "method-timeouts", defaultMethodTimeouts, "comma separated method=duration deadlines overriding -call-timeout, streams are only bounded when listed")
+	flag.DurationVar(&cfg.ShutdownTimeout, "shutdown-timeout", 15*time.Second, "time the HTTP gateway and then the gRPC server each get to drain in-flight requests on SIGINT or SIGTERM before they are cut off")
+	flag.Parse()
+
+	// JSON lines on stderr, the standard log package is routed to it as well
+	l, err := logger.New(os.Stderr, cfg.LogLevel)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(l)
+
+	shutdownTracing, err := tracing.Init(ctx, "redeam-rest", cfg.TraceExporter, cfg.TraceFile)
+	if err != nil {
+		return fmt.Errorf("failed to configure tracing: %v", err)
+	}
+	defer shutdownTracing(context.Background())
 
 	dsn := fmt.Sprintf("host=%s port=%d user=%s "+
-		"password=%s dbname=%s sslmode=disable",
+		"password=%s dbname=%s sslmode=%s",
 		"db",
 		5432,
 		"postgres-dev",
 		"sn34kyp4ssw0rD",
-		"redeam-library")
+		"redeam-library",
+		cfg.DBSSLMode)
+	if cfg.DBSSLRootCert != "" {
+		dsn += " sslrootcert=" + cfg.DBSSLRootCert
+	}
+	if cfg.DBSSLCert != "" {
+		dsn += " sslcert=" + cfg.DBSSLCert + " sslkey=" + cfg.DBSSLKey
+	}
 	db, err := sql.Open("postgres", dsn)
 	if err != nil {
 		return fmt.Errorf("failed to open database: %v", err)
 	}
+	// closed by the lifecycle manager once the servers stopped, this covers failing to start
 	defer db.Close()
 
-	v1API := v1.NewBookServiceServer(db)
-
-	// run HTTP gateway
+	// relay Book change notifications to WatchBooks streams
+	notifier := v1.NewNotifier()
+	listener := pq.NewListener(dsn, 10*time.Second, time.Minute, nil)
 	go func() {
-		_ = rest.RunServer(ctx, "9090", "8080")
+		if err := notifier.Listen(ctx, listener); err != nil {
+			l.Error("book change listener stopped", "error", err)
+		}
 	}()
+	if cfg.ChangeRetention > 0 {
+		go v1.PruneChanges(ctx, db, cfg.ChangeRetention)
+	}
+
+	// closed as shutdown starts, ending WatchBooks streams before the servers drain
+	stopping := make(chan struct{})
+	serviceOpts := []v1.Option{v1.WithNotifier(notifier), v1.WithLogger(l), v1.WithShutdown(stopping)}
+	if cfg.CacheSize > 0 {
+		serviceOpts = append(serviceOpts, v1.WithCache(cache.NewLRU(cfg.CacheSize, cfg.CacheTTL)))
+	}
+	v1API := v1.NewBookServiceServer(db, serviceOpts...)
+
+	// readiness follows the database, served by grpc.health.v1 and on /readyz for the services
+	// registered, the ApiKeyService only is behind authentication
+	authenticated := cfg.JWTSecret != "" || cfg.JWKSFile != ""
+	services := []string{"v1.BookService"}
+	if authenticated {
+		services = append(services, "v1.ApiKeyService")
+	}
+	checker := health.NewChecker(db, v1.Tables, v1.SchemaVersion, services)
+	go checker.Watch(ctx)
 
-	return grpc.RunServer(ctx, v1API, "9090")
+	// metrics of RPCs, the gateway, the connection pool and the library, served on /metrics
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		collectors.NewDBStatsCollector(db, "redeam-library"),
+		v1.NewBookCollector(db),
+	)
+	opts := append([]grpc.ServerOption{grpc.StatsHandler(otelgrpc.NewServerHandler())}, middleware.AddMetrics(reg)...)
+	opts = append(opts, middleware.AddLogging(l)...)
+	// after logging so recovered panics and expired deadlines are logged with their codes
+	opts = append(opts, middleware.AddRecovery(l)...)
+	timeouts, err := parseTimeouts(cfg.MethodTimeouts)
+	if err != nil {
+		return fmt.Errorf("invalid -method-timeouts: %v", err)
+	}
+	opts = append(opts, middleware.AddDeadlines(cfg.CallTimeout, timeouts)...)
+	restOpts := []rest.Option{rest.WithMetrics(reg), rest.WithHealth(checker), rest.WithLogger(l)}
+	mws, err := gatewayMiddleware(cfg, l)
+	if err != nil {
+		return err
+	}
+	restOpts = append(restOpts, rest.WithMiddleware(mws...))
+	// health checks and reflection are open to everyone
+	public := append(append([]string{}, health.Public...), grpcserver.Reflection...)
+
+	// API keys are only managed, and accepted, behind authentication
+	var keyAPI api.ApiKeyServiceServer
+	if authenticated {
+		verifier, err := auth.NewVerifier([]byte(cfg.JWTSecret), cfg.JWKSFile, auth.WithIssuer(cfg.JWTIssuer), auth.WithAudience(cfg.JWTAudience))
+		if err != nil {
+			return fmt.Errorf("failed to configure authentication: %v", err)
+		}
+		opts = append(opts, middleware.AddAuth(verifier, v1.NewApiKeyVerifier(db), public...)...)
+		keyAPI = v1.NewApiKeyServiceServer(db)
+	} else {
+		l.Warn("no -jwt-secret or -jwks-file given, authentication and the ApiKeyService are disabled")
+	}
+
+	// after authentication so clients are told apart by identity rather than address
+	if cfg.RateLimitFile != "" {
+		limiter, err := ratelimit.Load(cfg.RateLimitFile)
+		if err != nil {
+			return fmt.Errorf("failed to configure rate limits: %v", err)
+		}
+		opts = append(opts, middleware.AddRateLimit(limiter, public...)...)
+	}
+
+	if cfg.PolicyFile != "" {
+		if !authenticated {
+			return fmt.Errorf("-policy-file requires -jwt-secret or -jwks-file")
+		}
+		policy, err := auth.LoadPolicy(cfg.PolicyFile)
+		if err != nil {
+			return fmt.Errorf("failed to configure authorization: %v", err)
+		}
+		opts = append(opts, middleware.AddAuthorization(policy, public...)...)
+	}
+
+	// after authorization so keys are scoped to verified callers and rejected calls aren't stored
+	if cfg.IdempotencyWindow > 0 {
+		opts = append(opts, middleware.AddIdempotency(v1.NewIdempotencyStore(db, cfg.IdempotencyWindow), idempotentMethods...)...)
+	}
+
+	if cfg.TLSCert != "" {
+		store, err := certs.NewStore(cfg.TLSCert, cfg.TLSKey, cfg.TLSClientCA)
+		if err != nil {
+			return fmt.Errorf("failed to configure TLS: %v", err)
+		}
+		go store.Watch(ctx, certReloadInterval)
+
+		var roots *x509.CertPool
+		if cfg.TLSCA != "" {
+			if roots, err = certs.LoadPool(cfg.TLSCA); err != nil {
+				return fmt.Errorf("failed to configure TLS: %v", err)
+			}
+		}
+		// the gateway presents its own certificate to the gRPC server, the server one unless given
+		clientStore := store
+		if cfg.TLSClientCert != "" {
+			if clientStore, err = certs.NewStore(cfg.TLSClientCert, cfg.TLSClientKey, ""); err != nil {
+				return fmt.Errorf("failed to configure TLS: %v", err)
+			}
+			go clientStore.Watch(ctx, certReloadInterval)
+		}
+		if cfg.TLSClientCA != "" && !cfg.SinglePort && !clientStore.ClientAuth() {
+			return fmt.Errorf("the gateway client certificate lacks the clientAuth extended key usage, give -tls-client-cert and -tls-client-key")
+		}
+
+		serverTLS := store.ServerConfig()
+		if !cfg.SinglePort {
+			// on a single port the gateway terminates TLS for gRPC calls too
+			opts = append(opts, grpc.Creds(credentials.NewTLS(serverTLS)))
+		}
+		restOpts = append(restOpts, rest.WithTLS(serverTLS, credentials.NewTLS(clientStore.ClientConfig(roots, cfg.TLSServerName))))
+	} else if cfg.TLSClientCA != "" || cfg.TLSClientCert != "" {
+		return fmt.Errorf("-tls-client-ca and -tls-client-cert require -tls-cert and -tls-key")
+	}
+
+	server := grpcserver.NewServer(v1API, keyAPI, checker.Server(), opts...)
+	// grpc-web calls go through the same interceptors as gRPC ones
+	restOpts = append(restOpts, rest.WithGRPCWeb(server, splitList(cfg.GRPCWebOrigins)))
+	if cfg.SinglePort {
+		restOpts = append(restOpts, rest.WithSinglePort(server))
+	}
+
+	gateway, err := rest.NewServer(ctx, cfg.GRPCPort, cfg.HTTPPort, restOpts...)
+	if err != nil {
+		return err
+	}
+
+	// on a signal or a failure drain the gateway first so it doesn't call a stopped gRPC server, close the database last
+	m := lifecycle.New(cfg.ShutdownTimeout, os.Interrupt, syscall.SIGTERM)
+	m.OnShutdown(checker.Shutdown, func() { close(stopping) })
+	m.Add("HTTP gateway", gateway.Run, gateway.Shutdown)
+	if !cfg.SinglePort {
+		// on a single port the gateway serves it and stops it once its calls are done
+		m.Add("gRPC server", func() error {
+			return grpcserver.RunServer(server, cfg.GRPCPort)
+		}, func(ctx context.Context) error {
+			return grpcserver.Shutdown(ctx, server)
+		})
+	}
+	m.Add("database", nil, func(context.Context) error {
+		// stop the background watchers using the database before closing it
+		cancel()
+		return db.Close()
+	})
+	return m.Run(ctx)
+}
+
+// gatewayMiddleware composes the middleware around the REST routes: panics are recovered first, then
+// oversized bodies are rejected before CORS and compression see the request
+func gatewayMiddleware(cfg Config, l *slog.Logger) ([]rest.Middleware, error) {
+	mws := []rest.Middleware{rest.Recover(l)}
+	if cfg.MaxBodyBytes > 0 {
+		mws = append(mws, rest.MaxBodySize(cfg.MaxBodyBytes))
+	}
+	if origins := splitList(cfg.CORSOrigins); len(origins) > 0 {
+		mws = append(mws, rest.CORS(rest.CORSConfig{
+			Origins:     origins,
+			Methods:     splitList(cfg.CORSMethods),
+			Headers:     splitList(cfg.CORSHeaders),
+			Credentials: cfg.CORSCredentials,
+			MaxAge:      cfg.CORSMaxAge,
+		}))
+	}
+	if cfg.GzipLevel != gzip.NoCompression {
+		gz, err := rest.Gzip(cfg.GzipLevel)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -gzip-level: %v", err)
+		}
+		mws = append(mws, gz)
+	}
+	return mws, nil
+}
+
+// splitList splits a comma separated flag value, dropping empty items
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseTimeouts parses comma separated method=duration pairs
+func parseTimeouts(s string) (map[string]time.Duration, error) {
+	timeouts := make(map[string]time.Duration)
+	for _, item := range splitList(s) {
+		method, value, ok := strings.Cut(item, "=")
+		if !ok || !strings.HasPrefix(method, "/") || strings.Count(method, "/") != 2 {
+			return nil, fmt.Errorf("%q is not a /package.Service/Method=duration pair", item)
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", method, err)
+		}
+		timeouts[method] = d
+	}
+	return timeouts, nil
 }
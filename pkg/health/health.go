@@ -0,0 +1,149 @@
+// Package health reports liveness and readiness over grpc.health.v1 and HTTP.
+package health
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const (
+	// checkTimeout bounds a readiness check, a hung database must not hang the probe
+	checkTimeout = 2 * time.Second
+	// checkInterval is how often the gRPC serving status is refreshed
+	checkInterval = 10 * time.Second
+)
+
+// Public lists the health methods that must stay reachable without credentials
+var Public = []string{
+	"/grpc.health.v1.Health/Check",
+	"/grpc.health.v1.Health/List",
+	"/grpc.health.v1.Health/Watch",
+}
+
+// Checker decides readiness from database connectivity and the presence of the schema
+type Checker struct {
+	db       *sql.DB
+	tables   []string
+	version  int
+	services []string
+	server   *grpchealth.Server
+	stopping atomic.Bool
+}
+
+// NewChecker checks that db answers, holds tables and, unless version is 0, a SchemaVersion table
+// at version or later. services are the gRPC services whose status follows readiness, besides the
+// overall "" service.
+func NewChecker(db *sql.DB, tables []string, version int, services []string) *Checker {
+	c := &Checker{
+		db:       db,
+		tables:   tables,
+		version:  version,
+		services: append([]string{""}, services...),
+		server:   grpchealth.NewServer(),
+	}
+	c.setStatus(healthpb.HealthCheckResponse_NOT_SERVING)
+	return c
+}
+
+// Server returns the grpc.health.v1.Health implementation to register on the gRPC server
+func (c *Checker) Server() healthpb.HealthServer {
+	return c.server
+}
+
+// Shutdown reports NOT_SERVING for good, called as shutdown starts so load balancers stop sending
+// calls while the running ones drain
+func (c *Checker) Shutdown() {
+	c.stopping.Store(true)
+	c.server.Shutdown()
+}
+
+// Ready returns why the server can't serve requests, or nil
+func (c *Checker) Ready(ctx context.Context) error {
+	if c.stopping.Load() {
+		return fmt.Errorf("shutting down")
+	}
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	if err := c.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("database unreachable: %v", err)
+	}
+	for _, t := range c.tables {
+		var exists bool
+		if err := c.db.QueryRowContext(ctx, "SELECT to_regclass($1) IS NOT NULL", t).Scan(&exists); err != nil {
+			return fmt.Errorf("checking schema: %v", err)
+		}
+		if !exists {
+			return fmt.Errorf("table %s is missing, apply init-db.sql", t)
+		}
+	}
+	if c.version > 0 {
+		var v int
+		if err := c.db.QueryRowContext(ctx, "SELECT coalesce(max(Version), 0) FROM SchemaVersion").Scan(&v); err != nil {
+			return fmt.Errorf("checking schema version: %v", err)
+		}
+		if v < c.version {
+			return fmt.Errorf("schema version is %d, want %d, apply init-db.sql", v, c.version)
+		}
+	}
+	return nil
+}
+
+// Watch refreshes the gRPC serving status until ctx is done, then reports NOT_SERVING for good
+func (c *Checker) Watch(ctx context.Context) {
+	t := time.NewTicker(checkInterval)
+	defer t.Stop()
+
+	// log and update the status when readiness changes only
+	for first, ready := true, false; ; first = false {
+		err := c.Ready(ctx)
+		if first || ready != (err == nil) {
+			if err != nil {
+				slog.Warn("not ready", "error", err)
+				c.setStatus(healthpb.HealthCheckResponse_NOT_SERVING)
+			} else {
+				slog.Info("ready")
+				c.setStatus(healthpb.HealthCheckResponse_SERVING)
+			}
+		}
+		ready = err == nil
+
+		select {
+		case <-ctx.Done():
+			c.server.Shutdown()
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// Liveness answers /healthz: the process is up and serving HTTP
+func (c *Checker) Liveness(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, "ok")
+}
+
+// Readiness answers /readyz with 503 and the reason while the server can't serve requests
+func (c *Checker) Readiness(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if err := c.Ready(r.Context()); err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintln(w, err.Error())
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+func (c *Checker) setStatus(s healthpb.HealthCheckResponse_ServingStatus) {
+	for _, svc := range c.services {
+		c.server.SetServingStatus(svc, s)
+	}
+}
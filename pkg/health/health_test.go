@@ -0,0 +1,86 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	_ "github.com/lib/pq"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// unreachable opens a database nothing listens on
+func unreachable(t *testing.T) *sql.DB {
+	db, err := sql.Open("postgres", "host=127.0.0.1 port=1 user=nobody dbname=none sslmode=disable connect_timeout=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestLiveness(t *testing.T) {
+	c := NewChecker(unreachable(t), nil, 0, nil)
+
+	rec := httptest.NewRecorder()
+	c.Liveness(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Liveness() code = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestReadiness(t *testing.T) {
+	c := NewChecker(unreachable(t), []string{"book"}, 1, nil)
+
+	rec := httptest.NewRecorder()
+	c.Readiness(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Readiness() code = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	if !strings.Contains(rec.Body.String(), "database unreachable") {
+		t.Errorf("Readiness() body = %q, want the reason", rec.Body.String())
+	}
+}
+
+func TestWatch(t *testing.T) {
+	c := NewChecker(unreachable(t), nil, 0, []string{"v1.BookService"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c.Watch(ctx)
+
+	tests := []string{"", "v1.BookService"}
+	for _, svc := range tests {
+		res, err := c.Server().Check(context.Background(), &healthpb.HealthCheckRequest{Service: svc})
+		if err != nil {
+			t.Fatalf("Check(%q) error = %v", svc, err)
+		}
+		if res.Status != healthpb.HealthCheckResponse_NOT_SERVING {
+			t.Errorf("Check(%q) = %v, want NOT_SERVING", svc, res.Status)
+		}
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	c := NewChecker(unreachable(t), nil, 0, nil)
+	c.Shutdown()
+
+	rec := httptest.NewRecorder()
+	c.Readiness(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "shutting down") {
+		t.Errorf("Readiness() = %d %q, want 503 shutting down", rec.Code, rec.Body.String())
+	}
+
+	// a later check must not report SERVING again
+	c.setStatus(healthpb.HealthCheckResponse_SERVING)
+	res, err := c.Server().Check(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if res.Status != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("Check() = %v, want NOT_SERVING", res.Status)
+	}
+}
@@ -0,0 +1,114 @@
+// Package idempotency remembers the responses of calls made with an idempotency key so retries
+// of the same call get them back instead of repeating it.
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// PendingTTL is how long a key stays claimed by a call that neither completed nor released it,
+// e.g. because the server stopped, before a retry may claim it again
+const PendingTTL = 5 * time.Minute
+
+// sweepInterval is how often Memory drops expired keys
+const sweepInterval = time.Minute
+
+var (
+	// ErrMismatch is returned for a key that was used with a different request
+	ErrMismatch = errors.New("idempotency: key was used with a different request")
+	// ErrInProgress is returned for a key whose first call has not finished yet
+	ErrInProgress = errors.New("idempotency: a call with this key is in progress")
+)
+
+// Store keeps keys along with the hash of their request and, once the call completed, its response.
+// Keys expire after the window the store was created with.
+type Store interface {
+	// Begin claims key for a request with hash. It returns the response of a completed call with key,
+	// nil when the caller claimed the key and should make the call, or ErrMismatch or ErrInProgress.
+	Begin(ctx context.Context, key, hash string) ([]byte, error)
+	// Complete stores the response of the call that claimed key
+	Complete(ctx context.Context, key string, response []byte) error
+	// Release drops a claimed key after its call failed, so it may be retried
+	Release(ctx context.Context, key string) error
+}
+
+// Memory is a Store in process, for a single server or tests
+type Memory struct {
+	window time.Duration
+	now    func() time.Time
+
+	mu        sync.Mutex
+	keys      map[string]*record
+	lastSweep time.Time
+}
+
+type record struct {
+	hash     string
+	response []byte // nil while the call is in progress
+	expires  time.Time
+}
+
+var _ Store = (*Memory)(nil)
+
+// NewMemory keeps the responses of completed calls for window
+func NewMemory(window time.Duration) *Memory {
+	return &Memory{window: window, now: time.Now, keys: make(map[string]*record)}
+}
+
+// Begin claims key unless an unexpired call holds it
+func (m *Memory) Begin(_ context.Context, key, hash string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	if now.Sub(m.lastSweep) >= sweepInterval {
+		m.sweep(now)
+		m.lastSweep = now
+	}
+	if r, ok := m.keys[key]; ok && now.Before(r.expires) {
+		switch {
+		case r.hash != hash:
+			return nil, ErrMismatch
+		case r.response == nil:
+			return nil, ErrInProgress
+		}
+		return r.response, nil
+	}
+	m.keys[key] = &record{hash: hash, expires: now.Add(PendingTTL)}
+	return nil, nil
+}
+
+// Complete stores response for window
+func (m *Memory) Complete(_ context.Context, key string, response []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if r, ok := m.keys[key]; ok {
+		if response == nil {
+			response = []byte{}
+		}
+		r.response, r.expires = response, m.now().Add(m.window)
+	}
+	return nil
+}
+
+// Release drops key
+func (m *Memory) Release(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.keys, key)
+	return nil
+}
+
+// sweep drops expired keys
+func (m *Memory) sweep(now time.Time) {
+	for key, r := range m.keys {
+		if !now.Before(r.expires) {
+			delete(m.keys, key)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package idempotency
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemory(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	m := NewMemory(time.Hour)
+	m.now = func() time.Time { return now }
+
+	if resp, err := m.Begin(ctx, "k1", "a"); resp != nil || err != nil {
+		t.Fatalf("Begin() = %q, %v, want the key claimed", resp, err)
+	}
+	if _, err := m.Begin(ctx, "k1", "a"); err != ErrInProgress {
+		t.Errorf("Begin() of a claimed key error = %v, want ErrInProgress", err)
+	}
+	if _, err := m.Begin(ctx, "k1", "b"); err != ErrMismatch {
+		t.Errorf("Begin() of another request error = %v, want ErrMismatch", err)
+	}
+
+	m.Complete(ctx, "k1", []byte("created"))
+	if resp, err := m.Begin(ctx, "k1", "a"); string(resp) != "created" || err != nil {
+		t.Errorf("Begin() of a completed key = %q, %v, want the response", resp, err)
+	}
+
+	now = now.Add(time.Hour)
+	if resp, err := m.Begin(ctx, "k1", "b"); resp != nil || err != nil {
+		t.Errorf("Begin() after the window = %q, %v, want the key claimed again", resp, err)
+	}
+}
+
+func TestMemory_Release(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	m := NewMemory(time.Hour)
+	m.now = func() time.Time { return now }
+
+	m.Begin(ctx, "k1", "a")
+	m.Release(ctx, "k1")
+	if resp, err := m.Begin(ctx, "k1", "b"); resp != nil || err != nil {
+		t.Errorf("Begin() after Release = %q, %v, want the key claimed", resp, err)
+	}
+
+	// a call that never completes frees its key after PendingTTL
+	now = now.Add(PendingTTL)
+	if resp, err := m.Begin(ctx, "k1", "c"); resp != nil || err != nil {
+		t.Errorf("Begin() after PendingTTL = %q, %v, want the key claimed", resp, err)
+	}
+}
@@ -0,0 +1,113 @@
+// Package lifecycle runs the servers of the process and stops them in order on a signal or a failure.
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"time"
+)
+
+type component struct {
+	name string
+	run  func() error
+	stop func(context.Context) error
+}
+
+// Manager runs components until the context is done, a signal arrives or one of them fails,
+// then stops all of them in the order they were added
+type Manager struct {
+	timeout    time.Duration
+	signals    []os.Signal
+	components []component
+	onShutdown []func()
+}
+
+// New stops each component within timeout once one of signals arrives
+func New(timeout time.Duration, signals ...os.Signal) *Manager {
+	return &Manager{timeout: timeout, signals: signals}
+}
+
+// Add registers a component. run blocks while it serves and must return once stop was called,
+// a nil run only stops, e.g. to close the database after the servers
+func (m *Manager) Add(name string, run func() error, stop func(context.Context) error) {
+	m.components = append(m.components, component{name: name, run: run, stop: stop})
+}
+
+// OnShutdown registers fns to run as soon as shutdown starts, before any component is stopped,
+// e.g. to fail health checks or end long-lived streams that would hold up a graceful stop
+func (m *Manager) OnShutdown(fns ...func()) {
+	m.onShutdown = append(m.onShutdown, fns...)
+}
+
+// Run starts the components and blocks until they are stopped. It returns the first error a
+// component failed with, or the first error stopping them.
+func (m *Manager) Run(ctx context.Context) error {
+	sig := make(chan os.Signal, 1)
+	if len(m.signals) > 0 {
+		signal.Notify(sig, m.signals...)
+		defer signal.Stop(sig)
+	}
+
+	errc := make(chan error, len(m.components))
+	running := 0
+	for _, c := range m.components {
+		if c.run == nil {
+			continue
+		}
+		running++
+		go func(c component) {
+			err := c.run()
+			if err != nil {
+				err = fmt.Errorf("%s: %v", c.name, err)
+			}
+			errc <- err
+		}(c)
+	}
+
+	var err error
+	select {
+	case s := <-sig:
+		slog.Info("shutting down", "signal", s.String())
+	case <-ctx.Done():
+		slog.Info("shutting down", "cause", ctx.Err())
+	case err = <-errc:
+		running--
+		if err != nil {
+			slog.Error("shutting down", "error", err)
+		} else {
+			slog.Warn("shutting down, a component stopped on its own")
+		}
+	}
+
+	for _, fn := range m.onShutdown {
+		fn()
+	}
+	for _, c := range m.components {
+		if c.stop == nil {
+			continue
+		}
+		if serr := m.stop(c); serr != nil {
+			slog.Error("failed to stop", "component", c.name, "error", serr)
+			if err == nil {
+				err = fmt.Errorf("stopping %s: %v", c.name, serr)
+			}
+		}
+	}
+
+	for ; running > 0; running-- {
+		if rerr := <-errc; rerr != nil && err == nil {
+			err = rerr
+		}
+	}
+	return err
+}
+
+// stop stops c within a deadline of its own, a component running late doesn't cut the time of the next
+func (m *Manager) stop(c component) error {
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+	defer cancel()
+	return c.stop(ctx)
+}
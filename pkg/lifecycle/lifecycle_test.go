@@ -0,0 +1,153 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fake is a component that serves until it is stopped
+type fake struct {
+	name string
+	fail error // returned by run right away when set
+	log  *recorder
+
+	once    sync.Once
+	stopped chan struct{}
+}
+
+type recorder struct {
+	mu    sync.Mutex
+	stops []string
+}
+
+func (r *recorder) add(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stops = append(r.stops, name)
+}
+
+func newFake(name string, log *recorder) *fake {
+	return &fake{name: name, log: log, stopped: make(chan struct{})}
+}
+
+func (f *fake) run() error {
+	if f.fail != nil {
+		return f.fail
+	}
+	<-f.stopped
+	return nil
+}
+
+func (f *fake) stop(ctx context.Context) error {
+	if _, ok := ctx.Deadline(); !ok {
+		return errors.New("no deadline")
+	}
+	f.log.add(f.name)
+	f.once.Do(func() { close(f.stopped) })
+	return nil
+}
+
+func TestManager_Run(t *testing.T) {
+	failed := errors.New("address already in use")
+
+	tests := []struct {
+		name    string
+		trigger string // how shutdown starts: cancel, signal or fail
+		wantErr string
+	}{
+		{"context done", "cancel", ""},
+		{"signal", "signal", ""},
+		{"component failed", "fail", "grpc: address already in use"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := &recorder{}
+			http, grpc := newFake("http", log), newFake("grpc", log)
+			if tt.trigger == "fail" {
+				grpc.fail = failed
+			}
+
+			m := New(time.Second, os.Interrupt)
+			m.OnShutdown(func() { log.add("health") })
+			m.Add("http", http.run, http.stop)
+			m.Add("grpc", grpc.run, grpc.stop)
+			m.Add("db", nil, func(context.Context) error {
+				log.add("db")
+				return nil
+			})
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			done := make(chan error, 1)
+			go func() { done <- m.Run(ctx) }()
+
+			switch tt.trigger {
+			case "cancel":
+				cancel()
+			case "signal":
+				// wait for Run to subscribe, an unhandled interrupt would kill the test binary
+				time.Sleep(50 * time.Millisecond)
+				p, err := os.FindProcess(os.Getpid())
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := p.Signal(os.Interrupt); err != nil {
+					t.Skipf("can't signal the test process: %v", err)
+				}
+			}
+
+			select {
+			case err := <-done:
+				if got := fmt.Sprint(err); (err != nil || tt.wantErr != "") && got != tt.wantErr {
+					t.Errorf("Run() error = %v, want %v", err, tt.wantErr)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("Run() didn't return")
+			}
+			if want := []string{"health", "http", "grpc", "db"}; !reflect.DeepEqual(log.stops, want) {
+				t.Errorf("stop order = %v, want %v", log.stops, want)
+			}
+		})
+	}
+}
+
+func TestManager_RunStopError(t *testing.T) {
+	m := New(time.Second)
+	m.Add("db", nil, func(context.Context) error { return errors.New("boom") })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := m.Run(ctx); err == nil || err.Error() != "stopping db: boom" {
+		t.Errorf("Run() error = %v, want stopping db: boom", err)
+	}
+}
+
+func TestManager_RunStopBudget(t *testing.T) {
+	m := New(50 * time.Millisecond)
+	// the first component runs out its deadline, the next one still gets its own
+	m.Add("grpc", nil, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	var left time.Duration
+	m.Add("db", nil, func(ctx context.Context) error {
+		deadline, _ := ctx.Deadline()
+		left = time.Until(deadline)
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := m.Run(ctx); err == nil || err.Error() != "stopping grpc: context deadline exceeded" {
+		t.Errorf("Run() error = %v, want stopping grpc: context deadline exceeded", err)
+	}
+	if left < 25*time.Millisecond {
+		t.Errorf("db had %v left to stop, want a deadline of its own", left)
+	}
+}
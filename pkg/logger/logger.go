@@ -0,0 +1,60 @@
+// Package logger builds the structured JSON logger of the server and carries request scoped loggers and request IDs through contexts.
+package logger
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+const (
+	// RequestIDHeader is the HTTP header a request ID is read from and echoed in
+	RequestIDHeader = "X-Request-Id"
+	// RequestIDMetadata is the gRPC metadata key carrying the request ID
+	RequestIDMetadata = "x-request-id"
+
+	maxRequestIDLength = 128
+)
+
+// New returns a logger writing JSON lines to w, level is one of debug, info, warn or error
+func New(w io.Writer, level string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("logger: invalid level %q", level)
+	}
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: lvl})), nil
+}
+
+type loggerKey struct{}
+
+// NewContext returns a copy of ctx carrying l, typically annotated with the request ID
+func NewContext(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// FromContext returns the logger of the request, or fallback outside of requests
+func FromContext(ctx context.Context, fallback *slog.Logger) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return fallback
+}
+
+// RequestID returns id when a caller sent a usable one, otherwise a new random ID
+func RequestID(id string) string {
+	if id != "" && len(id) <= maxRequestIDLength && strings.IndexFunc(id, invalidIDRune) < 0 {
+		return id
+	}
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// invalidIDRune rejects anything but printable ASCII, IDs end up in log lines and headers
+func invalidIDRune(r rune) bool {
+	return r < '!' || r > '~'
+}
@@ -0,0 +1,45 @@
+package logger
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	var buf bytes.Buffer
+	l, err := New(&buf, "warn")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	l.Info("dropped")
+	l.Warn("kept", "id", 1)
+	if got := buf.String(); strings.Contains(got, "dropped") || !strings.Contains(got, `"msg":"kept","id":1`) {
+		t.Errorf("New() logged %q", got)
+	}
+
+	if _, err := New(&buf, "verbose"); err == nil {
+		t.Errorf("New() accepted an unknown level")
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name     string
+		id       string
+		wantSame bool
+	}{
+		{"Valid", "req-42", true},
+		{"Empty", "", false},
+		{"Control characters", "req\n42", false},
+		{"Too long", strings.Repeat("a", maxRequestIDLength+1), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := RequestID(tt.id)
+			if (got == tt.id) != tt.wantSame || got == "" {
+				t.Errorf("RequestID(%q) = %q", tt.id, got)
+			}
+		})
+	}
+}
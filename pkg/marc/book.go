@@ -0,0 +1,151 @@
+package marc
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/golang/protobuf/ptypes"
+
+	"github.com/radean0909/redeam-rest/pkg/api/v1"
+)
+
+// defaultLeader describes a new, complete UTF-8 record for a monograph catalogued with ISBD punctuation
+const defaultLeader = "00000nam a2200000 i 4500"
+
+var yearPattern = regexp.MustCompile(`\d{4}`)
+
+// ToBook maps a bibliographic record to a Book:
+// 245 $a/$b title, 100 (or 110) $a author, 264 (or 260) $b publisher and $c date, 020 $a ISBN.
+// Only the publication year is known in MARC, it becomes January 1st of that year.
+// Rating and status have no MARC equivalent and are left unset.
+func ToBook(rec *Record) (*v1.Book, error) {
+	if len(rec.Leader) == leaderLength && rec.Leader[9] != 'a' && !isASCII(rec) {
+		return nil, fmt.Errorf("marc: record uses MARC-8 encoding, convert it to UTF-8 first")
+	}
+
+	title := rec.Field("245")
+	book := &v1.Book{
+		Title: trimISBD(strings.TrimSpace(title.Subfield('a') + " " + title.Subfield('b'))),
+	}
+	if book.Title == "" {
+		return nil, fmt.Errorf("marc: record has no 245 title")
+	}
+
+	if author := rec.Field("100"); author != nil {
+		book.Author = trimISBD(author.Subfield('a'))
+	} else {
+		book.Author = trimISBD(rec.Field("110").Subfield('a'))
+	}
+
+	pub := publication(rec)
+	book.Publisher = trimISBD(pub.Subfield('b'))
+
+	year := yearPattern.FindString(pub.Subfield('c'))
+	if fixed := rec.Control("008"); year == "" && len(fixed) >= 11 {
+		// 008/07-10 holds Date 1
+		if _, err := strconv.Atoi(fixed[7:11]); err == nil {
+			year = fixed[7:11]
+		}
+	}
+	if year == "" {
+		return nil, fmt.Errorf("marc: record has no publication date")
+	}
+	y, _ := strconv.Atoi(year)
+	publishDate, err := ptypes.TimestampProto(time.Date(y, time.January, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		return nil, fmt.Errorf("marc: invalid publication year %s: %v", year, err)
+	}
+	book.PublishDate = publishDate
+
+	// 020 $a may carry qualifiers, e.g. "0306406152 (pbk.)"
+	if isbn := strings.Fields(rec.Field("020").Subfield('a')); len(isbn) > 0 {
+		book.Isbn = isbn[0]
+	}
+
+	return book, nil
+}
+
+// FromBook builds a minimal UTF-8 bibliographic record for a Book, the Id becomes the 001 control number
+func FromBook(b *v1.Book) *Record {
+	rec := &Record{Leader: defaultLeader}
+
+	year := "    "
+	if t, err := ptypes.Timestamp(b.PublishDate); err == nil {
+		year = fmt.Sprintf("%04d", t.Year())
+	}
+
+	if b.Id != 0 {
+		rec.ControlFields = append(rec.ControlFields, ControlField{Tag: "001", Value: strconv.FormatInt(b.Id, 10)})
+	}
+	// 008 with only the type of date (single known date) and Date 1 filled in
+	rec.ControlFields = append(rec.ControlFields, ControlField{Tag: "008", Value: fmt.Sprintf("%6s%c%4s%4s%25s", "", 's', year, "", "")})
+
+	if b.Isbn != "" {
+		rec.DataFields = append(rec.DataFields, DataField{Tag: "020", Ind1: ' ', Ind2: ' ', Subfields: []Subfield{{'a', b.Isbn}}})
+	}
+
+	// 245 first indicator tells whether a 1XX main entry exists
+	titleInd := byte('0')
+	if b.Author != "" {
+		titleInd = '1'
+		rec.DataFields = append(rec.DataFields, DataField{Tag: "100", Ind1: '1', Ind2: ' ', Subfields: []Subfield{{'a', b.Author}}})
+	}
+	rec.DataFields = append(rec.DataFields, DataField{Tag: "245", Ind1: titleInd, Ind2: '0', Subfields: []Subfield{{'a', b.Title}}})
+
+	var pub []Subfield
+	if b.Publisher != "" {
+		pub = append(pub, Subfield{'b', b.Publisher})
+	}
+	if year != "    " {
+		pub = append(pub, Subfield{'c', year})
+	}
+	if len(pub) > 0 {
+		rec.DataFields = append(rec.DataFields, DataField{Tag: "264", Ind1: ' ', Ind2: '1', Subfields: pub})
+	}
+
+	return rec
+}
+
+// publication returns the 264 publication statement (second indicator 1) or the older 260
+func publication(rec *Record) *DataField {
+	for i := range rec.DataFields {
+		if f := &rec.DataFields[i]; f.Tag == "264" && f.Ind2 == '1' {
+			return f
+		}
+	}
+	return rec.Field("260")
+}
+
+// trimISBD strips the punctuation cataloguers put between subfields, e.g. "Metro Books," or "Title /"
+func trimISBD(v string) string {
+	return strings.TrimRight(strings.TrimSpace(v), " /:;,.=")
+}
+
+func isASCII(rec *Record) bool {
+	check := func(v string) bool {
+		for i := 0; i < len(v); i++ {
+			if v[i] >= utf8.RuneSelf {
+				return false
+			}
+		}
+		return true
+	}
+
+	for _, f := range rec.ControlFields {
+		if !check(f.Value) {
+			return false
+		}
+	}
+	for _, f := range rec.DataFields {
+		for _, sf := range f.Subfields {
+			if !check(sf.Value) {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,222 @@
+package marc
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+)
+
+const (
+	leaderLength         = 24
+	directoryEntryLength = 12
+
+	subfieldDelimiter = 0x1F
+	fieldTerminator   = 0x1E
+	recordTerminator  = 0x1D
+
+	maxRecordLength = 99999 // record length is stored in 5 digits
+)
+
+// Reader reads ISO 2709 records one at a time
+type Reader struct {
+	r *bufio.Reader
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// Read returns the next record or io.EOF once the input is exhausted.
+// A malformed record is reported as an error, reading can continue with the next one.
+func (r *Reader) Read() (*Record, error) {
+	// skip line breaks some tools put between records
+	for {
+		b, err := r.r.Peek(1)
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		if err != nil {
+			return nil, err
+		}
+		if b[0] != '\n' && b[0] != '\r' {
+			break
+		}
+		r.r.ReadByte()
+	}
+
+	head := make([]byte, 5)
+	if _, err := io.ReadFull(r.r, head); err != nil {
+		return nil, fmt.Errorf("marc: reading record length: %v", err)
+	}
+	length, ok := parseDigits(head)
+	if !ok || length < leaderLength+2 {
+		// without a usable length there is no way to find the next record
+		return nil, fmt.Errorf("marc: invalid record length %q", head)
+	}
+
+	data := make([]byte, length)
+	copy(data, head)
+	if _, err := io.ReadFull(r.r, data[len(head):]); err != nil {
+		return nil, fmt.Errorf("marc: reading record: %v", err)
+	}
+
+	return Unmarshal(data)
+}
+
+// Unmarshal parses a single ISO 2709 record
+func Unmarshal(data []byte) (*Record, error) {
+	if len(data) < leaderLength+2 {
+		return nil, fmt.Errorf("marc: record of %d bytes is too short", len(data))
+	}
+	if data[len(data)-1] != recordTerminator {
+		return nil, fmt.Errorf("marc: record terminator is missing")
+	}
+
+	rec := &Record{Leader: string(data[:leaderLength])}
+
+	base, ok := parseDigits(data[12:17])
+	if !ok || base <= leaderLength || base > len(data) {
+		return nil, fmt.Errorf("marc: invalid base address of data %q", data[12:17])
+	}
+	if data[base-1] != fieldTerminator {
+		return nil, fmt.Errorf("marc: directory terminator is missing")
+	}
+	dir := data[leaderLength : base-1]
+	if len(dir)%directoryEntryLength != 0 {
+		return nil, fmt.Errorf("marc: directory length %d is not a multiple of %d", len(dir), directoryEntryLength)
+	}
+
+	for i := 0; i < len(dir); i += directoryEntryLength {
+		entry := dir[i : i+directoryEntryLength]
+		tag := string(entry[:3])
+		length, ok1 := parseDigits(entry[3:7])
+		start, ok2 := parseDigits(entry[7:12])
+		// fields end before the record terminator
+		if !ok1 || !ok2 || start+length > len(data)-1-base {
+			return nil, fmt.Errorf("marc: invalid directory entry %q", entry)
+		}
+		field := bytes.TrimSuffix(data[base+start:base+start+length], []byte{fieldTerminator})
+
+		if isControlTag(tag) {
+			rec.ControlFields = append(rec.ControlFields, ControlField{Tag: tag, Value: string(field)})
+			continue
+		}
+
+		if len(field) < 2 {
+			return nil, fmt.Errorf("marc: field %s has no indicators", tag)
+		}
+		df := DataField{Tag: tag, Ind1: field[0], Ind2: field[1]}
+		for _, sf := range bytes.Split(field[2:], []byte{subfieldDelimiter}) {
+			if len(sf) == 0 {
+				continue
+			}
+			df.Subfields = append(df.Subfields, Subfield{Code: sf[0], Value: string(sf[1:])})
+		}
+		rec.DataFields = append(rec.DataFields, df)
+	}
+
+	return rec, nil
+}
+
+// parseDigits reads an unsigned decimal number, unlike strconv.Atoi it refuses signs so lengths and
+// addresses can't be negative
+func parseDigits(b []byte) (int, bool) {
+	if len(b) == 0 {
+		return 0, false
+	}
+	n := 0
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		n = n*10 + int(c-'0')
+	}
+	return n, true
+}
+
+// Writer writes ISO 2709 records
+type Writer struct {
+	w io.Writer
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+func (w *Writer) Write(rec *Record) error {
+	data, err := Marshal(rec)
+	if err != nil {
+		return err
+	}
+	_, err = w.w.Write(data)
+	return err
+}
+
+// Marshal encodes a record, the length and address parts of the leader are recomputed
+func Marshal(rec *Record) ([]byte, error) {
+	var dir, fields bytes.Buffer
+
+	add := func(tag string, field []byte) error {
+		if len(tag) != 3 {
+			return fmt.Errorf("marc: invalid tag %q", tag)
+		}
+		if len(field) > 9999 {
+			return fmt.Errorf("marc: field %s is longer than 9999 bytes", tag)
+		}
+		fmt.Fprintf(&dir, "%s%04d%05d", tag, len(field), fields.Len())
+		fields.Write(field)
+		return nil
+	}
+
+	for _, f := range rec.ControlFields {
+		if err := add(f.Tag, append([]byte(f.Value), fieldTerminator)); err != nil {
+			return nil, err
+		}
+	}
+	for _, f := range rec.DataFields {
+		var field bytes.Buffer
+		field.WriteByte(indicator(f.Ind1))
+		field.WriteByte(indicator(f.Ind2))
+		for _, sf := range f.Subfields {
+			field.WriteByte(subfieldDelimiter)
+			field.WriteByte(sf.Code)
+			field.WriteString(sf.Value)
+		}
+		field.WriteByte(fieldTerminator)
+		if err := add(f.Tag, field.Bytes()); err != nil {
+			return nil, err
+		}
+	}
+	dir.WriteByte(fieldTerminator)
+
+	base := leaderLength + dir.Len()
+	length := base + fields.Len() + 1
+	if length > maxRecordLength {
+		return nil, fmt.Errorf("marc: record of %d bytes exceeds %d", length, maxRecordLength)
+	}
+
+	leader := []byte(rec.Leader)
+	if len(leader) != leaderLength {
+		leader = []byte(defaultLeader)
+	}
+	copy(leader[0:5], fmt.Sprintf("%05d", length))
+	copy(leader[10:12], "22")
+	copy(leader[12:17], fmt.Sprintf("%05d", base))
+	copy(leader[20:24], "4500")
+
+	out := make([]byte, 0, length)
+	out = append(out, leader...)
+	out = append(out, dir.Bytes()...)
+	out = append(out, fields.Bytes()...)
+	out = append(out, recordTerminator)
+	return out, nil
+}
+
+// indicator maps an unset indicator to the blank MARC uses for "undefined"
+func indicator(b byte) byte {
+	if b == 0 {
+		return ' '
+	}
+	return b
+}
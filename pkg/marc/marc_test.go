@@ -0,0 +1,243 @@
+package marc
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+
+	"github.com/radean0909/redeam-rest/pkg/api/v1"
+)
+
+func sampleRecord() *Record {
+	return &Record{
+		Leader: "00000cam a2200000 i 4500",
+		ControlFields: []ControlField{
+			{Tag: "001", Value: "ocm12345"},
+			{Tag: "008", Value: "020510s2002    nyu           000 0 eng d"},
+		},
+		DataFields: []DataField{
+			{Tag: "020", Ind1: ' ', Ind2: ' ', Subfields: []Subfield{{'a', "9780760735408 (hbk.)"}}},
+			{Tag: "100", Ind1: '1', Ind2: ' ', Subfields: []Subfield{{'a', "Loewer, Barry,"}, {'e', "editor."}}},
+			{Tag: "245", Ind1: '1', Ind2: '0', Subfields: []Subfield{{'a', "30-second philosophies :"}, {'b', "the 50 most thought-provoking philosophies /"}, {'c', "editor, Barry Loewer."}}},
+			{Tag: "264", Ind1: ' ', Ind2: '1', Subfields: []Subfield{{'a', "New York :"}, {'b', "Metro Books,"}, {'c', "[2002]"}}},
+		},
+	}
+}
+
+func TestISO2709RoundTrip(t *testing.T) {
+	want := sampleRecord()
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for i := 0; i < 2; i++ {
+		if err := w.Write(want); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+
+	r := NewReader(&buf)
+	for i := 0; i < 2; i++ {
+		got, err := r.Read()
+		if err != nil {
+			t.Fatalf("Read() error = %v", err)
+		}
+		// only the leader's length and base address change
+		if got.Leader[5:12] != want.Leader[5:12] || got.Leader[17:] != want.Leader[17:] {
+			t.Errorf("Read() leader = %q, want %q", got.Leader, want.Leader)
+		}
+		got.Leader = want.Leader
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Read() = %+v, want %+v", got, want)
+		}
+	}
+	if _, err := r.Read(); err != io.EOF {
+		t.Errorf("Read() error = %v, want io.EOF", err)
+	}
+}
+
+func TestUnmarshalInvalid(t *testing.T) {
+	data, _ := Marshal(sampleRecord())
+
+	tests := map[string][]byte{
+		"Too short":              data[:10],
+		"No record terminator":   data[:len(data)-1],
+		"Invalid base address":   append(append(append([]byte{}, data[:12]...), "xxxxx"...), data[17:]...),
+		"Directory out of range": append(append([]byte{}, data[:len(data)-40]...), recordTerminator),
+		"Signed base address":    withBytes(data, 12, "+0073"),
+		"Negative field length":  withBytes(data, leaderLength+3, "-001"),
+		"Negative field start":   withBytes(data, leaderLength+7, "-0001"),
+		"Field past the end":     withBytes(data, leaderLength+7, "99999"),
+		"Field length too large": withBytes(data, leaderLength+3, "9999"),
+	}
+	for name, in := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Unmarshal(in); err == nil {
+				t.Errorf("Unmarshal() accepted an invalid record")
+			}
+		})
+	}
+}
+
+// withBytes returns a copy of data with s written at offset i
+func withBytes(data []byte, i int, s string) []byte {
+	out := append([]byte{}, data...)
+	copy(out[i:], s)
+	return out
+}
+
+func TestXMLRoundTrip(t *testing.T) {
+	want := sampleRecord()
+
+	var buf bytes.Buffer
+	w := NewXMLWriter(&buf)
+	if err := w.Write(want); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if !strings.Contains(buf.String(), `<collection xmlns="`+Namespace+`">`) {
+		t.Errorf("Write() did not produce a MARCXML collection: %s", buf.String())
+	}
+
+	r := NewXMLReader(&buf)
+	got, err := r.Read()
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Read() = %+v, want %+v", got, want)
+	}
+	if _, err := r.Read(); err != io.EOF {
+		t.Errorf("Read() error = %v, want io.EOF", err)
+	}
+}
+
+func TestToBook(t *testing.T) {
+	publishDate, _ := ptypes.TimestampProto(time.Date(2002, time.January, 1, 0, 0, 0, 0, time.UTC))
+
+	tests := []struct {
+		name    string
+		rec     func() *Record
+		want    *v1.Book
+		wantErr bool
+	}{
+		{
+			name: "RDA record",
+			rec:  sampleRecord,
+			want: &v1.Book{
+				Title:       "30-second philosophies : the 50 most thought-provoking philosophies",
+				Author:      "Loewer, Barry",
+				Publisher:   "Metro Books",
+				PublishDate: publishDate,
+				Isbn:        "9780760735408",
+			},
+		},
+		{
+			name: "AACR2 record with 260",
+			rec: func() *Record {
+				rec := sampleRecord()
+				rec.DataFields[3] = DataField{Tag: "260", Ind1: ' ', Ind2: ' ', Subfields: []Subfield{{'b', "Metro Books,"}, {'c', "c2002."}}}
+				return rec
+			},
+			want: &v1.Book{
+				Title:       "30-second philosophies : the 50 most thought-provoking philosophies",
+				Author:      "Loewer, Barry",
+				Publisher:   "Metro Books",
+				PublishDate: publishDate,
+				Isbn:        "9780760735408",
+			},
+		},
+		{
+			name: "Date from 008",
+			rec: func() *Record {
+				rec := sampleRecord()
+				rec.DataFields[3].Subfields = rec.DataFields[3].Subfields[:2]
+				return rec
+			},
+			want: &v1.Book{
+				Title:       "30-second philosophies : the 50 most thought-provoking philosophies",
+				Author:      "Loewer, Barry",
+				Publisher:   "Metro Books",
+				PublishDate: publishDate,
+				Isbn:        "9780760735408",
+			},
+		},
+		{
+			name: "Missing title",
+			rec: func() *Record {
+				rec := sampleRecord()
+				rec.DataFields = rec.DataFields[:2]
+				return rec
+			},
+			wantErr: true,
+		},
+		{
+			name: "MARC-8 with non-ASCII characters",
+			rec: func() *Record {
+				rec := sampleRecord()
+				rec.Leader = "00000cam  2200000 i 4500"
+				rec.DataFields[1].Subfields[0].Value = "Lo\xe2ewer, Barry,"
+				return rec
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ToBook(tt.rec())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ToBook() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ToBook() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFromBook(t *testing.T) {
+	publishDate, _ := ptypes.TimestampProto(time.Date(2002, time.October, 2, 15, 0, 0, 0, time.UTC))
+	book := &v1.Book{
+		Id:          7,
+		Title:       "30-Second Philosophies",
+		Author:      "Barry Loewer",
+		Publisher:   "Metro Books",
+		PublishDate: publishDate,
+		Rating:      2.0,
+		Status:      v1.Book_CHECKED_IN,
+		Isbn:        "9780760735408",
+	}
+
+	rec := FromBook(book)
+	if fixed := rec.Control("008"); len(fixed) != 40 || fixed[7:11] != "2002" {
+		t.Errorf("FromBook() 008 = %q", fixed)
+	}
+
+	data, err := Marshal(rec)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	parsed, err := Unmarshal(data)
+	if err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	got, err := ToBook(parsed)
+	if err != nil {
+		t.Fatalf("ToBook() error = %v", err)
+	}
+	// MARC only keeps the year and has no id, rating or status
+	want, _ := ptypes.TimestampProto(time.Date(2002, time.January, 1, 0, 0, 0, 0, time.UTC))
+	book.Id, book.PublishDate, book.Rating, book.Status = 0, want, 0, 0
+	if !reflect.DeepEqual(got, book) {
+		t.Errorf("ToBook(FromBook()) = %v, want %v", got, book)
+	}
+}
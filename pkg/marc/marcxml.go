@@ -0,0 +1,147 @@
+package marc
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+// Namespace of MARCXML documents
+const Namespace = "http://www.loc.gov/MARC21/slim"
+
+type xmlRecord struct {
+	XMLName       xml.Name          `xml:"record"`
+	Leader        string            `xml:"leader"`
+	ControlFields []xmlControlField `xml:"controlfield"`
+	DataFields    []xmlDataField    `xml:"datafield"`
+}
+
+type xmlControlField struct {
+	Tag   string `xml:"tag,attr"`
+	Value string `xml:",chardata"`
+}
+
+type xmlDataField struct {
+	Tag       string        `xml:"tag,attr"`
+	Ind1      string        `xml:"ind1,attr"`
+	Ind2      string        `xml:"ind2,attr"`
+	Subfields []xmlSubfield `xml:"subfield"`
+}
+
+type xmlSubfield struct {
+	Code  string `xml:"code,attr"`
+	Value string `xml:",chardata"`
+}
+
+// XMLReader reads the record elements of a MARCXML collection, or a single record document
+type XMLReader struct {
+	d *xml.Decoder
+}
+
+func NewXMLReader(r io.Reader) *XMLReader {
+	return &XMLReader{d: xml.NewDecoder(r)}
+}
+
+// Read returns the next record or io.EOF once the document is exhausted
+func (r *XMLReader) Read() (*Record, error) {
+	for {
+		tok, err := r.d.Token()
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		if err != nil {
+			return nil, fmt.Errorf("marc: reading MARCXML: %v", err)
+		}
+
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "record" {
+			continue
+		}
+
+		var x xmlRecord
+		if err := r.d.DecodeElement(&x, &start); err != nil {
+			return nil, fmt.Errorf("marc: reading MARCXML record: %v", err)
+		}
+		return fromXML(&x)
+	}
+}
+
+func fromXML(x *xmlRecord) (*Record, error) {
+	rec := &Record{Leader: x.Leader}
+	for _, f := range x.ControlFields {
+		rec.ControlFields = append(rec.ControlFields, ControlField{Tag: f.Tag, Value: f.Value})
+	}
+	for _, f := range x.DataFields {
+		df := DataField{Tag: f.Tag, Ind1: xmlIndicator(f.Ind1), Ind2: xmlIndicator(f.Ind2)}
+		for _, sf := range f.Subfields {
+			if len(sf.Code) != 1 {
+				return nil, fmt.Errorf("marc: field %s has invalid subfield code %q", f.Tag, sf.Code)
+			}
+			df.Subfields = append(df.Subfields, Subfield{Code: sf.Code[0], Value: sf.Value})
+		}
+		rec.DataFields = append(rec.DataFields, df)
+	}
+	return rec, nil
+}
+
+func xmlIndicator(v string) byte {
+	if len(v) == 0 {
+		return ' '
+	}
+	return v[0]
+}
+
+// XMLWriter writes records into a MARCXML collection, Close must be called to end the document
+type XMLWriter struct {
+	w       io.Writer
+	e       *xml.Encoder
+	started bool
+}
+
+func NewXMLWriter(w io.Writer) *XMLWriter {
+	e := xml.NewEncoder(w)
+	e.Indent("", "  ")
+	return &XMLWriter{w: w, e: e}
+}
+
+func (w *XMLWriter) start() error {
+	if w.started {
+		return nil
+	}
+	w.started = true
+	_, err := io.WriteString(w.w, xml.Header+`<collection xmlns="`+Namespace+`">`+"\n")
+	return err
+}
+
+func (w *XMLWriter) Write(rec *Record) error {
+	if err := w.start(); err != nil {
+		return err
+	}
+
+	x := xmlRecord{Leader: rec.Leader}
+	for _, f := range rec.ControlFields {
+		x.ControlFields = append(x.ControlFields, xmlControlField{Tag: f.Tag, Value: f.Value})
+	}
+	for _, f := range rec.DataFields {
+		df := xmlDataField{Tag: f.Tag, Ind1: string(indicator(f.Ind1)), Ind2: string(indicator(f.Ind2))}
+		for _, sf := range f.Subfields {
+			df.Subfields = append(df.Subfields, xmlSubfield{Code: string(sf.Code), Value: sf.Value})
+		}
+		x.DataFields = append(x.DataFields, df)
+	}
+
+	if err := w.e.Encode(&x); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w.w, "\n")
+	return err
+}
+
+// Close ends the collection, an empty collection is written when no record was
+func (w *XMLWriter) Close() error {
+	if err := w.start(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w.w, "</collection>\n")
+	return err
+}
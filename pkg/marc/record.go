@@ -0,0 +1,71 @@
+// Package marc reads and writes MARC21 bibliographic records, both in the ISO 2709
+// transmission format and as MARCXML, and maps them to and from v1.Book.
+package marc
+
+import (
+	"strings"
+)
+
+// Record is a MARC21 record with its fields in the order they were read
+type Record struct {
+	Leader        string
+	ControlFields []ControlField // 001-009
+	DataFields    []DataField    // 010-999
+}
+
+// ControlField holds an unstructured value, e.g. 001 control number or 008 fixed-length data
+type ControlField struct {
+	Tag   string
+	Value string
+}
+
+// DataField holds indicators and subfields, e.g. 245 title statement
+type DataField struct {
+	Tag       string
+	Ind1      byte
+	Ind2      byte
+	Subfields []Subfield
+}
+
+type Subfield struct {
+	Code  byte
+	Value string
+}
+
+// Control returns the value of the first control field with the given tag
+func (r *Record) Control(tag string) string {
+	for _, f := range r.ControlFields {
+		if f.Tag == tag {
+			return f.Value
+		}
+	}
+	return ""
+}
+
+// Field returns the first data field with the given tag
+func (r *Record) Field(tag string) *DataField {
+	for i := range r.DataFields {
+		if r.DataFields[i].Tag == tag {
+			return &r.DataFields[i]
+		}
+	}
+	return nil
+}
+
+// Subfield returns the value of the first subfield with the given code
+func (f *DataField) Subfield(code byte) string {
+	if f == nil {
+		return ""
+	}
+	for _, sf := range f.Subfields {
+		if sf.Code == code {
+			return sf.Value
+		}
+	}
+	return ""
+}
+
+// isControlTag reports whether tag names a control field, 001-009 have no indicators or subfields
+func isControlTag(tag string) bool {
+	return strings.HasPrefix(tag, "00")
+}
@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/radean0909/redeam-rest/pkg/auth"
+)
+
+// AddAuth returns grpc.ServerOptions that require a valid bearer token in the authorization
+// metadata, or an API key in the x-api-key metadata when keys is set, for every call except
+// the listed public methods (e.g. "/grpc.health.v1.Health/Check").
+// The claims of the caller are available to handlers through auth.FromContext.
+func AddAuth(v *auth.Verifier, keys auth.KeyVerifier, public ...string) []grpc.ServerOption {
+	skip := make(map[string]bool, len(public))
+	for _, m := range public {
+		skip[m] = true
+	}
+
+	unary := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if skip[info.FullMethod] {
+			return handler(ctx, req)
+		}
+		ctx, err := authenticate(ctx, v, keys)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+
+	stream := func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if skip[info.FullMethod] {
+			return handler(srv, ss)
+		}
+		ctx, err := authenticate(ss.Context(), v, keys)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(unary),
+		grpc.ChainStreamInterceptor(stream),
+	}
+}
+
+// authenticate validates the API key or bearer token of the call and stores its claims in the context
+func authenticate(ctx context.Context, v *auth.Verifier, keys auth.KeyVerifier) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if vals := md.Get("x-api-key"); len(vals) > 0 && keys != nil {
+		claims, err := keys.VerifyKey(ctx, vals[0])
+		if errors.Is(err, auth.ErrInvalidAPIKey) {
+			return nil, status.Error(codes.Unauthenticated, "invalid API key")
+		}
+		if err != nil {
+			return nil, status.Error(codes.Unavailable, "failed to verify API key: "+err.Error())
+		}
+		return auth.NewContext(ctx, claims), nil
+	}
+
+	vals := md.Get("authorization")
+	if len(vals) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "authorization metadata is missing")
+	}
+
+	const prefix = "bearer "
+	if len(vals[0]) <= len(prefix) || !strings.EqualFold(vals[0][:len(prefix)], prefix) {
+		return nil, status.Error(codes.Unauthenticated, "authorization metadata must be a bearer token")
+	}
+
+	claims, err := v.Verify(vals[0][len(prefix):])
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid token: "+err.Error())
+	}
+	return auth.NewContext(ctx, claims), nil
+}
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/radean0909/redeam-rest/pkg/api/v1"
+	"github.com/radean0909/redeam-rest/pkg/auth"
+)
+
+// fakeKeys accepts a single API key
+type fakeKeys struct {
+	secret string
+	err    error // returned for any other key instead of auth.ErrInvalidAPIKey
+}
+
+func (f fakeKeys) VerifyKey(ctx context.Context, secret string) (*auth.Claims, error) {
+	if secret == f.secret {
+		return &auth.Claims{Roles: []string{"patron"}, RegisteredClaims: jwt.RegisteredClaims{Subject: "apikey:1"}}, nil
+	}
+	if f.err != nil {
+		return nil, f.err
+	}
+	return nil, auth.ErrInvalidAPIKey
+}
+
+func TestAddAuth(t *testing.T) {
+	secret := []byte("sn34kyp4ssw0rD")
+	verifier, err := auth.NewVerifier(secret, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, &auth.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))},
+	}).SignedString(secret)
+
+	withKeys := startServer(t, AddAuth(verifier, fakeKeys{secret: "rdk_valid"})...)
+	keysDown := startServer(t, AddAuth(verifier, fakeKeys{err: errors.New("connection refused")})...)
+	withoutKeys := startServer(t, AddAuth(verifier, nil)...)
+
+	tests := []struct {
+		name   string
+		client v1.BookServiceClient
+		md     []string
+		want   codes.Code
+	}{
+		{"Bearer token", withKeys, []string{"authorization", "Bearer " + token}, codes.Unimplemented},
+		{"Invalid bearer token", withKeys, []string{"authorization", "Bearer x.y.z"}, codes.Unauthenticated},
+		{"Basic credentials", withKeys, []string{"authorization", "Basic amRvZTpzZWNyZXQ="}, codes.Unauthenticated},
+		{"API key", withKeys, []string{"x-api-key", "rdk_valid"}, codes.Unimplemented},
+		{"Unknown API key", withKeys, []string{"x-api-key", "rdk_other"}, codes.Unauthenticated},
+		{"API key store unavailable", keysDown, []string{"x-api-key", "rdk_valid"}, codes.Unavailable},
+		{"API keys not accepted", withoutKeys, []string{"x-api-key", "rdk_valid"}, codes.Unauthenticated},
+		{"No credentials", withKeys, nil, codes.Unauthenticated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			ctx = metadata.AppendToOutgoingContext(ctx, tt.md...)
+
+			_, err := tt.client.Read(ctx, &v1.ReadRequest{Api: "v0", Id: 1})
+			if got := status.Code(err); got != tt.want {
+				t.Errorf("Read() code = %v, want %v (%v)", got, tt.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/radean0909/redeam-rest/pkg/auth"
+)
+
+// AddAuthorization returns grpc.ServerOptions that only let callers whose roles the policy
+// allows reach a method. It relies on the claims stored by AddAuth, which must come first.
+func AddAuthorization(p *auth.Policy, public ...string) []grpc.ServerOption {
+	skip := make(map[string]bool, len(public))
+	for _, m := range public {
+		skip[m] = true
+	}
+
+	unary := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !skip[info.FullMethod] {
+			if err := authorize(ctx, p, info.FullMethod); err != nil {
+				return nil, err
+			}
+		}
+		return handler(ctx, req)
+	}
+
+	stream := func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !skip[info.FullMethod] {
+			if err := authorize(ss.Context(), p, info.FullMethod); err != nil {
+				return err
+			}
+		}
+		return handler(srv, ss)
+	}
+
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(unary),
+		grpc.ChainStreamInterceptor(stream),
+	}
+}
+
+func authorize(ctx context.Context, p *auth.Policy, method string) error {
+	claims, ok := auth.FromContext(ctx)
+	if !ok {
+		return status.Error(codes.Unauthenticated, "caller is not authenticated")
+	}
+	if !p.Allowed(claims.Roles, method) {
+		return status.Error(codes.PermissionDenied, fmt.Sprintf("roles %v may not call %s", claims.Roles, method))
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/radean0909/redeam-rest/pkg/api/v1"
+	"github.com/radean0909/redeam-rest/pkg/auth"
+	service "github.com/radean0909/redeam-rest/pkg/service/v1"
+)
+
+// startServer serves the book service behind the given interceptors.
+// Calls are made with an unsupported API version, so a call that gets through is rejected by the
+// service itself with codes.Unimplemented before it touches the database.
+func startServer(t *testing.T, opts ...grpc.ServerOption) v1.BookServiceClient {
+	server := grpc.NewServer(opts...)
+	v1.RegisterBookServiceServer(server, service.NewBookServiceServer(nil))
+
+	lis := bufconn.Listen(1 << 20)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return v1.NewBookServiceClient(conn)
+}
+
+func TestAddAuthorization(t *testing.T) {
+	secret := []byte("sn34kyp4ssw0rD")
+	verifier, err := auth.NewVerifier(secret, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy, err := auth.LoadPolicy("../../../../configs/policy.yaml")
+	if err != nil {
+		t.Fatalf("LoadPolicy() error = %v", err)
+	}
+	client := startServer(t, append(AddAuth(verifier, nil), AddAuthorization(policy)...)...)
+
+	calls := map[string]func(ctx context.Context) error{
+		"Read": func(ctx context.Context) error {
+			_, err := client.Read(ctx, &v1.ReadRequest{Api: "v0", Id: 1})
+			return err
+		},
+		"ReadAll": func(ctx context.Context) error {
+			_, err := client.ReadAll(ctx, &v1.ReadAllRequest{Api: "v0"})
+			return err
+		},
+		"WatchBooks": func(ctx context.Context) error {
+			stream, err := client.WatchBooks(ctx, &v1.WatchBooksRequest{Api: "v0"})
+			if err != nil {
+				return err
+			}
+			_, err = stream.Recv()
+			return err
+		},
+		"Create": func(ctx context.Context) error {
+			_, err := client.Create(ctx, &v1.CreateRequest{Api: "v0", Book: &v1.Book{}})
+			return err
+		},
+		"Update": func(ctx context.Context) error {
+			_, err := client.Update(ctx, &v1.UpdateRequest{Api: "v0", Book: &v1.Book{Id: 1}})
+			return err
+		},
+		"Delete": func(ctx context.Context) error {
+			_, err := client.Delete(ctx, &v1.DeleteRequest{Api: "v0", Id: 1})
+			return err
+		},
+		"BatchDelete": func(ctx context.Context) error {
+			_, err := client.BatchDelete(ctx, &v1.BatchDeleteRequest{Api: "v0", Ids: []int64{1}})
+			return err
+		},
+		"ExportMarc": func(ctx context.Context) error {
+			stream, err := client.ExportMarc(ctx, &v1.ExportMarcRequest{Api: "v0"})
+			if err != nil {
+				return err
+			}
+			_, err = stream.Recv()
+			return err
+		},
+	}
+
+	tests := []struct {
+		name   string
+		roles  []string
+		method string
+		want   codes.Code
+	}{
+		{"Patron reads", []string{"patron"}, "Read", codes.Unimplemented},
+		{"Patron lists", []string{"patron"}, "ReadAll", codes.Unimplemented},
+		{"Patron watches", []string{"patron"}, "WatchBooks", codes.Unimplemented},
+		{"Patron creates", []string{"patron"}, "Create", codes.PermissionDenied},
+		{"Patron updates", []string{"patron"}, "Update", codes.PermissionDenied},
+		{"Patron deletes", []string{"patron"}, "Delete", codes.PermissionDenied},
+		{"Patron exports", []string{"patron"}, "ExportMarc", codes.PermissionDenied},
+		{"Librarian reads", []string{"librarian"}, "Read", codes.Unimplemented},
+		{"Librarian creates", []string{"librarian"}, "Create", codes.Unimplemented},
+		{"Librarian updates", []string{"librarian"}, "Update", codes.Unimplemented},
+		{"Librarian exports", []string{"librarian"}, "ExportMarc", codes.Unimplemented},
+		{"Librarian deletes", []string{"librarian"}, "Delete", codes.PermissionDenied},
+		{"Librarian batch deletes", []string{"librarian"}, "BatchDelete", codes.PermissionDenied},
+		{"Admin deletes", []string{"admin"}, "Delete", codes.Unimplemented},
+		{"Admin batch deletes", []string{"admin"}, "BatchDelete", codes.Unimplemented},
+		{"Admin watches", []string{"admin"}, "WatchBooks", codes.Unimplemented},
+		{"Roles combine", []string{"patron", "librarian"}, "Create", codes.Unimplemented},
+		{"Unknown role", []string{"guest"}, "Read", codes.PermissionDenied},
+		{"No roles", nil, "Read", codes.PermissionDenied},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &auth.Claims{
+				Roles: tt.roles,
+				RegisteredClaims: jwt.RegisteredClaims{
+					Subject:   "jdoe",
+					ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+				},
+			}).SignedString(secret)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+
+			err = calls[tt.method](ctx)
+			if got := status.Code(err); got != tt.want {
+				t.Errorf("%s() code = %v, want %v (%v)", tt.method, got, tt.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// AddDeadlines returns grpc.ServerOptions that cancel the context of calls running longer than the
+// deadline of their method, so database queries of runaway calls are cancelled too. methods maps full
+// method names to deadlines, other unary methods get def. Streams, e.g. WatchBooks, are only bounded
+// when listed. Zero leaves a method unbounded. Clients may set a shorter deadline, never a longer one.
+func AddDeadlines(def time.Duration, methods map[string]time.Duration) []grpc.ServerOption {
+	unary := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		d, ok := methods[info.FullMethod]
+		if !ok {
+			d = def
+		}
+		if d <= 0 {
+			return handler(ctx, req)
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, d)
+		defer cancel()
+		resp, err := handler(ctx, req)
+		return resp, deadlineError(ctx, err, d)
+	}
+
+	stream := func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		d := methods[info.FullMethod]
+		if d <= 0 {
+			return handler(srv, ss)
+		}
+
+		ctx, cancel := context.WithTimeout(ss.Context(), d)
+		defer cancel()
+		err := handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+		return deadlineError(ctx, err, d)
+	}
+
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(unary),
+		grpc.ChainStreamInterceptor(stream),
+	}
+}
+
+// deadlineError reports a call that failed because its deadline passed as DeadlineExceeded, handlers
+// mostly see it as a failed query and answer Unknown
+func deadlineError(ctx context.Context, err error, d time.Duration) error {
+	if err == nil || ctx.Err() != context.DeadlineExceeded || status.Code(err) == codes.DeadlineExceeded {
+		return err
+	}
+	return status.Error(codes.DeadlineExceeded, "call did not finish within its deadline of "+d.String()+": "+status.Convert(err).Message())
+}
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/radean0909/redeam-rest/pkg/api/v1"
+)
+
+func TestAddDeadlines(t *testing.T) {
+	// waits for the deadline like a slow query would, failing with the error a query would
+	blocks := func(ctx context.Context) error {
+		select {
+		case <-ctx.Done():
+			return status.Error(codes.Unknown, "failed to SELECT: "+ctx.Err().Error())
+		case <-time.After(5 * time.Second):
+			return nil
+		}
+	}
+	srv := &stubServer{read: blocks, watch: blocks}
+
+	tests := []struct {
+		name       string
+		def        time.Duration
+		methods    map[string]time.Duration
+		stream     bool
+		wantServer bool // the server deadline ends the call rather than the client's of 200ms
+	}{
+		{"default", 50 * time.Millisecond, nil, false, true},
+		{"method", time.Hour, map[string]time.Duration{"/v1.BookService/Read": 50 * time.Millisecond}, false, true},
+		{"method unbounded", 50 * time.Millisecond, map[string]time.Duration{"/v1.BookService/Read": 0}, false, false},
+		{"stream listed", time.Hour, map[string]time.Duration{"/v1.BookService/WatchBooks": 50 * time.Millisecond}, true, true},
+		{"stream not listed", 50 * time.Millisecond, nil, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := startStub(t, srv, AddDeadlines(tt.def, tt.methods)...)
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+
+			begin := time.Now()
+			var err error
+			if tt.stream {
+				var stream v1.BookService_WatchBooksClient
+				if stream, err = client.WatchBooks(ctx, &v1.WatchBooksRequest{Api: "v1"}); err == nil {
+					_, err = stream.Recv()
+				}
+			} else {
+				_, err = client.Read(ctx, &v1.ReadRequest{Api: "v1", Id: 1})
+			}
+			if status.Code(err) != codes.DeadlineExceeded {
+				t.Fatalf("error = %v, want DeadlineExceeded", err)
+			}
+			if took := time.Since(begin); tt.wantServer != (took < 150*time.Millisecond) {
+				t.Errorf("call took %v, want it ended by the server deadline: %v", took, tt.wantServer)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/any"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	protov2 "google.golang.org/protobuf/proto"
+
+	"github.com/radean0909/redeam-rest/pkg/auth"
+	"github.com/radean0909/redeam-rest/pkg/idempotency"
+	"github.com/radean0909/redeam-rest/pkg/logger"
+)
+
+const (
+	// IdempotencyKeyMetadata carries the idempotency key of a call, the gateway forwards the
+	// Idempotency-Key header as it
+	IdempotencyKeyMetadata = "idempotency-key"
+	// IdempotentReplayedMetadata is set on responses returned from the store rather than by a new call
+	IdempotentReplayedMetadata = "idempotent-replayed"
+
+	// maxIdempotencyKeyLength bounds the keys clients may send, a UUID takes 36
+	maxIdempotencyKeyLength = 255
+
+	// settleTimeout bounds completing or releasing a key once the call returned
+	settleTimeout = 5 * time.Second
+)
+
+// AddIdempotency returns grpc.ServerOptions that make the listed unary methods idempotent for calls
+// carrying an idempotency key: the response of the first call is kept in store and returned to
+// retries with the same key and request. A key used with a different request is rejected with
+// InvalidArgument, one whose first call is still running with Aborted. Failed calls release their
+// key. Keys are scoped to the method and the authenticated caller, which requires AddAuth ahead of it.
+func AddIdempotency(store idempotency.Store, methods ...string) []grpc.ServerOption {
+	wrap := make(map[string]bool, len(methods))
+	for _, m := range methods {
+		wrap[m] = true
+	}
+
+	unary := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !wrap[info.FullMethod] {
+			return handler(ctx, req)
+		}
+		md, _ := metadata.FromIncomingContext(ctx)
+		vals := md.Get(IdempotencyKeyMetadata)
+		if len(vals) == 0 || vals[0] == "" {
+			return handler(ctx, req)
+		}
+		if len(vals[0]) > maxIdempotencyKeyLength {
+			return nil, status.Errorf(codes.InvalidArgument, "idempotency key must be at most %d characters", maxIdempotencyKeyLength)
+		}
+		return idempotentCall(ctx, store, storeKey(ctx, info.FullMethod, vals[0]), req, handler)
+	}
+
+	return []grpc.ServerOption{grpc.ChainUnaryInterceptor(unary)}
+}
+
+// idempotentCall runs handler once per key and request, replaying its response afterwards
+func idempotentCall(ctx context.Context, store idempotency.Store, key string, req interface{}, handler grpc.UnaryHandler) (interface{}, error) {
+	msg, ok := req.(proto.Message)
+	if !ok {
+		return handler(ctx, req)
+	}
+	hash, err := requestHash(msg)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to hash request: "+err.Error())
+	}
+
+	stored, err := store.Begin(ctx, key, hash)
+	switch {
+	case err == idempotency.ErrMismatch:
+		return nil, status.Error(codes.InvalidArgument, "idempotency key was used with a different request")
+	case err == idempotency.ErrInProgress:
+		return nil, status.Error(codes.Aborted, "a call with this idempotency key is in progress, retry later")
+	case err != nil:
+		return nil, status.Error(codes.Unavailable, "failed to check idempotency key: "+err.Error())
+	case stored != nil:
+		return replay(ctx, stored)
+	}
+
+	resp, err := handler(ctx, req)
+
+	// the outcome must be recorded even when the client went away mid call, otherwise its retry
+	// finds the key in progress until PendingTTL passes
+	sctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), settleTimeout)
+	defer cancel()
+	if err != nil {
+		if rerr := store.Release(sctx, key); rerr != nil {
+			logger.FromContext(ctx, slog.Default()).WarnContext(ctx, "failed to release idempotency key", "error", rerr)
+		}
+		return nil, err
+	}
+	if out, ok := resp.(proto.Message); ok {
+		if err := complete(sctx, store, key, out); err != nil {
+			// the call succeeded, a retry runs it again once the key expires
+			logger.FromContext(ctx, slog.Default()).WarnContext(ctx, "failed to store idempotent response", "error", err)
+		}
+	}
+	return resp, nil
+}
+
+// storeKey scopes key to method and caller, so clients can't read each other's responses
+func storeKey(ctx context.Context, method, key string) string {
+	var subject string
+	if c, ok := auth.FromContext(ctx); ok {
+		subject = c.Subject
+	}
+	sum := sha256.Sum256([]byte(method + "\x00" + subject + "\x00" + key))
+	return hex.EncodeToString(sum[:])
+}
+
+// requestHash tells requests apart, the encoding is deterministic so equal requests hash alike
+func requestHash(msg proto.Message) (string, error) {
+	b, err := protov2.MarshalOptions{Deterministic: true}.Marshal(proto.MessageV2(msg))
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// complete stores resp as an Any, which records its type for the replay
+func complete(ctx context.Context, store idempotency.Store, key string, resp proto.Message) error {
+	a, err := ptypes.MarshalAny(resp)
+	if err != nil {
+		return err
+	}
+	b, err := proto.Marshal(a)
+	if err != nil {
+		return err
+	}
+	return store.Complete(ctx, key, b)
+}
+
+// replay decodes a stored response and marks it as replayed
+func replay(ctx context.Context, stored []byte) (interface{}, error) {
+	var a any.Any
+	if err := proto.Unmarshal(stored, &a); err != nil {
+		return nil, status.Error(codes.Internal, "failed to decode stored response: "+err.Error())
+	}
+	var resp ptypes.DynamicAny
+	if err := ptypes.UnmarshalAny(&a, &resp); err != nil {
+		return nil, status.Error(codes.Internal, "failed to decode stored response: "+err.Error())
+	}
+	grpc.SetHeader(ctx, metadata.Pairs(IdempotentReplayedMetadata, "true"))
+	return resp.Message, nil
+}
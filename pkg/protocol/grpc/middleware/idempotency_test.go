@@ -0,0 +1,139 @@
+package middleware
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/radean0909/redeam-rest/pkg/api/v1"
+	"github.com/radean0909/redeam-rest/pkg/idempotency"
+)
+
+// createServer creates books with increasing ids, failing titles starting with "fail"
+type createServer struct {
+	v1.UnimplementedBookServiceServer
+	calls int64
+}
+
+func (s *createServer) Create(ctx context.Context, req *v1.CreateRequest) (*v1.CreateResponse, error) {
+	s.calls++
+	if strings.HasPrefix(req.Book.Title, "fail") {
+		return nil, status.Error(codes.Unavailable, "database is down")
+	}
+	return &v1.CreateResponse{Api: req.Api, Id: s.calls}, nil
+}
+
+// ctxStore fails calls whose context is done, as a database backed store does
+type ctxStore struct {
+	*idempotency.Memory
+	completed chan struct{}
+}
+
+func (s *ctxStore) Complete(ctx context.Context, key string, response []byte) error {
+	defer close(s.completed)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.Memory.Complete(ctx, key, response)
+}
+
+// slowServer creates a book once the client went away
+type slowServer struct {
+	v1.UnimplementedBookServiceServer
+	started chan struct{}
+}
+
+func (s *slowServer) Create(ctx context.Context, req *v1.CreateRequest) (*v1.CreateResponse, error) {
+	close(s.started)
+	<-ctx.Done()
+	return &v1.CreateResponse{Api: req.Api, Id: 1}, nil
+}
+
+func TestAddIdempotency(t *testing.T) {
+	srv := &createServer{}
+	c := startStub(t, srv, AddIdempotency(idempotency.NewMemory(time.Hour), "/v1.BookService/Create")...)
+
+	create := func(key, title string) (*v1.CreateResponse, metadata.MD, error) {
+		ctx := context.Background()
+		if key != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, IdempotencyKeyMetadata, key)
+		}
+		var header metadata.MD
+		resp, err := c.Create(ctx, &v1.CreateRequest{Api: "v1", Book: &v1.Book{Title: title}}, grpc.Header(&header))
+		return resp, header, err
+	}
+
+	tests := []struct {
+		name         string
+		key          string
+		title        string
+		wantId       int64
+		wantCode     codes.Code
+		wantReplayed bool
+	}{
+		{"first call", "k1", "The Hobbit", 1, codes.OK, false},
+		{"retry", "k1", "The Hobbit", 1, codes.OK, true},
+		{"other request", "k1", "Dune", 0, codes.InvalidArgument, false},
+		{"no key", "", "The Hobbit", 2, codes.OK, false},
+		{"no key again", "", "The Hobbit", 3, codes.OK, false},
+		{"failed call", "k2", "failing", 0, codes.Unavailable, false},
+		{"retry of failed call", "k2", "failing", 0, codes.Unavailable, false},
+		{"long key", strings.Repeat("k", 256), "Dune", 0, codes.InvalidArgument, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, header, err := create(tt.key, tt.title)
+			if code := status.Code(err); code != tt.wantCode {
+				t.Fatalf("Create() code = %v, want %v", code, tt.wantCode)
+			}
+			if err != nil {
+				return
+			}
+			if resp.Id != tt.wantId {
+				t.Errorf("Create() id = %d, want %d", resp.Id, tt.wantId)
+			}
+			if replayed := len(header.Get(IdempotentReplayedMetadata)) > 0; replayed != tt.wantReplayed {
+				t.Errorf("replayed = %v, want %v", replayed, tt.wantReplayed)
+			}
+		})
+	}
+	// the failed call ran twice, the replayed one once
+	if srv.calls != 5 {
+		t.Errorf("Create ran %d times, want 5", srv.calls)
+	}
+}
+
+func TestAddIdempotency_Cancelled(t *testing.T) {
+	store := &ctxStore{Memory: idempotency.NewMemory(time.Hour), completed: make(chan struct{})}
+	srv := &slowServer{started: make(chan struct{})}
+	c := startStub(t, srv, AddIdempotency(store, "/v1.BookService/Create")...)
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), IdempotencyKeyMetadata, "k1")
+	req := &v1.CreateRequest{Api: "v1", Book: &v1.Book{Title: "The Hobbit"}}
+
+	cctx, cancel := context.WithCancel(ctx)
+	go func() {
+		<-srv.started
+		cancel()
+	}()
+	if _, err := c.Create(cctx, req); status.Code(err) != codes.Canceled {
+		t.Fatalf("Create() error = %v, want Canceled", err)
+	}
+	<-store.completed
+
+	// the call finished after the client left, its retry gets the stored response
+	var header metadata.MD
+	resp, err := c.Create(ctx, req, grpc.Header(&header))
+	if err != nil {
+		t.Fatalf("retry error = %v", err)
+	}
+	if resp.Id != 1 || len(header.Get(IdempotentReplayedMetadata)) == 0 {
+		t.Errorf("retry = %v, replayed %v, want the stored response", resp, header.Get(IdempotentReplayedMetadata))
+	}
+}
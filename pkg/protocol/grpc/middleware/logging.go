@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/radean0909/redeam-rest/pkg/logger"
+)
+
+// AddLogging returns grpc.ServerOptions logging every call with its method, duration, status code,
+// peer and request ID. The ID is taken from the x-request-id metadata or generated, sent back in the
+// response header and attached to the logger handlers get from logger.FromContext.
+func AddLogging(l *slog.Logger) []grpc.ServerOption {
+	unary := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, done := startCall(ctx, l, info.FullMethod)
+		resp, err := handler(ctx, req)
+		done(err)
+		return resp, err
+	}
+
+	stream := func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, done := startCall(ss.Context(), l, info.FullMethod)
+		err := handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+		done(err)
+		return err
+	}
+
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(unary),
+		grpc.ChainStreamInterceptor(stream),
+	}
+}
+
+// startCall sets up the request ID and logger of a call and returns the func logging its outcome
+func startCall(ctx context.Context, l *slog.Logger, method string) (context.Context, func(error)) {
+	begin := time.Now()
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	var id string
+	if vals := md.Get(logger.RequestIDMetadata); len(vals) > 0 {
+		id = vals[0]
+	}
+	id = logger.RequestID(id)
+	grpc.SetHeader(ctx, metadata.Pairs(logger.RequestIDMetadata, id))
+
+	l = l.With("request_id", id)
+	if p, ok := peer.FromContext(ctx); ok {
+		l = l.With("peer", p.Addr.String())
+	}
+	ctx = logger.NewContext(ctx, l)
+
+	return ctx, func(err error) {
+		code := status.Code(err)
+		attrs := []any{
+			"method", method,
+			"code", code.String(),
+			"duration", time.Since(begin),
+		}
+		if err != nil {
+			attrs = append(attrs, "error", status.Convert(err).Message())
+		}
+		l.Log(ctx, levelOf(code), "finished call", attrs...)
+	}
+}
+
+// levelOf logs failures of the server itself as errors, and calls that were handled as intended,
+// including rejected requests, as info
+func levelOf(code codes.Code) slog.Level {
+	switch code {
+	case codes.Unknown, codes.DeadlineExceeded, codes.Internal, codes.Unavailable, codes.DataLoss:
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/radean0909/redeam-rest/pkg/api/v1"
+)
+
+func TestAddLogging(t *testing.T) {
+	var buf bytes.Buffer
+	client := startServer(t, AddLogging(slog.New(slog.NewJSONHandler(&buf, nil)))...)
+
+	tests := []struct {
+		name   string
+		id     string
+		wantID string // empty when a new ID must be generated
+	}{
+		{"Propagated ID", "3f2a9c", "3f2a9c"},
+		{"Generated ID", "", ""},
+		{"Unusable ID", "bad id", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if tt.id != "" {
+				ctx = metadata.AppendToOutgoingContext(ctx, "x-request-id", tt.id)
+			}
+
+			var header metadata.MD
+			client.Read(ctx, &v1.ReadRequest{Api: "v0", Id: 1}, grpc.Header(&header))
+
+			echoed := header.Get("x-request-id")
+			if len(echoed) != 1 || (tt.wantID != "" && echoed[0] != tt.wantID) || (tt.wantID == "" && (echoed[0] == "" || echoed[0] == tt.id)) {
+				t.Fatalf("Read() x-request-id header = %v, want %q", echoed, tt.wantID)
+			}
+
+			var entry map[string]interface{}
+			if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+				t.Fatalf("log entry %q: %v", buf.String(), err)
+			}
+			want := map[string]interface{}{
+				"level":      "INFO",
+				"method":     "/v1.BookService/Read",
+				"code":       "Unimplemented",
+				"request_id": echoed[0],
+			}
+			for k, v := range want {
+				if entry[k] != v {
+					t.Errorf("log entry %s = %v, want %v", k, entry[k], v)
+				}
+			}
+			if _, ok := entry["duration"]; !ok || !strings.HasPrefix(entry["peer"].(string), "bufconn") {
+				t.Errorf("log entry %v lacks duration or peer", entry)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+type rpcMetrics struct {
+	started  *prometheus.CounterVec
+	handled  *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+// AddMetrics returns grpc.ServerOptions counting started and handled RPCs by method and status code
+// and recording their latency in reg. Add them first so calls rejected by later interceptors are counted.
+func AddMetrics(reg prometheus.Registerer) []grpc.ServerOption {
+	m := &rpcMetrics{
+		started: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_server_started_total",
+			Help: "Total number of RPCs started on the server.",
+		}, []string{"grpc_type", "grpc_service", "grpc_method"}),
+		handled: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_server_handled_total",
+			Help: "Total number of RPCs completed on the server, regardless of success or failure.",
+		}, []string{"grpc_type", "grpc_service", "grpc_method", "grpc_code"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "grpc_server_handling_seconds",
+			Help:    "Latency of RPCs handled by the server, streams last until they are closed.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"grpc_type", "grpc_service", "grpc_method"}),
+	}
+	reg.MustRegister(m.started, m.handled, m.duration)
+
+	unary := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		done := m.start("unary", info.FullMethod)
+		resp, err := handler(ctx, req)
+		done(err)
+		return resp, err
+	}
+
+	stream := func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		typ := "bidi_stream"
+		switch {
+		case info.IsClientStream && !info.IsServerStream:
+			typ = "client_stream"
+		case !info.IsClientStream && info.IsServerStream:
+			typ = "server_stream"
+		}
+		done := m.start(typ, info.FullMethod)
+		err := handler(srv, ss)
+		done(err)
+		return err
+	}
+
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(unary),
+		grpc.ChainStreamInterceptor(stream),
+	}
+}
+
+// start counts a started call and returns the func recording its outcome
+func (m *rpcMetrics) start(typ, fullMethod string) func(error) {
+	service, method := splitMethod(fullMethod)
+	m.started.WithLabelValues(typ, service, method).Inc()
+	begin := time.Now()
+
+	return func(err error) {
+		m.handled.WithLabelValues(typ, service, method, status.Code(err).String()).Inc()
+		m.duration.WithLabelValues(typ, service, method).Observe(time.Since(begin).Seconds())
+	}
+}
+
+// splitMethod turns "/v1.BookService/Read" into "v1.BookService" and "Read"
+func splitMethod(fullMethod string) (string, string) {
+	fullMethod = strings.TrimPrefix(fullMethod, "/")
+	if i := strings.Index(fullMethod, "/"); i >= 0 {
+		return fullMethod[:i], fullMethod[i+1:]
+	}
+	return "unknown", fullMethod
+}
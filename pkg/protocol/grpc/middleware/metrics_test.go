@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/radean0909/redeam-rest/pkg/api/v1"
+)
+
+func TestAddMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	client := startServer(t, AddMetrics(reg)...)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for i := 0; i < 2; i++ {
+		client.Read(ctx, &v1.ReadRequest{Api: "v0", Id: 1})
+	}
+	stream, err := client.WatchBooks(ctx, &v1.WatchBooksRequest{Api: "v0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.Recv()
+
+	want := `
+# HELP grpc_server_handled_total Total number of RPCs completed on the server, regardless of success or failure.
+# TYPE grpc_server_handled_total counter
+grpc_server_handled_total{grpc_code="Unimplemented",grpc_method="Read",grpc_service="v1.BookService",grpc_type="unary"} 2
+grpc_server_handled_total{grpc_code="Unimplemented",grpc_method="WatchBooks",grpc_service="v1.BookService",grpc_type="server_stream"} 1
+# HELP grpc_server_started_total Total number of RPCs started on the server.
+# TYPE grpc_server_started_total counter
+grpc_server_started_total{grpc_method="Read",grpc_service="v1.BookService",grpc_type="unary"} 2
+grpc_server_started_total{grpc_method="WatchBooks",grpc_service="v1.BookService",grpc_type="server_stream"} 1
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(want), "grpc_server_handled_total", "grpc_server_started_total"); err != nil {
+		t.Error(err)
+	}
+	if n, err := testutil.GatherAndCount(reg, "grpc_server_handling_seconds"); err != nil || n != 2 {
+		t.Errorf("grpc_server_handling_seconds series = %d, %v, want 2", n, err)
+	}
+}
+
+func Test_splitMethod(t *testing.T) {
+	tests := []struct {
+		fullMethod  string
+		wantService string
+		wantMethod  string
+	}{
+		{"/v1.BookService/Read", "v1.BookService", "Read"},
+		{"/grpc.health.v1.Health/Check", "grpc.health.v1.Health", "Check"},
+		{"Read", "unknown", "Read"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fullMethod, func(t *testing.T) {
+			service, method := splitMethod(tt.fullMethod)
+			if service != tt.wantService || method != tt.wantMethod {
+				t.Errorf("splitMethod() = %s, %s, want %s, %s", service, method, tt.wantService, tt.wantMethod)
+			}
+		})
+	}
+}
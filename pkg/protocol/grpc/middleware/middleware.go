@@ -0,0 +1,18 @@
+// Package middleware contains the interceptors wrapped around the gRPC server.
+package middleware
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+// serverStream overrides the context of a stream so interceptors can pass values to handlers
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/golang/protobuf/ptypes"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/radean0909/redeam-rest/pkg/auth"
+	"github.com/radean0909/redeam-rest/pkg/ratelimit"
+)
+
+// AddRateLimit returns grpc.ServerOptions that reject calls over the limits of l with
+// ResourceExhausted and a RetryInfo detail, except for the listed public methods.
+// Callers are identified by the subject of their token or API key, which requires AddAuth
+// ahead of it, and by IP address otherwise.
+func AddRateLimit(l *ratelimit.Limiter, public ...string) []grpc.ServerOption {
+	skip := make(map[string]bool, len(public))
+	for _, m := range public {
+		skip[m] = true
+	}
+
+	unary := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !skip[info.FullMethod] {
+			if err := allow(ctx, l, info.FullMethod); err != nil {
+				return nil, err
+			}
+		}
+		return handler(ctx, req)
+	}
+
+	stream := func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !skip[info.FullMethod] {
+			if err := allow(ss.Context(), l, info.FullMethod); err != nil {
+				return err
+			}
+		}
+		return handler(srv, ss)
+	}
+
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(unary),
+		grpc.ChainStreamInterceptor(stream),
+	}
+}
+
+// allow takes a token for the caller of method
+func allow(ctx context.Context, l *ratelimit.Limiter, method string) error {
+	ok, wait := l.Allow(method, client(ctx))
+	if ok {
+		return nil
+	}
+
+	st, err := status.New(codes.ResourceExhausted, fmt.Sprintf("rate limit exceeded, retry in %v", wait)).
+		WithDetails(&errdetails.RetryInfo{RetryDelay: ptypes.DurationProto(wait)})
+	if err != nil {
+		return status.Error(codes.ResourceExhausted, "rate limit exceeded")
+	}
+	return st.Err()
+}
+
+// client identifies the caller for rate limiting. The gateway dials the gRPC server over loopback, or
+// in memory in single port mode, and passes the address of its own client in x-forwarded-for, which is
+// trusted from those peers only.
+func client(ctx context.Context) string {
+	if c, ok := auth.FromContext(ctx); ok && c.Subject != "" {
+		return "sub:" + c.Subject
+	}
+
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "ip:unknown"
+	}
+	ip := p.Addr.String()
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	if addr := net.ParseIP(ip); addr == nil || addr.IsLoopback() {
+		md, _ := metadata.FromIncomingContext(ctx)
+		if vals := md.Get("x-forwarded-for"); len(vals) > 0 {
+			// the gateway appends its client last, earlier entries are whatever the client sent
+			hops := strings.Split(vals[len(vals)-1], ",")
+			ip = strings.TrimSpace(hops[len(hops)-1])
+		}
+	}
+	return "ip:" + ip
+}
@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/radean0909/redeam-rest/pkg/api/v1"
+	"github.com/radean0909/redeam-rest/pkg/auth"
+	"github.com/radean0909/redeam-rest/pkg/ratelimit"
+)
+
+func TestAddRateLimit(t *testing.T) {
+	l, err := ratelimit.New(ratelimit.Config{
+		Methods: map[string]ratelimit.Limit{"/v1.BookService/ReadAll": {Rate: 0.001, Burst: 1}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := startServer(t, AddRateLimit(l)...)
+	ctx := context.Background()
+
+	if _, err := client.ReadAll(ctx, &v1.ReadAllRequest{Api: "v0"}); status.Code(err) != codes.Unimplemented {
+		t.Fatalf("first ReadAll() error = %v, want Unimplemented", err)
+	}
+	_, err = client.ReadAll(ctx, &v1.ReadAllRequest{Api: "v0"})
+	st := status.Convert(err)
+	if st.Code() != codes.ResourceExhausted {
+		t.Fatalf("second ReadAll() error = %v, want ResourceExhausted", err)
+	}
+	var info *errdetails.RetryInfo
+	for _, d := range st.Details() {
+		if ri, ok := d.(*errdetails.RetryInfo); ok {
+			info = ri
+		}
+	}
+	if info == nil || info.RetryDelay.GetSeconds() < 900 {
+		t.Errorf("second ReadAll() RetryInfo = %v, want a delay of about 1000s", info)
+	}
+
+	// other methods are not limited
+	if _, err := client.Read(ctx, &v1.ReadRequest{Api: "v0"}); status.Code(err) != codes.Unimplemented {
+		t.Errorf("Read() error = %v, want Unimplemented", err)
+	}
+}
+
+func TestClient(t *testing.T) {
+	loopback := &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 51234}}
+	inMemory := &peer.Peer{Addr: bufconn.Listen(1).Addr()}
+	remote := &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(203, 0, 113, 7), Port: 51234}}
+	forwarded := metadata.Pairs("x-forwarded-for", "10.1.1.1, 198.51.100.2")
+
+	tests := []struct {
+		name   string
+		claims *auth.Claims
+		peer   *peer.Peer
+		md     metadata.MD
+		want   string
+	}{
+		{"subject", &auth.Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: "apikey:1"}}, remote, nil, "sub:apikey:1"},
+		{"peer", nil, remote, nil, "ip:203.0.113.7"},
+		{"forwarded by the gateway", nil, loopback, forwarded, "ip:198.51.100.2"},
+		{"forwarded in memory", nil, inMemory, forwarded, "ip:198.51.100.2"},
+		{"forwarded by a remote peer", nil, remote, forwarded, "ip:203.0.113.7"},
+		{"no peer", nil, nil, nil, "ip:unknown"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.claims != nil {
+				ctx = auth.NewContext(ctx, tt.claims)
+			}
+			if tt.peer != nil {
+				ctx = peer.NewContext(ctx, tt.peer)
+			}
+			if tt.md != nil {
+				ctx = metadata.NewIncomingContext(ctx, tt.md)
+			}
+			if got := client(ctx); got != tt.want {
+				t.Errorf("client() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/radean0909/redeam-rest/pkg/logger"
+)
+
+// AddRecovery returns grpc.ServerOptions that turn a panic of a handler, or of an interceptor after
+// it in the chain, into a codes.Internal error and log it with its stack. The server keeps serving.
+func AddRecovery(l *slog.Logger) []grpc.ServerOption {
+	unary := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		defer recoverCall(ctx, l, info.FullMethod, &err)
+		return handler(ctx, req)
+	}
+
+	stream := func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer recoverCall(ss.Context(), l, info.FullMethod, &err)
+		return handler(srv, ss)
+	}
+
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(unary),
+		grpc.ChainStreamInterceptor(stream),
+	}
+}
+
+// recoverCall replaces *err when the call panicked, the panic value stays in the log and isn't sent to the client
+func recoverCall(ctx context.Context, l *slog.Logger, method string, err *error) {
+	p := recover()
+	if p == nil {
+		return
+	}
+	logger.FromContext(ctx, l).ErrorContext(ctx, "panic in call",
+		"method", method,
+		"panic", fmt.Sprint(p),
+		"stack", string(debug.Stack()),
+	)
+	*err = status.Error(codes.Internal, "internal error")
+}
@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/radean0909/redeam-rest/pkg/api/v1"
+)
+
+// stubServer runs the given handlers for Read and WatchBooks
+type stubServer struct {
+	v1.UnimplementedBookServiceServer
+	read  func(ctx context.Context) error
+	watch func(ctx context.Context) error
+}
+
+func (s *stubServer) Read(ctx context.Context, req *v1.ReadRequest) (*v1.ReadResponse, error) {
+	if err := s.read(ctx); err != nil {
+		return nil, err
+	}
+	return &v1.ReadResponse{Api: req.Api}, nil
+}
+
+func (s *stubServer) WatchBooks(req *v1.WatchBooksRequest, stream v1.BookService_WatchBooksServer) error {
+	return s.watch(stream.Context())
+}
+
+func startStub(t *testing.T, srv v1.BookServiceServer, opts ...grpc.ServerOption) v1.BookServiceClient {
+	server := grpc.NewServer(opts...)
+	v1.RegisterBookServiceServer(server, srv)
+
+	lis := bufconn.Listen(1 << 20)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return v1.NewBookServiceClient(conn)
+}
+
+func TestAddRecovery(t *testing.T) {
+	var buf bytes.Buffer
+	panics := func(ctx context.Context) error {
+		var book *v1.Book
+		_ = book.PublishDate.Seconds // nil dereference
+		return nil
+	}
+	client := startStub(t, &stubServer{read: panics, watch: panics}, AddRecovery(slog.New(slog.NewJSONHandler(&buf, nil)))...)
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{"unary", func() error {
+			_, err := client.Read(ctx, &v1.ReadRequest{Api: "v1", Id: 1})
+			return err
+		}},
+		{"stream", func() error {
+			stream, err := client.WatchBooks(ctx, &v1.WatchBooksRequest{Api: "v1"})
+			if err != nil {
+				return err
+			}
+			_, err = stream.Recv()
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			err := tt.call()
+			if st := status.Convert(err); st.Code() != codes.Internal || strings.Contains(st.Message(), "nil pointer") {
+				t.Errorf("error = %v, want Internal without the panic", err)
+			}
+			if !strings.Contains(buf.String(), "nil pointer dereference") || !strings.Contains(buf.String(), "goroutine") {
+				t.Errorf("log = %s, want the panic and its stack", buf.String())
+			}
+		})
+	}
+
+	// the server is still up
+	client = startStub(t, &stubServer{read: func(context.Context) error { return nil }}, AddRecovery(slog.Default())...)
+	if _, err := client.Read(ctx, &v1.ReadRequest{Api: "v1", Id: 1}); err != nil {
+		t.Errorf("Read() error = %v", err)
+	}
+}
@@ -4,39 +4,85 @@ import (
 	"context"
 	"log"
 	"net"
-	"os"
-	"os/signal"
 
 	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/test/bufconn"
 
 	"github.com/radean0909/redeam-rest/pkg/api/v1"
 )
 
-// RunServer gRPC service to publish Book service
-func RunServer(ctx context.Context, v1API v1.BookServiceServer, port string) error {
+// Reflection lists the reflection methods, they only describe the API and need no credentials
+var Reflection = []string{
+	"/grpc.reflection.v1.ServerReflection/ServerReflectionInfo",
+	"/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo",
+}
+
+// NewServer gRPC service to publish Book, ApiKey and Health services, opts carry the interceptors configured by the caller.
+// The ApiKey service is left out when keyAPI is nil.
+func NewServer(v1API v1.BookServiceServer, keyAPI v1.ApiKeyServiceServer, healthAPI healthpb.HealthServer, opts ...grpc.ServerOption) *grpc.Server {
+	server := grpc.NewServer(opts...)
+	v1.RegisterBookServiceServer(server, v1API)
+	if keyAPI != nil {
+		v1.RegisterApiKeyServiceServer(server, keyAPI)
+	}
+	healthpb.RegisterHealthServer(server, healthAPI)
+	// lets tools like grpcurl discover the services without the proto files
+	reflection.Register(server)
+	return server
+}
+
+// inProcessBufSize is the buffer of in-process connections, calls larger than it block until it is read
+const inProcessBufSize = 1 << 20
+
+// DialInProcess serves server on an in-memory listener and connects to it, calls skip the network but
+// pass the interceptors of server like any other. The listener closes when server stops.
+func DialInProcess(ctx context.Context, server *grpc.Server, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	lis := bufconn.Listen(inProcessBufSize)
+	go server.Serve(lis)
+
+	dialer := func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	}
+	opts = append([]grpc.DialOption{grpc.WithContextDialer(dialer), grpc.WithInsecure()}, opts...)
+	return grpc.DialContext(ctx, "inprocess", opts...)
+}
+
+// RunServer serves server on port until it is stopped
+func RunServer(server *grpc.Server, port string) error {
 	listen, err := net.Listen("tcp", ":"+port)
 	if err != nil {
 		return err
 	}
 
-	server := grpc.NewServer()
-	v1.RegisterBookServiceServer(server, v1API)
-
-	// graceful shutdown
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
-	go func() {
-		for range c {
-			// sig is a ^C, handle it
-			log.Println("shutting down gRPC server...")
+	log.Println("starting gRPC server on port: " + port)
+	if err := server.Serve(listen); err != grpc.ErrServerStopped {
+		return err
+	}
+	// stopped before it started serving
+	return nil
+}
 
-			server.GracefulStop()
+// Shutdown stops accepting RPCs and waits for the running ones, those still running when ctx is done
+// are cancelled. Streams like WatchBooks never end on their own, so a deadline is expected. It is for
+// servers serving a listener only: GracefulStop can't drain calls served through ServeHTTP, servers of
+// the single-port gateway are stopped by its Shutdown.
+func Shutdown(ctx context.Context, server *grpc.Server) error {
+	log.Println("shutting down gRPC server...")
 
-			<-ctx.Done()
-		}
+	done := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(done)
 	}()
 
-	// start gRPC server
-	log.Println("starting gRPC server on port: " + port)
-	return server.Serve(listen)
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		server.Stop()
+		<-done
+		return ctx.Err()
+	}
 }
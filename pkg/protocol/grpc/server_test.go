@@ -0,0 +1,151 @@
+package grpc
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+
+	"github.com/radean0909/redeam-rest/pkg/api/v1"
+)
+
+func TestShutdown(t *testing.T) {
+	tests := []struct {
+		name    string
+		stream  bool // keep a Watch stream open, GracefulStop waits for it forever
+		timeout time.Duration
+		wantErr bool
+	}{
+		{"idle", false, time.Second, false},
+		{"open stream", true, 100 * time.Millisecond, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := grpc.NewServer()
+			healthpb.RegisterHealthServer(server, grpchealth.NewServer())
+			lis, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			served := make(chan error, 1)
+			go func() { served <- server.Serve(lis) }()
+
+			if tt.stream {
+				conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer conn.Close()
+				stream, err := healthpb.NewHealthClient(conn).Watch(context.Background(), &healthpb.HealthCheckRequest{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := stream.Recv(); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+			if err := Shutdown(ctx, server); (err != nil) != tt.wantErr {
+				t.Errorf("Shutdown() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			// Shutdown may win the race against Serve starting, RunServer treats that as a clean stop
+			if err := <-served; err != nil && err != grpc.ErrServerStopped {
+				t.Errorf("Serve() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestReflection(t *testing.T) {
+	tests := []struct {
+		name    string
+		keyAPI  v1.ApiKeyServiceServer
+		want    []string
+		notWant string
+	}{
+		{"with API keys", &v1.UnimplementedApiKeyServiceServer{}, []string{"v1.BookService", "v1.ApiKeyService", "grpc.health.v1.Health"}, ""},
+		{"without API keys", nil, []string{"v1.BookService", "grpc.health.v1.Health"}, "v1.ApiKeyService"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := listServices(t, NewServer(nil, tt.keyAPI, grpchealth.NewServer()))
+			for _, want := range tt.want {
+				if !got[want] {
+					t.Errorf("ListServices() = %v, missing %s", got, want)
+				}
+			}
+			if got[tt.notWant] {
+				t.Errorf("ListServices() = %v, want no %s", got, tt.notWant)
+			}
+		})
+	}
+}
+
+// listServices serves server and lists its services through reflection
+func listServices(t *testing.T, server *grpc.Server) map[string]bool {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(lis)
+	defer server.Stop()
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	stream, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := &reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{},
+	}
+	if err := stream.Send(req); err != nil {
+		t.Fatal(err)
+	}
+	res, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]bool)
+	for _, s := range res.GetListServicesResponse().GetService() {
+		got[s.Name] = true
+	}
+	return got
+}
+
+func TestDialInProcess(t *testing.T) {
+	var intercepted string
+	server := grpc.NewServer(grpc.ChainUnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		intercepted = info.FullMethod
+		return handler(ctx, req)
+	}))
+	healthpb.RegisterHealthServer(server, grpchealth.NewServer())
+	defer server.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := DialInProcess(ctx, server)
+	if err != nil {
+		t.Fatalf("DialInProcess() error = %v", err)
+	}
+	defer conn.Close()
+
+	res, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil || res.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("Check() = %v, %v, want SERVING", res, err)
+	}
+	if intercepted != "/grpc.health.v1.Health/Check" {
+		t.Errorf("intercepted %q, want the interceptors to see the call", intercepted)
+	}
+}
@@ -0,0 +1,80 @@
+package rest
+
+import (
+	"net/http"
+	"strings"
+)
+
+// conditional answers GET and HEAD requests whose If-None-Match shows the client already holds the
+// response with 304 Not Modified and no body. If-Modified-Since is not honored: Last-Modified has
+// whole seconds, a change committed within the second of the response would go unnoticed.
+func conditional(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead || r.Header.Get("If-None-Match") == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(&conditionalWriter{ResponseWriter: w, r: r}, r)
+	})
+}
+
+// notModified reports whether the ETag in h matches one the client sent with r
+func notModified(r *http.Request, h http.Header) bool {
+	etag := h.Get("ETag")
+	if etag == "" {
+		return false
+	}
+	for _, tag := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || weakMatch(tag, etag) {
+			return true
+		}
+	}
+	return false
+}
+
+// weakMatch compares entity tags ignoring their weak marks
+func weakMatch(a, b string) bool {
+	return strings.TrimPrefix(a, "W/") == strings.TrimPrefix(b, "W/")
+}
+
+// conditionalWriter turns a 200 response into 304 Not Modified when the client's validators
+// match, dropping the body
+type conditionalWriter struct {
+	http.ResponseWriter
+	r           *http.Request
+	wroteHeader bool
+	discard     bool
+}
+
+func (w *conditionalWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	if code == http.StatusOK && notModified(w.r, w.Header()) {
+		w.discard = true
+		h := w.Header()
+		h.Del("Content-Type")
+		h.Del("Content-Length")
+		code = http.StatusNotModified
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *conditionalWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.discard {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *conditionalWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok && !w.discard {
+		f.Flush()
+	}
+}
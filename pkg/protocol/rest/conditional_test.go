@@ -0,0 +1,82 @@
+package rest
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestConditional(t *testing.T) {
+	const (
+		etag     = `W/"5d41402abc4b2a76"`
+		modified = "Wed, 01 Jan 2020 10:00:00 GMT"
+	)
+	h := conditional(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", modified)
+		io.WriteString(w, `{"api":"v1"}`)
+	}))
+
+	tests := []struct {
+		name     string
+		method   string
+		header   map[string]string
+		wantCode int
+	}{
+		{"unconditional", http.MethodGet, nil, http.StatusOK},
+		{"etag matches", http.MethodGet, map[string]string{"If-None-Match": etag}, http.StatusNotModified},
+		{"strong etag matches weakly", http.MethodGet, map[string]string{"If-None-Match": `"5d41402abc4b2a76"`}, http.StatusNotModified},
+		{"etag in list", http.MethodHead, map[string]string{"If-None-Match": `"other", ` + etag}, http.StatusNotModified},
+		{"any etag", http.MethodGet, map[string]string{"If-None-Match": "*"}, http.StatusNotModified},
+		{"etag differs", http.MethodGet, map[string]string{"If-None-Match": `"other"`}, http.StatusOK},
+		{"etag wins over date", http.MethodGet, map[string]string{"If-None-Match": `"other"`, "If-Modified-Since": modified}, http.StatusOK},
+		// a change within the second of Last-Modified would look unmodified, only the ETag is trusted
+		{"date alone", http.MethodGet, map[string]string{"If-Modified-Since": modified}, http.StatusOK},
+		{"etag matches with later date", http.MethodGet, map[string]string{"If-None-Match": etag, "If-Modified-Since": "Wed, 01 Jan 2020 09:59:59 GMT"}, http.StatusNotModified},
+		{"not a read", http.MethodPut, map[string]string{"If-None-Match": etag}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/v1/book/1", nil)
+			for k, v := range tt.header {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("code = %d, want %d", w.Code, tt.wantCode)
+			}
+			if tt.wantCode == http.StatusNotModified {
+				if w.Body.Len() != 0 {
+					t.Errorf("body = %q, want none", w.Body.String())
+				}
+				if got := w.Header().Get("ETag"); got != etag {
+					t.Errorf("ETag = %q, want %q", got, etag)
+				}
+				if got := w.Header().Get("Content-Type"); got != "" {
+					t.Errorf("Content-Type = %q, want none", got)
+				}
+			}
+		})
+	}
+}
+
+func TestOutgoingHeaderMatcher(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"etag", "ETag"},
+		{"last-modified", "Last-Modified"},
+		{"idempotent-replayed", "Idempotent-Replayed"},
+		{"x-trace", "Grpc-Metadata-x-trace"},
+	}
+	for _, tt := range tests {
+		if got, ok := outgoingHeaderMatcher(tt.key); !ok || got != tt.want {
+			t.Errorf("outgoingHeaderMatcher(%s) = %s, %v, want %s", tt.key, got, ok, tt.want)
+		}
+	}
+}
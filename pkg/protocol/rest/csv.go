@@ -0,0 +1,352 @@
+package rest
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/radean0909/redeam-rest/pkg/api/v1"
+	"github.com/radean0909/redeam-rest/pkg/logger"
+)
+
+const (
+	apiVersion = "v1"
+
+	maxUploadSize  = 32 << 20 // 32MB
+	exportPageSize = 500      // books read per ReadAll call on export
+	csvDateLayout  = "2006-01-02"
+	csvContentType = "text/csv; charset=utf-8"
+)
+
+// csvColumns is the column order written on export, import accepts them in any order
+var csvColumns = []string{"id", "title", "author", "publisher", "publish_date", "rating", "status", "isbn",
+	"created_at", "updated_at", "created_by", "updated_by"}
+
+// csvHandler serves CSV import and export on top of the book service
+type csvHandler struct {
+	client v1.BookServiceClient
+	log    *slog.Logger
+}
+
+// rowError reports a CSV row that could not be imported, rows are numbered like in a spreadsheet
+type rowError struct {
+	Row     int    `json:"row"`
+	Message string `json:"message"`
+}
+
+type importReport struct {
+	Api      string     `json:"api"`
+	DryRun   bool       `json:"dry_run"`
+	Received int64      `json:"received"`
+	Imported int64      `json:"imported"`
+	Errors   []rowError `json:"errors"`
+}
+
+// export writes every book as CSV, those updated since the updated_since query parameter when it is set.
+// Books are read page by page and written as each page arrives.
+func (h *csvHandler) export(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	req := &v1.ReadAllRequest{Api: apiVersion, PageSize: exportPageSize}
+	if v := r.URL.Query().Get("updated_since"); v != "" {
+		since, err := time.Parse(time.RFC3339, v)
+		if err == nil {
+			req.UpdatedSince, err = ptypes.TimestampProto(since)
+		}
+		if err != nil {
+			http.Error(w, "updated_since must be an RFC3339 timestamp", http.StatusBadRequest)
+			return
+		}
+	}
+	ctx := outgoingContext(r)
+	res, err := h.client.ReadAll(ctx, req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", csvContentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="books.csv"`)
+
+	cw := csv.NewWriter(w)
+	cw.Write(csvColumns)
+	for {
+		for _, b := range res.Books {
+			cw.Write(bookToRecord(b))
+		}
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			h.requestLogger(r).WarnContext(r.Context(), "failed to write CSV export", "error", err)
+			return
+		}
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+		if res.NextPageToken == "" {
+			return
+		}
+
+		req.PageToken = res.NextPageToken
+		if res, err = h.client.ReadAll(ctx, req); err != nil {
+			// the status went out with the first page, dropping the connection tells the client the file is incomplete
+			h.requestLogger(r).ErrorContext(r.Context(), "failed to read CSV export", "error", err)
+			panic(http.ErrAbortHandler)
+		}
+	}
+}
+
+// importCSV reads a multipart "file" upload and streams its rows to ImportBooks.
+// With dry_run=true the rows are only validated.
+func (h *csvHandler) importCSV(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, `expected a multipart upload with a CSV "file" field: `+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	dryRun := false
+	if v := r.FormValue("dry_run"); v != "" {
+		if dryRun, err = strconv.ParseBool(v); err != nil {
+			http.Error(w, "dry_run must be true or false", http.StatusBadRequest)
+			return
+		}
+	}
+
+	cr := csv.NewReader(file)
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err != nil {
+		http.Error(w, "failed to read CSV header: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	cols, err := mapColumns(header)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	stream, err := h.client.ImportBooks(outgoingContext(r))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	report := importReport{Api: apiVersion, DryRun: dryRun, Errors: []rowError{}}
+	var sent []int // CSV row of each book sent to the service, in stream order
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			pe, ok := err.(*csv.ParseError)
+			if !ok {
+				http.Error(w, "failed to read CSV: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			report.Received++
+			report.Errors = append(report.Errors, rowError{Row: pe.StartLine, Message: pe.Err.Error()})
+			continue
+		}
+		report.Received++
+		row, _ := cr.FieldPos(0)
+
+		book, err := recordToBook(rec, cols)
+		if err != nil {
+			report.Errors = append(report.Errors, rowError{Row: row, Message: err.Error()})
+			continue
+		}
+		if err := stream.Send(&v1.ImportBooksRequest{Api: apiVersion, Book: book, DryRun: dryRun}); err != nil {
+			// the server ended the stream, CloseAndRecv returns the reason
+			break
+		}
+		sent = append(sent, row)
+	}
+
+	res, err := stream.CloseAndRecv()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	report.Imported = res.Imported
+	for _, e := range res.Errors {
+		report.Errors = append(report.Errors, rowError{Row: sent[e.Row-1], Message: e.Status.GetMessage()})
+	}
+	sort.Slice(report.Errors, func(i, j int) bool { return report.Errors[i].Row < report.Errors[j].Row })
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		h.requestLogger(r).WarnContext(r.Context(), "failed to write CSV import report", "error", err)
+	}
+}
+
+// requestLogger returns the logger of r, annotated with its request ID
+func (h *csvHandler) requestLogger(r *http.Request) *slog.Logger {
+	return logger.FromContext(r.Context(), h.log).With(slog.String("request_id", r.Header.Get(logger.RequestIDHeader)))
+}
+
+// mapColumns returns the record index of every known column in the header.
+// Names are matched case-insensitively with or without underscores, e.g. publish_date or publishDate.
+func mapColumns(header []string) (map[string]int, error) {
+	known := make(map[string]string, len(csvColumns))
+	for _, c := range csvColumns {
+		known[normalizeColumn(c)] = c
+	}
+
+	cols := make(map[string]int, len(header))
+	for i, h := range header {
+		name, ok := known[normalizeColumn(h)]
+		if !ok {
+			return nil, fmt.Errorf("unknown column %q, expected %s", h, strings.Join(csvColumns, ", "))
+		}
+		if _, dup := cols[name]; dup {
+			return nil, fmt.Errorf("column %q appears more than once", h)
+		}
+		cols[name] = i
+	}
+	return cols, nil
+}
+
+func normalizeColumn(name string) string {
+	return strings.ToLower(strings.Replace(strings.TrimSpace(name), "_", "", -1))
+}
+
+// recordToBook converts an imported row, the id, created and updated columns are ignored as the server sets them
+func recordToBook(rec []string, cols map[string]int) (*v1.Book, error) {
+	get := func(name string) string {
+		if i, ok := cols[name]; ok {
+			return strings.TrimSpace(rec[i])
+		}
+		return ""
+	}
+
+	book := &v1.Book{
+		Title:     get("title"),
+		Author:    get("author"),
+		Publisher: get("publisher"),
+		Isbn:      get("isbn"),
+	}
+
+	publishDate, err := parseDate(get("publish_date"))
+	if err != nil {
+		return nil, err
+	}
+	if book.PublishDate, err = ptypes.TimestampProto(publishDate); err != nil {
+		return nil, fmt.Errorf("publish_date is out of range: %v", err)
+	}
+
+	if v := get("rating"); v != "" {
+		if book.Rating, err = strconv.ParseFloat(v, 64); err != nil {
+			return nil, fmt.Errorf("rating %q is not a number", v)
+		}
+	}
+
+	if v := get("status"); v != "" {
+		if n, ok := v1.Book_Status_value[strings.ToUpper(v)]; ok {
+			book.Status = v1.Book_Status(n)
+		} else if n, err := strconv.ParseInt(v, 10, 32); err == nil {
+			book.Status = v1.Book_Status(n)
+		} else {
+			return nil, fmt.Errorf("status %q is not a known status", v)
+		}
+	}
+
+	return book, nil
+}
+
+// parseDate accepts RFC3339 timestamps or plain YYYY-MM-DD dates
+func parseDate(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, fmt.Errorf("publish_date is empty")
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(csvDateLayout, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("publish_date %q is neither RFC3339 nor YYYY-MM-DD", v)
+	}
+	return t, nil
+}
+
+func bookToRecord(b *v1.Book) []string {
+	publishDate := ""
+	if t, err := ptypes.Timestamp(b.PublishDate); err == nil {
+		publishDate = t.Format(time.RFC3339)
+	}
+
+	return []string{
+		strconv.FormatInt(b.Id, 10),
+		b.Title,
+		b.Author,
+		b.Publisher,
+		publishDate,
+		strconv.FormatFloat(b.Rating, 'f', -1, 64),
+		b.Status.String(),
+		b.Isbn,
+		formatTimestamp(b.CreatedAt),
+		formatTimestamp(b.UpdatedAt),
+		b.CreatedBy,
+		b.UpdatedBy,
+	}
+}
+
+// formatTimestamp writes a server set time as RFC3339, empty when it is unset
+func formatTimestamp(ts *timestamp.Timestamp) string {
+	t, err := ptypes.Timestamp(ts)
+	if err != nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// writeError maps a gRPC error to the HTTP status the gateway would have used
+func writeError(w http.ResponseWriter, err error) {
+	st := status.Convert(err)
+	setRetryAfter(w, st)
+	http.Error(w, st.Message(), runtime.HTTPStatusFromCode(st.Code()))
+}
+
+// outgoingContext forwards the caller's credentials, address and request ID to the gRPC server, like the gateway does for its own routes
+func outgoingContext(r *http.Request) context.Context {
+	ctx := r.Context()
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		ctx = metadata.AppendToOutgoingContext(ctx, "x-forwarded-for", host)
+	}
+	if v := r.Header.Get("Authorization"); v != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", v)
+	}
+	if v := r.Header.Get("X-Api-Key"); v != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "x-api-key", v)
+	}
+	if v := r.Header.Get(logger.RequestIDHeader); v != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, logger.RequestIDMetadata, v)
+	}
+	return ctx
+}
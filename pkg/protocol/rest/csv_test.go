@@ -0,0 +1,155 @@
+package rest
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/radean0909/redeam-rest/pkg/api/v1"
+)
+
+func Test_recordToBook(t *testing.T) {
+	cols, err := mapColumns([]string{"Title", "author", "Publisher", "publishDate", "rating", "STATUS"})
+	if err != nil {
+		t.Fatalf("mapColumns() error = %v", err)
+	}
+
+	day, _ := time.Parse(time.RFC3339, "2002-10-02T00:00:00Z")
+	dayProto, _ := ptypes.TimestampProto(day)
+	ts, _ := time.Parse(time.RFC3339, "2002-10-02T15:00:00Z")
+	tsProto, _ := ptypes.TimestampProto(ts)
+
+	tests := []struct {
+		name    string
+		rec     []string
+		want    *v1.Book
+		wantErr bool
+	}{
+		{
+			name: "Plain date and status name",
+			rec:  []string{"title", "author", "publisher", "2002-10-02", "2.5", "checked_in"},
+			want: &v1.Book{Title: "title", Author: "author", Publisher: "publisher", PublishDate: dayProto, Rating: 2.5, Status: v1.Book_CHECKED_IN},
+		},
+		{
+			name: "RFC3339 date and status number",
+			rec:  []string{"title", "author", "publisher", "2002-10-02T15:00:00Z", "", "2"},
+			want: &v1.Book{Title: "title", Author: "author", Publisher: "publisher", PublishDate: tsProto, Status: v1.Book_CHECKED_OUT},
+		},
+		{
+			name:    "Invalid date",
+			rec:     []string{"title", "author", "publisher", "10/02/2002", "2", "1"},
+			wantErr: true,
+		},
+		{
+			name:    "Invalid rating",
+			rec:     []string{"title", "author", "publisher", "2002-10-02", "great", "1"},
+			wantErr: true,
+		},
+		{
+			name:    "Invalid status",
+			rec:     []string{"title", "author", "publisher", "2002-10-02", "2", "LOST"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := recordToBook(tt.rec, cols)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("recordToBook() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("recordToBook() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_mapColumns(t *testing.T) {
+	if _, err := mapColumns([]string{"title", "edition"}); err == nil {
+		t.Errorf("mapColumns() accepted an unknown column")
+	}
+	if _, err := mapColumns([]string{"publish_date", "PublishDate"}); err == nil {
+		t.Errorf("mapColumns() accepted a duplicate column")
+	}
+}
+
+// pagedClient serves books one per ReadAll page, failing page fail when it is set
+type pagedClient struct {
+	v1.BookServiceClient
+	books int64
+	fail  int64
+	pages int64
+}
+
+func (c *pagedClient) ReadAll(ctx context.Context, req *v1.ReadAllRequest, opts ...grpc.CallOption) (*v1.ReadAllResponse, error) {
+	c.pages++
+	if c.pages == c.fail {
+		return nil, status.Error(codes.Unavailable, "database is down")
+	}
+	res := &v1.ReadAllResponse{Api: req.Api, Books: []*v1.Book{{Id: c.pages, Title: "title"}}}
+	if c.pages < c.books {
+		res.NextPageToken = "next"
+	}
+	return res, nil
+}
+
+func TestExport(t *testing.T) {
+	tests := []struct {
+		name      string
+		client    *pagedClient
+		wantCode  int
+		wantRows  int
+		wantAbort bool
+	}{
+		{"pages", &pagedClient{books: 3}, http.StatusOK, 3, false},
+		{"first page fails", &pagedClient{books: 3, fail: 1}, http.StatusServiceUnavailable, 0, false},
+		{"later page fails", &pagedClient{books: 3, fail: 3}, http.StatusOK, 2, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &csvHandler{client: tt.client, log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+			w := httptest.NewRecorder()
+
+			aborted := func() (aborted bool) {
+				defer func() {
+					aborted = recover() == http.ErrAbortHandler
+				}()
+				h.export(w, httptest.NewRequest(http.MethodGet, "/v1/book/export.csv", nil))
+				return false
+			}()
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("code = %d, want %d", w.Code, tt.wantCode)
+			}
+			if aborted != tt.wantAbort {
+				t.Errorf("aborted = %v, want %v", aborted, tt.wantAbort)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+			if rows := len(lines) - 1; rows != tt.wantRows {
+				t.Errorf("rows = %d, want %d: %q", rows, tt.wantRows, w.Body.String())
+			}
+			if !w.Flushed {
+				t.Errorf("rows were not flushed while paging")
+			}
+			if tt.client.pages != 3 {
+				t.Errorf("ReadAll called %d times, want once per page", tt.client.pages)
+			}
+		})
+	}
+}
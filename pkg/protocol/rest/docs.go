@@ -0,0 +1,98 @@
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	swaggerFiles "github.com/swaggo/files/v2"
+)
+
+// docsPage renders the spec on /swagger.json with Swagger UI
+const docsPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>Book service API</title>
+  <link rel="stylesheet" href="/docs/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="/docs/swagger-ui-bundle.js"></script>
+  <script>
+    window.ui = SwaggerUIBundle({url: "/swagger.json", dom_id: "#swagger-ui"});
+  </script>
+</body>
+</html>
+`
+
+// uiAssets are the files of swagger-ui-dist the page loads, embedded in the binary rather than
+// fetched from a CDN that could serve anything
+var uiAssets = map[string]bool{"swagger-ui.css": true, "swagger-ui-bundle.js": true}
+
+// uiFiles serves the embedded swagger-ui-dist files below /docs/
+var uiFiles = http.StripPrefix("/docs/", http.FileServer(http.FS(swaggerFiles.FS)))
+
+// docs serves the OpenAPI spec and the page browsing it
+type docs struct {
+	http, https []byte // the spec with its schemes set to how the gateway was reached
+}
+
+// newDocs prepares spec, an OpenAPI v2 document, to be served
+func newDocs(spec []byte) (*docs, error) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(spec, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse OpenAPI spec: %v", err)
+	}
+
+	d := new(docs)
+	for _, v := range []struct {
+		scheme string
+		spec   *[]byte
+	}{{"http", &d.http}, {"https", &d.https}} {
+		// Try it out calls the scheme listed in the spec, the generated one only lists http
+		doc["schemes"] = []string{v.scheme}
+		data, err := json.MarshalIndent(doc, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		*v.spec = data
+	}
+	return d, nil
+}
+
+// spec answers GET /swagger.json
+func (d *docs) spec(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	data := d.http
+	if r.TLS != nil {
+		data = d.https
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// page answers GET /docs
+func (d *docs) page(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, docsPage)
+}
+
+// asset answers GET /docs/{file} with a file of Swagger UI
+func (d *docs) asset(w http.ResponseWriter, r *http.Request) {
+	if !uiAssets[strings.TrimPrefix(r.URL.Path, "/docs/")] {
+		http.NotFound(w, r)
+		return
+	}
+	uiFiles.ServeHTTP(w, r)
+}
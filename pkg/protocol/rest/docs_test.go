@@ -0,0 +1,89 @@
+package rest
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	swagger "github.com/radean0909/redeam-rest/api/swagger/v1"
+)
+
+func TestDocs(t *testing.T) {
+	d, err := newDocs(swagger.Spec)
+	if err != nil {
+		t.Fatalf("newDocs() error = %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		method      string
+		tls         bool
+		wantCode    int
+		wantSchemes []interface{}
+	}{
+		{"http", http.MethodGet, false, http.StatusOK, []interface{}{"http"}},
+		{"https", http.MethodGet, true, http.StatusOK, []interface{}{"https"}},
+		{"post", http.MethodPost, false, http.StatusMethodNotAllowed, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/swagger.json", nil)
+			if tt.tls {
+				r.TLS = &tls.ConnectionState{}
+			}
+			w := httptest.NewRecorder()
+			d.spec(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("spec() code = %d, want %d", w.Code, tt.wantCode)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			var doc map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+				t.Fatalf("spec() isn't JSON: %v", err)
+			}
+			if doc["swagger"] != "2.0" {
+				t.Errorf("spec() swagger = %v, want 2.0", doc["swagger"])
+			}
+			if !reflect.DeepEqual(doc["schemes"], tt.wantSchemes) {
+				t.Errorf("spec() schemes = %v, want %v", doc["schemes"], tt.wantSchemes)
+			}
+			if _, ok := doc["paths"].(map[string]interface{})["/v1/book/{id}"]; !ok {
+				t.Errorf("spec() lacks /v1/book/{id}")
+			}
+		})
+	}
+
+	w := httptest.NewRecorder()
+	d.page(w, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `url: "/swagger.json"`) {
+		t.Errorf("page() = %d %s, want the page loading /swagger.json", w.Code, w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "https://") {
+		t.Errorf("page() loads files from another origin: %s", w.Body.String())
+	}
+
+	assets := []struct {
+		path     string
+		wantCode int
+		wantType string
+	}{
+		{"/docs/swagger-ui-bundle.js", http.StatusOK, "javascript"},
+		{"/docs/swagger-ui.css", http.StatusOK, "text/css"},
+		{"/docs/index.html", http.StatusNotFound, ""},
+		{"/docs/../swagger.json", http.StatusNotFound, ""},
+	}
+	for _, tt := range assets {
+		w := httptest.NewRecorder()
+		d.asset(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if w.Code != tt.wantCode || !strings.Contains(w.Header().Get("Content-Type"), tt.wantType) {
+			t.Errorf("asset(%s) = %d %s, want %d %s", tt.path, w.Code, w.Header().Get("Content-Type"), tt.wantCode, tt.wantType)
+		}
+	}
+}
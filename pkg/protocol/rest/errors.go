@@ -0,0 +1,41 @@
+package rest
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/status"
+)
+
+// grpc-gateway v1 customizes RPC errors through this package variable, the mux option for it
+// would also turn unknown routes into 501 Not Implemented
+func init() {
+	runtime.HTTPError = httpError
+}
+
+// httpError is the gateway's default error response, with Retry-After set from the RetryInfo of rate limited calls
+func httpError(ctx context.Context, mux *runtime.ServeMux, m runtime.Marshaler, w http.ResponseWriter, r *http.Request, err error) {
+	setRetryAfter(w, status.Convert(err))
+	runtime.DefaultHTTPError(ctx, mux, m, w, r, err)
+}
+
+// setRetryAfter sets the Retry-After header in whole seconds, rounded up, when st carries a RetryInfo
+func setRetryAfter(w http.ResponseWriter, st *status.Status) {
+	for _, d := range st.Details() {
+		info, ok := d.(*errdetails.RetryInfo)
+		if !ok {
+			continue
+		}
+		wait, err := ptypes.Duration(info.RetryDelay)
+		if err != nil {
+			return
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Max(1, math.Ceil(wait.Seconds())))))
+		return
+	}
+}
@@ -0,0 +1,41 @@
+package rest
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestSetRetryAfter(t *testing.T) {
+	tests := []struct {
+		name string
+		wait time.Duration // no RetryInfo when zero
+		want string
+	}{
+		{"no RetryInfo", 0, ""},
+		{"rounded up", 1500 * time.Millisecond, "2"},
+		{"at least a second", time.Millisecond, "1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := status.New(codes.ResourceExhausted, "rate limit exceeded")
+			if tt.wait > 0 {
+				var err error
+				if st, err = st.WithDetails(&errdetails.RetryInfo{RetryDelay: ptypes.DurationProto(tt.wait)}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			w := httptest.NewRecorder()
+			setRetryAfter(w, st)
+			if got := w.Header().Get("Retry-After"); got != tt.want {
+				t.Errorf("Retry-After = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package rest
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/improbable-eng/grpc-web/go/grpcweb"
+	"google.golang.org/grpc"
+)
+
+// grpcWeb sends grpc-web calls, their CORS preflights and grpc-web websockets to server, counted in
+// calls, and everything else to next. Cross-origin calls are accepted from origins, "*" accepts any.
+func grpcWeb(server *grpc.Server, origins []string, calls *callGroup, next http.Handler) http.Handler {
+	allowed := make(map[string]bool, len(origins))
+	for _, o := range origins {
+		allowed[o] = true
+	}
+	allowOrigin := func(origin string) bool {
+		return allowed["*"] || allowed[origin]
+	}
+
+	web := grpcweb.WrapServer(server,
+		grpcweb.WithOriginFunc(allowOrigin),
+		// browsers can't stream requests over HTTP/1.1, ImportBooks needs websockets
+		grpcweb.WithWebsockets(true),
+		grpcweb.WithWebsocketOriginFunc(func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			return origin == "" || sameOrigin(origin, r.Host) || allowOrigin(origin)
+		}),
+	)
+
+	webCalls := calls.handle(web)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if web.IsGrpcWebRequest(r) || web.IsAcceptableGrpcCorsRequest(r) || web.IsGrpcWebSocketRequest(r) {
+			webCalls.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// sameOrigin reports whether the Origin header names the host the request was sent to
+func sameOrigin(origin, host string) bool {
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == host
+}
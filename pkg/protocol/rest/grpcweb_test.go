@@ -0,0 +1,115 @@
+package rest
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestGRPCWeb(t *testing.T) {
+	server := grpc.NewServer()
+	healthpb.RegisterHealthServer(server, grpchealth.NewServer())
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	h := grpcWeb(server, []string{"https://app.example.com"}, new(callGroup), next)
+
+	// an empty HealthCheckRequest in a grpc-web frame: no flags, zero length
+	frame := []byte{0, 0, 0, 0, 0}
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		header      map[string]string
+		wantCode    int
+		wantType    string
+		wantOrigin  string
+		wantTrailer string
+	}{
+		{
+			name:   "call",
+			method: http.MethodPost,
+			path:   "/grpc.health.v1.Health/Check",
+			header: map[string]string{"Content-Type": "application/grpc-web+proto"},
+			// the trailers of grpc-web are sent in the body
+			wantCode: http.StatusOK, wantType: "application/grpc-web+proto", wantTrailer: "grpc-status: 0",
+		},
+		{
+			name:   "preflight from allowed origin",
+			method: http.MethodOptions,
+			path:   "/grpc.health.v1.Health/Check",
+			header: map[string]string{
+				"Origin":                         "https://app.example.com",
+				"Access-Control-Request-Method":  "POST",
+				"Access-Control-Request-Headers": "content-type,x-grpc-web",
+			},
+			wantCode: http.StatusOK, wantOrigin: "https://app.example.com",
+		},
+		{
+			name:   "preflight from other origin",
+			method: http.MethodOptions,
+			path:   "/grpc.health.v1.Health/Check",
+			header: map[string]string{
+				"Origin":                         "https://evil.example.com",
+				"Access-Control-Request-Method":  "POST",
+				"Access-Control-Request-Headers": "content-type,x-grpc-web",
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "gateway",
+			method:   http.MethodGet,
+			path:     "/v1/book/1",
+			wantCode: http.StatusTeapot,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, bytes.NewReader(frame))
+			for k, v := range tt.header {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			// rs/cors answers preflights with 200 or 204 depending on its version, either is fine
+			preflight := tt.method == http.MethodOptions && w.Code/100 == 2 && tt.wantCode/100 == 2
+			if w.Code != tt.wantCode && !preflight {
+				t.Errorf("code = %d, want %d", w.Code, tt.wantCode)
+			}
+			if got := w.Header().Get("Content-Type"); tt.wantType != "" && got != tt.wantType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.wantType)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			if !strings.Contains(strings.ToLower(w.Body.String()), tt.wantTrailer) {
+				t.Errorf("body = %q, want %q in it", w.Body.String(), tt.wantTrailer)
+			}
+		})
+	}
+}
+
+func TestSameOrigin(t *testing.T) {
+	tests := []struct {
+		origin, host string
+		want         bool
+	}{
+		{"http://localhost:8080", "localhost:8080", true},
+		{"https://app.example.com", "app.example.com", true},
+		{"http://localhost:3000", "localhost:8080", false},
+		{"null", "localhost:8080", false},
+	}
+	for _, tt := range tests {
+		if got := sameOrigin(tt.origin, tt.host); got != tt.want {
+			t.Errorf("sameOrigin(%q, %q) = %v, want %v", tt.origin, tt.host, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package rest
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// instrument counts the requests handled by h and records their latency in reg. Paths aren't
+// used as labels, /v1/book/{id} alone would create one series per book.
+func instrument(reg prometheus.Registerer, h http.Handler) http.Handler {
+	inFlight := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "http_requests_in_flight",
+		Help: "Number of HTTP requests the gateway is serving.",
+	})
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "Total number of HTTP requests handled by the gateway.",
+	}, []string{"code", "method"})
+	duration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Latency of HTTP requests handled by the gateway.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"code", "method"})
+	reg.MustRegister(inFlight, requests, duration)
+
+	return promhttp.InstrumentHandlerInFlight(inFlight,
+		promhttp.InstrumentHandlerDuration(duration,
+			promhttp.InstrumentHandlerCounter(requests, h)))
+}
+
+// metricsHandler serves the metrics of reg in the Prometheus exposition format
+func metricsHandler(reg *prometheus.Registry) http.Handler {
+	return promhttp.HandlerFor(reg, promhttp.HandlerOpts{Registry: reg})
+}
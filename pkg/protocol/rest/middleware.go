@@ -0,0 +1,216 @@
+package rest
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/cors"
+
+	"github.com/radean0909/redeam-rest/pkg/logger"
+)
+
+// Middleware wraps a handler, e.g. to check requests or rewrite responses on the way
+type Middleware func(http.Handler) http.Handler
+
+// WithMiddleware wraps the REST routes in mws, the first one sees requests first. grpc-web calls
+// don't pass them, they have their own CORS handling and go through the gRPC interceptors.
+func WithMiddleware(mws ...Middleware) Option {
+	return func(o *options) {
+		o.middleware = append(o.middleware, mws...)
+	}
+}
+
+// chain wraps h in mws so requests pass them in order
+func chain(h http.Handler, mws ...Middleware) http.Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+// CORSConfig is the cross-origin access granted to browser apps served from other origins
+type CORSConfig struct {
+	// Origins may call the gateway, "*" allows any and "https://*.example.com" any subdomain
+	Origins []string
+	// Methods may be used, defaults to GET, POST, PUT, PATCH and DELETE
+	Methods []string
+	// Headers may be sent, defaults to Content-Type, Authorization, X-Api-Key, X-Request-Id and Idempotency-Key
+	Headers []string
+	// Credentials lets browsers send cookies and client certificates
+	Credentials bool
+	// MaxAge is how long browsers may cache a preflight answer
+	MaxAge time.Duration
+}
+
+// CORS answers preflight requests and adds the CORS headers of cfg to responses
+func CORS(cfg CORSConfig) Middleware {
+	methods := cfg.Methods
+	if len(methods) == 0 {
+		methods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+	}
+	headers := cfg.Headers
+	if len(headers) == 0 {
+		headers = []string{"Content-Type", "Authorization", "X-Api-Key", logger.RequestIDHeader, "Idempotency-Key"}
+	}
+	c := cors.New(cors.Options{
+		AllowedOrigins:   cfg.Origins,
+		AllowedMethods:   methods,
+		AllowedHeaders:   headers,
+		ExposedHeaders:   []string{logger.RequestIDHeader, "Retry-After", "ETag", "Last-Modified", "Idempotent-Replayed"},
+		AllowCredentials: cfg.Credentials,
+		MaxAge:           int(cfg.MaxAge / time.Second),
+	})
+	return c.Handler
+}
+
+// MaxBodySize rejects request bodies larger than n bytes with 413 Request Entity Too Large. Bodies
+// of unknown length are cut off after n bytes, which the gateway answers with 400 Bad Request.
+func MaxBodySize(n int64) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > n {
+				http.Error(w, "request body is larger than "+strconv.FormatInt(n, 10)+" bytes", http.StatusRequestEntityTooLarge)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, n)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Recover answers a request whose handler panicked with 500 Internal Server Error and logs the
+// panic to l, the server keeps serving
+func Recover(l *slog.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				p := recover()
+				if p == nil {
+					return
+				}
+				if p == http.ErrAbortHandler {
+					// the handler asked net/http to drop the connection
+					panic(p)
+				}
+				l.ErrorContext(r.Context(), "panic serving request",
+					slog.String("method", r.Method),
+					slog.String("path", r.URL.Path),
+					slog.String("request_id", r.Header.Get(logger.RequestIDHeader)),
+					slog.String("panic", fmt.Sprint(p)),
+					slog.String("stack", string(debug.Stack())),
+				)
+				// too late for a status when the handler already started the response
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Gzip compresses responses at level for clients accepting gzip, level is one of the compress/gzip levels
+func Gzip(level int) (Middleware, error) {
+	if _, err := gzip.NewWriterLevel(io.Discard, level); err != nil {
+		return nil, err
+	}
+	pool := sync.Pool{New: func() interface{} {
+		gz, _ := gzip.NewWriterLevel(io.Discard, level)
+		return gz
+	}}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+			if r.Method == http.MethodHead || !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			gw := &gzipWriter{ResponseWriter: w, pool: &pool}
+			defer gw.close()
+			next.ServeHTTP(gw, r)
+		})
+	}, nil
+}
+
+// acceptsGzip reports whether an Accept-Encoding header lists gzip without refusing it with q=0
+func acceptsGzip(header string) bool {
+	for _, enc := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(enc, ";")
+		if name = strings.TrimSpace(name); name != "gzip" && name != "*" {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// gzipWriter compresses the body unless the handler encoded it itself or sent none. Flush passes
+// through so streams like /v1/book/watch reach the client as they are written.
+type gzipWriter struct {
+	http.ResponseWriter
+	pool        *sync.Pool
+	gz          *gzip.Writer
+	wroteHeader bool
+}
+
+func (w *gzipWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	h := w.Header()
+	if code >= http.StatusOK && code != http.StatusNoContent && code != http.StatusNotModified && h.Get("Content-Encoding") == "" {
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		w.gz = w.pool.Get().(*gzip.Writer)
+		w.gz.Reset(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *gzipWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		// sniff before compressing, net/http would sniff the compressed bytes
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.gz == nil {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.gz.Write(b)
+}
+
+func (w *gzipWriter) Flush() {
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// close ends the gzip stream and returns the writer to the pool
+func (w *gzipWriter) close() {
+	if w.gz == nil {
+		return
+	}
+	w.gz.Close()
+	w.pool.Put(w.gz)
+	w.gz = nil
+}
@@ -0,0 +1,239 @@
+package rest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChain(t *testing.T) {
+	var order []string
+	mw := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	h := chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		order = append(order, "handler")
+	}), mw("first"), mw("second"))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if got, want := strings.Join(order, ","), "first,second,handler"; got != want {
+		t.Errorf("order = %s, want %s", got, want)
+	}
+}
+
+func TestCORS(t *testing.T) {
+	h := CORS(CORSConfig{Origins: []string{"https://app.example.com"}, MaxAge: time.Minute})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+
+	tests := []struct {
+		name       string
+		method     string
+		origin     string
+		reqMethod  string
+		wantOrigin string
+		wantMaxAge string
+	}{
+		{"preflight", http.MethodOptions, "https://app.example.com", http.MethodPut, "https://app.example.com", "60"},
+		{"preflight of other origin", http.MethodOptions, "https://evil.example.com", http.MethodPut, "", ""},
+		{"preflight of other method", http.MethodOptions, "https://app.example.com", "TRACE", "", ""},
+		{"request", http.MethodGet, "https://app.example.com", "", "https://app.example.com", ""},
+		{"request of other origin", http.MethodGet, "https://evil.example.com", "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/v1/book/1", nil)
+			r.Header.Set("Origin", tt.origin)
+			if tt.reqMethod != "" {
+				r.Header.Set("Access-Control-Request-Method", tt.reqMethod)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			if got := w.Header().Get("Access-Control-Max-Age"); got != tt.wantMaxAge {
+				t.Errorf("Access-Control-Max-Age = %q, want %q", got, tt.wantMaxAge)
+			}
+		})
+	}
+}
+
+func TestMaxBodySize(t *testing.T) {
+	h := MaxBodySize(8)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	}))
+
+	tests := []struct {
+		name     string
+		body     string
+		chunked  bool
+		wantCode int
+	}{
+		{"small", "12345678", false, http.StatusOK},
+		{"large", "123456789", false, http.StatusRequestEntityTooLarge},
+		{"large of unknown length", "123456789", true, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/v1/book", strings.NewReader(tt.body))
+			if tt.chunked {
+				r.ContentLength = -1
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("code = %d, want %d", w.Code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestRecover(t *testing.T) {
+	var logs bytes.Buffer
+	l := slog.New(slog.NewJSONHandler(&logs, nil))
+
+	h := Recover(l)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/book/1", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("code = %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+	if !strings.Contains(logs.String(), `"panic":"boom"`) {
+		t.Errorf("log = %s, want the panic in it", logs.String())
+	}
+
+	// http.ErrAbortHandler is left to net/http, which drops the connection
+	abort := Recover(l)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	defer func() {
+		if p := recover(); p != http.ErrAbortHandler {
+			t.Errorf("recover() = %v, want http.ErrAbortHandler", p)
+		}
+	}()
+	abort.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
+
+func TestGzip(t *testing.T) {
+	if _, err := Gzip(42); err == nil {
+		t.Error("Gzip(42) error = nil, want an invalid level error")
+	}
+	mw, err := Gzip(gzip.BestSpeed)
+	if err != nil {
+		t.Fatalf("Gzip() error = %v", err)
+	}
+	body := strings.Repeat(`{"title":"The Hobbit"}`, 100)
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		handler        http.HandlerFunc
+		wantEncoding   string
+		wantBody       string
+	}{
+		{
+			name:           "compressed",
+			acceptEncoding: "br, gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				io.WriteString(w, body)
+			},
+			wantEncoding: "gzip",
+			wantBody:     body,
+		},
+		{
+			name:           "flushed stream",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, "a")
+				w.(http.Flusher).Flush()
+				io.WriteString(w, "b")
+			},
+			wantEncoding: "gzip",
+			wantBody:     "ab",
+		},
+		{
+			name: "not accepted",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, body)
+			},
+			wantBody: body,
+		},
+		{
+			name:           "refused",
+			acceptEncoding: "gzip;q=0, identity",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, body)
+			},
+			wantBody: body,
+		},
+		{
+			name:           "no content",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			},
+		},
+		{
+			name:           "encoded by handler",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Encoding", "br")
+				io.WriteString(w, "brotli")
+			},
+			wantEncoding: "br",
+			wantBody:     "brotli",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/v1/book", nil)
+			if tt.acceptEncoding != "" {
+				r.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			w := httptest.NewRecorder()
+			mw(tt.handler).ServeHTTP(w, r)
+
+			if got := w.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Fatalf("Content-Encoding = %q, want %q", got, tt.wantEncoding)
+			}
+			if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+				t.Errorf("Vary = %q, want Accept-Encoding", got)
+			}
+			got := w.Body.String()
+			if tt.wantEncoding == "gzip" {
+				zr, err := gzip.NewReader(w.Body)
+				if err != nil {
+					t.Fatalf("gzip.NewReader() error = %v", err)
+				}
+				b, err := io.ReadAll(zr)
+				if err != nil {
+					t.Fatalf("reading gzip body: %v", err)
+				}
+				got = string(b)
+			}
+			if got != tt.wantBody {
+				t.Errorf("body = %q, want %q", got, tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,18 @@
+package rest
+
+import (
+	"net/http"
+
+	"github.com/radean0909/redeam-rest/pkg/logger"
+)
+
+// requestID makes sure every request carries a usable X-Request-Id, which the gateway forwards to
+// the gRPC server as x-request-id metadata, and echoes it in the response
+func requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := logger.RequestID(r.Header.Get(logger.RequestIDHeader))
+		r.Header.Set(logger.RequestIDHeader, id)
+		w.Header().Set(logger.RequestIDHeader, id)
+		next.ServeHTTP(w, r)
+	})
+}
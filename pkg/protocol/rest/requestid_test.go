@@ -0,0 +1,39 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_requestID(t *testing.T) {
+	var forwarded string
+	h := requestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r.Header.Get("X-Request-Id")
+	}))
+
+	tests := []struct {
+		name     string
+		id       string
+		wantSame bool
+	}{
+		{"Propagated ID", "3f2a9c", true},
+		{"Generated ID", "", false},
+		{"Unusable ID", "bad id", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/v1/book/1", nil)
+			if tt.id != "" {
+				r.Header.Set("X-Request-Id", tt.id)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			got := w.Header().Get("X-Request-Id")
+			if got == "" || got != forwarded || (got == tt.id) != tt.wantSame {
+				t.Errorf("requestID() echoed %q and forwarded %q for %q", got, forwarded, tt.id)
+			}
+		})
+	}
+}
@@ -2,48 +2,252 @@ package rest
 
 import (
 	"context"
+	"crypto/tls"
+	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
-	"os"
-	"os/signal"
-	"time"
+	"strings"
 
 	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 
+	swagger "github.com/radean0909/redeam-rest/api/swagger/v1"
 	"github.com/radean0909/redeam-rest/pkg/api/v1"
+	"github.com/radean0909/redeam-rest/pkg/health"
+	"github.com/radean0909/redeam-rest/pkg/logger"
+	grpcserver "github.com/radean0909/redeam-rest/pkg/protocol/grpc"
+	"github.com/radean0909/redeam-rest/pkg/protocol/grpc/middleware"
+	service "github.com/radean0909/redeam-rest/pkg/service/v1"
 )
 
-// HTTP/REST gateway
-func RunServer(ctx context.Context, grpcPort, httpPort string) error {
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
+type options struct {
+	serverTLS *tls.Config
+	creds     credentials.TransportCredentials
+	metrics   *prometheus.Registry
+	health    *health.Checker
+	grpcWeb   *grpc.Server
+	origins   []string
+	single    *grpc.Server
+	logger    *slog.Logger
 
-	mux := runtime.NewServeMux()
-	opts := []grpc.DialOption{grpc.WithInsecure()}
-	if err := v1.RegisterBookServiceHandlerFromEndpoint(ctx, mux, "0.0.0.0:"+grpcPort, opts); err != nil {
-		log.Fatalf("failed to start HTTP gateway: %v", err)
+	middleware []Middleware
+}
+
+// Option configures optional features of the gateway
+type Option func(*options)
+
+// WithTLS serves the gateway over HTTPS with serverTLS and secures the connection to the gRPC server with creds
+func WithTLS(serverTLS *tls.Config, creds credentials.TransportCredentials) Option {
+	return func(o *options) {
+		o.serverTLS, o.creds = serverTLS, creds
 	}
+}
+
+// WithLogger logs errors of the CSV endpoints to l, slog.Default() otherwise
+func WithLogger(l *slog.Logger) Option {
+	return func(o *options) {
+		o.logger = l
+	}
+}
 
-	srv := &http.Server{
-		Addr:    ":" + httpPort,
-		Handler: mux,
+// WithMetrics records HTTP metrics of the gateway in reg and serves everything in reg on /metrics
+func WithMetrics(reg *prometheus.Registry) Option {
+	return func(o *options) {
+		o.metrics = reg
 	}
+}
 
-	// graceful shutdown
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
-	go func() {
-		for range c {
-			// sig is a ^C, handle it
-		}
+// WithHealth serves liveness on /healthz and readiness on /readyz
+func WithHealth(c *health.Checker) Option {
+	return func(o *options) {
+		o.health = c
+	}
+}
 
-		_, cancel := context.WithTimeout(ctx, 5*time.Second)
-		defer cancel()
+// WithGRPCWeb serves the services of server to grpc-web clients, e.g. browsers, on the HTTP port
+// next to the gateway. Cross-origin calls are accepted from origins, "*" accepts any.
+func WithGRPCWeb(server *grpc.Server, origins []string) Option {
+	return func(o *options) {
+		o.grpcWeb, o.origins = server, origins
+	}
+}
 
-		_ = srv.Shutdown(ctx)
-	}()
+// WithSinglePort serves the gRPC calls of server on the HTTP port as well, told apart from REST calls
+// by their content type, over TLS or cleartext HTTP/2 (h2c). The gateway then calls server in-process
+// rather than over the gRPC port, still through its interceptors, and Shutdown stops server.
+func WithSinglePort(server *grpc.Server) Option {
+	return func(o *options) {
+		o.single = server
+	}
+}
+
+// Server is the HTTP/REST gateway in front of the gRPC server
+type Server struct {
+	srv    *http.Server
+	conn   *grpc.ClientConn
+	calls  *callGroup   // gRPC and grpc-web calls served through the gRPC server's ServeHTTP
+	single *grpc.Server // stopped by Shutdown in single-port mode
+}
+
+// NewServer HTTP/REST gateway, plaintext toward clients and the gRPC server unless WithTLS is given
+func NewServer(ctx context.Context, grpcPort, httpPort string, opts ...Option) (*Server, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	// the gRPC client continues the trace of the HTTP request
+	dialOpts := []grpc.DialOption{grpc.WithStatsHandler(otelgrpc.NewClientHandler()), grpc.WithInsecure()}
+	if o.creds != nil {
+		dialOpts[1] = grpc.WithTransportCredentials(o.creds)
+	}
+	var conn *grpc.ClientConn
+	var err error
+	if o.single != nil {
+		conn, err = grpcserver.DialInProcess(ctx, o.single, dialOpts[0])
+	} else {
+		conn, err = grpc.DialContext(ctx, "0.0.0.0:"+grpcPort, dialOpts...)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial gRPC server: %v", err)
+	}
+
+	gw := runtime.NewServeMux(runtime.WithIncomingHeaderMatcher(headerMatcher), runtime.WithOutgoingHeaderMatcher(outgoingHeaderMatcher))
+	if err := v1.RegisterBookServiceHandler(ctx, gw, conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to start HTTP gateway: %v", err)
+	}
+	if err := v1.RegisterApiKeyServiceHandler(ctx, gw, conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to start HTTP gateway: %v", err)
+	}
+
+	// CSV endpoints are registered ahead of the gateway so /v1/book/{id} doesn't shadow them
+	if o.logger == nil {
+		o.logger = slog.Default()
+	}
+	books := &csvHandler{client: v1.NewBookServiceClient(conn), log: o.logger}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/book/export.csv", books.export)
+	mux.HandleFunc("/v1/book/import", books.importCSV)
+	mux.Handle("/", gw)
+	// the API contract, generated from the proto definition
+	d, err := newDocs(swagger.Spec)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	mux.HandleFunc("/swagger.json", d.spec)
+	mux.HandleFunc("/docs", d.page)
+	mux.HandleFunc("/docs/", d.asset)
+	if o.health != nil {
+		mux.HandleFunc("/healthz", o.health.Liveness)
+		mux.HandleFunc("/readyz", o.health.Readiness)
+	}
+
+	calls := new(callGroup)
+	root := chain(conditional(mux), o.middleware...)
+	if o.grpcWeb != nil {
+		root = grpcWeb(o.grpcWeb, o.origins, calls, root)
+	}
+
+	handler := requestID(root)
+	if o.metrics != nil {
+		handler = instrument(o.metrics, handler)
+		mux.Handle("/metrics", metricsHandler(o.metrics))
+	}
+	// start a span per request, continuing the W3C trace context of the caller
+	handler = otelhttp.NewHandler(handler, "gateway", otelhttp.WithSpanNameFormatter(spanName))
+	if o.single != nil {
+		// gRPC calls have their own metrics and traces
+		handler = singlePort(o.single, calls, handler)
+	}
+
+	return &Server{
+		srv: &http.Server{
+			Addr:      ":" + httpPort,
+			Handler:   handler,
+			TLSConfig: o.serverTLS,
+		},
+		conn:   conn,
+		calls:  calls,
+		single: o.single,
+	}, nil
+}
+
+// Run serves the gateway until Shutdown, after which it returns nil
+func (s *Server) Run() error {
+	var err error
+	if s.srv.TLSConfig != nil {
+		log.Println("starting HTTPS/REST gateway on port " + strings.TrimPrefix(s.srv.Addr, ":"))
+		err = s.srv.ListenAndServeTLS("", "")
+	} else {
+		log.Println("starting HTTP/REST gateway on port " + strings.TrimPrefix(s.srv.Addr, ":"))
+		err = s.srv.ListenAndServe()
+	}
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// Shutdown stops accepting requests and waits for the running ones, gRPC and grpc-web calls included,
+// until ctx is done, then closes the connection to the gRPC server. In single-port mode it stops the
+// gRPC server too, cutting off the calls still running.
+func (s *Server) Shutdown(ctx context.Context) error {
+	log.Println("shutting down HTTP/REST gateway...")
+
+	err := s.srv.Shutdown(ctx)
+	if err != nil {
+		// requests still running past the deadline, e.g. /v1/book/watch, are cut off
+		s.srv.Close()
+	}
+	// calls on h2c connections outlive srv.Shutdown, and GracefulStop can't drain ServeHTTP calls
+	if werr := s.calls.wait(ctx); err == nil {
+		err = werr
+	}
+	if s.single != nil {
+		s.single.Stop()
+	}
+	if cerr := s.conn.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// headerMatcher forwards the X-Api-Key, X-Request-Id and Idempotency-Key headers as metadata on top of the gateway defaults
+func headerMatcher(key string) (string, bool) {
+	switch http.CanonicalHeaderKey(key) {
+	case "X-Api-Key":
+		return "x-api-key", true
+	case logger.RequestIDHeader:
+		return logger.RequestIDMetadata, true
+	case "Idempotency-Key":
+		return middleware.IdempotencyKeyMetadata, true
+	}
+	return runtime.DefaultHeaderMatcher(key)
+}
+
+// outgoingHeaderMatcher sends the validators of the book service as the standard HTTP headers, other
+// response metadata gets the gateway's Grpc-Metadata- prefix
+func outgoingHeaderMatcher(key string) (string, bool) {
+	switch key {
+	case service.ETagMetadata:
+		return "ETag", true
+	case service.LastModifiedMetadata:
+		return "Last-Modified", true
+	case middleware.IdempotentReplayedMetadata:
+		return "Idempotent-Replayed", true
+	}
+	return runtime.MetadataHeaderPrefix + key, true
+}
 
-	log.Println("starting HTTP/REST gateway on port " + httpPort)
-	return srv.ListenAndServe()
+// spanName names gateway spans after the HTTP method only, paths like /v1/book/{id} would make one name per book
+func spanName(_ string, r *http.Request) string {
+	return "HTTP " + r.Method
 }
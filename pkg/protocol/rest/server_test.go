@@ -0,0 +1,33 @@
+package rest
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestServer_Shutdown(t *testing.T) {
+	// the gRPC connection is established lazily, nothing has to listen on the port
+	s, err := NewServer(context.Background(), "1", "0")
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- s.Run() }()
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Errorf("Shutdown() error = %v", err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Run() error = %v, want nil after Shutdown", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() didn't return after Shutdown")
+	}
+}
@@ -0,0 +1,80 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+)
+
+// singlePort sends gRPC calls to server, counted in calls, and everything else to next. Without TLS,
+// HTTP/2 is spoken in cleartext, which gRPC clients expect; with TLS it is negotiated as usual.
+func singlePort(server *grpc.Server, calls *callGroup, next http.Handler) http.Handler {
+	grpcCalls := calls.handle(server)
+	return h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isGRPC(r) {
+			grpcCalls.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}), &http2.Server{})
+}
+
+// isGRPC reports whether r is a gRPC call, which is made over HTTP/2 with an application/grpc content
+// type. grpc-web calls use application/grpc-web and are left to the gateway.
+func isGRPC(r *http.Request) bool {
+	ct := r.Header.Get("Content-Type")
+	if r.ProtoMajor != 2 || !strings.HasPrefix(ct, "application/grpc") {
+		return false
+	}
+	return len(ct) == len("application/grpc") || ct[len("application/grpc")] == '+' || ct[len("application/grpc")] == ';'
+}
+
+// callGroup counts the running calls of a handler so shutdown can wait for them. The gRPC server can't
+// drain calls it serves through ServeHTTP, and http.Server doesn't track the h2c connections it hands
+// over, so the gateway waits for them itself.
+type callGroup struct {
+	mu     sync.RWMutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// handle runs h as a call of g, calls arriving after wait started are refused as unavailable
+func (g *callGroup) handle(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		g.mu.RLock()
+		if g.closed {
+			g.mu.RUnlock()
+			http.Error(w, "server is shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		g.wg.Add(1)
+		g.mu.RUnlock()
+		defer g.wg.Done()
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// wait refuses new calls and waits for the running ones until ctx is done
+func (g *callGroup) wait(ctx context.Context) error {
+	g.mu.Lock()
+	g.closed = true
+	g.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,163 @@
+package rest
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+
+	"github.com/radean0909/redeam-rest/pkg/api/v1"
+	service "github.com/radean0909/redeam-rest/pkg/service/v1"
+)
+
+func TestSinglePort(t *testing.T) {
+	// every call has to pass the interceptors, REST ones included
+	var mu sync.Mutex
+	var calls []string
+	record := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		mu.Lock()
+		calls = append(calls, info.FullMethod)
+		mu.Unlock()
+		return handler(ctx, req)
+	}
+	server := grpc.NewServer(grpc.ChainUnaryInterceptor(record))
+	v1.RegisterBookServiceServer(server, service.NewBookServiceServer(nil))
+	healthpb.RegisterHealthServer(server, grpchealth.NewServer())
+	defer server.Stop()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, port, _ := net.SplitHostPort(lis.Addr().String())
+	lis.Close()
+
+	// nothing listens on the gRPC port
+	s, err := NewServer(context.Background(), "1", port, WithSinglePort(server))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	go s.Run()
+	defer s.Shutdown(context.Background())
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, "127.0.0.1:"+port, grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	res, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil || res.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("gRPC Check() = %v, %v, want SERVING", res, err)
+	}
+
+	// the service rejects the version before it needs the database
+	r, err := http.Get("http://127.0.0.1:" + port + "/v1/book/1?api=v0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Body.Close()
+	if r.StatusCode != http.StatusNotImplemented {
+		t.Errorf("GET /v1/book/1 code = %d, want %d", r.StatusCode, http.StatusNotImplemented)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"/grpc.health.v1.Health/Check", "/v1.BookService/Read"}
+	if len(calls) != len(want) || calls[0] != want[0] || calls[1] != want[1] {
+		t.Errorf("intercepted calls = %v, want %v", calls, want)
+	}
+}
+
+func TestSinglePortShutdown(t *testing.T) {
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	hold := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		started <- struct{}{}
+		<-release
+		return handler(ctx, req)
+	}
+	server := grpc.NewServer(grpc.ChainUnaryInterceptor(hold))
+	healthpb.RegisterHealthServer(server, grpchealth.NewServer())
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, port, _ := net.SplitHostPort(lis.Addr().String())
+	lis.Close()
+
+	s, err := NewServer(context.Background(), "1", port, WithSinglePort(server))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	go s.Run()
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, "127.0.0.1:"+port, grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := healthpb.NewHealthClient(conn)
+	checked := make(chan error, 1)
+	go func() {
+		_, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+		checked <- err
+	}()
+	<-started
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- s.Shutdown(ctx) }()
+	select {
+	case err := <-stopped:
+		t.Fatalf("Shutdown() = %v with a call in flight, want it to wait", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+	if err := <-checked; err != nil {
+		t.Errorf("Check() in flight error = %v, want it to finish", err)
+	}
+	if err := <-stopped; err != nil {
+		t.Errorf("Shutdown() error = %v", err)
+	}
+	// calls after the shutdown are refused rather than served by a stopped server
+	if _, err := client.Check(ctx, &healthpb.HealthCheckRequest{}); status.Code(err) != codes.Unavailable {
+		t.Errorf("Check() after Shutdown() error = %v, want Unavailable", err)
+	}
+}
+
+func TestIsGRPC(t *testing.T) {
+	tests := []struct {
+		contentType string
+		proto       int
+		want        bool
+	}{
+		{"application/grpc", 2, true},
+		{"application/grpc+proto", 2, true},
+		{"application/grpc", 1, false},
+		{"application/grpc-web+proto", 2, false},
+		{"application/json", 2, false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/v1.BookService/Read", nil)
+		r.ProtoMajor = tt.proto
+		r.Header.Set("Content-Type", tt.contentType)
+		if got := isGRPC(r); got != tt.want {
+			t.Errorf("isGRPC(%s, HTTP/%d) = %v, want %v", tt.contentType, tt.proto, got, tt.want)
+		}
+	}
+}
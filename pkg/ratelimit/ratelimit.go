@@ -0,0 +1,145 @@
+// Package ratelimit keeps a token bucket per gRPC method and client identity.
+package ratelimit
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	"gopkg.in/yaml.v2"
+)
+
+// sweepInterval is how often buckets that refilled completely are dropped
+const sweepInterval = time.Minute
+
+// Limit is a token bucket: Rate calls per second on average, Burst calls at once
+type Limit struct {
+	Rate  float64 `yaml:"rate"`
+	Burst int     `yaml:"burst"`
+}
+
+// Config maps method patterns to limits, methods that no entry matches get Default when it is set
+type Config struct {
+	Default *Limit           `yaml:"default"`
+	Methods map[string]Limit `yaml:"methods"`
+}
+
+// Limiter decides whether a client may call a method now
+type Limiter struct {
+	cfg Config
+	now func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket // by pattern and client
+	lastSweep time.Time
+}
+
+type bucket struct {
+	limiter *rate.Limiter
+	full    time.Duration // time to refill from empty, an idle bucket is full again after it
+	last    time.Time
+}
+
+// Load reads a YAML limits file, see configs/ratelimit.yaml
+func Load(path string) (*Limiter, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("ratelimit: reading limits: %v", err)
+	}
+
+	var cfg Config
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return nil, fmt.Errorf("ratelimit: parsing limits %s: %v", path, err)
+	}
+	return New(cfg)
+}
+
+// New builds a limiter. Method patterns are a full method name such as "/v1.BookService/ReadAll",
+// or "/v1.BookService/*" for one budget shared by every method of the service.
+func New(cfg Config) (*Limiter, error) {
+	if cfg.Default != nil {
+		if err := cfg.Default.validate(); err != nil {
+			return nil, fmt.Errorf("ratelimit: default: %v", err)
+		}
+	}
+	for m, l := range cfg.Methods {
+		if !strings.HasPrefix(m, "/") || strings.Count(m, "/") != 2 {
+			return nil, fmt.Errorf("ratelimit: invalid method %q", m)
+		}
+		if err := l.validate(); err != nil {
+			return nil, fmt.Errorf("ratelimit: %s: %v", m, err)
+		}
+	}
+	return &Limiter{cfg: cfg, now: time.Now, buckets: make(map[string]*bucket)}, nil
+}
+
+func (l Limit) validate() error {
+	if l.Rate <= 0 || l.Burst < 1 {
+		return fmt.Errorf("rate must be positive and burst at least 1, got rate %v burst %d", l.Rate, l.Burst)
+	}
+	return nil
+}
+
+// Allow takes a token from the bucket of client for the full gRPC method name. When the bucket
+// is empty it returns false and how long until a token is available.
+func (l *Limiter) Allow(method, client string) (bool, time.Duration) {
+	pattern, limit, ok := l.match(method)
+	if !ok {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	key := pattern + " " + client
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{
+			limiter: rate.NewLimiter(rate.Limit(limit.Rate), limit.Burst),
+			full:    time.Duration(float64(limit.Burst) / limit.Rate * float64(time.Second)),
+		}
+		l.buckets[key] = b
+	}
+	b.last = now
+
+	r := b.limiter.ReserveN(now, 1)
+	if d := r.DelayFrom(now); d > 0 {
+		r.CancelAt(now)
+		return false, d
+	}
+	return true, 0
+}
+
+// match finds the limit of method: its own entry, then its service's, then the default
+func (l *Limiter) match(method string) (string, Limit, bool) {
+	if lim, ok := l.cfg.Methods[method]; ok {
+		return method, lim, true
+	}
+	service := method[:strings.LastIndex(method, "/")+1] + "*"
+	if lim, ok := l.cfg.Methods[service]; ok {
+		return service, lim, true
+	}
+	if l.cfg.Default != nil {
+		return method, *l.cfg.Default, true
+	}
+	return "", Limit{}, false
+}
+
+// sweep drops buckets idle long enough to be full, recreating them later changes nothing
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for k, b := range l.buckets {
+		if now.Sub(b.last) >= b.full {
+			delete(l.buckets, k)
+		}
+	}
+}
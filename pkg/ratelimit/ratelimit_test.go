@@ -0,0 +1,98 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoad(t *testing.T) {
+	if _, err := Load("../../configs/ratelimit.yaml"); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{"empty", Config{}, false},
+		{"zero rate", Config{Default: &Limit{Rate: 0, Burst: 1}}, true},
+		{"zero burst", Config{Methods: map[string]Limit{"/v1.BookService/ReadAll": {Rate: 1}}}, true},
+		{"invalid method", Config{Methods: map[string]Limit{"ReadAll": {Rate: 1, Burst: 1}}}, true},
+		{"service", Config{Methods: map[string]Limit{"/v1.BookService/*": {Rate: 1, Burst: 1}}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.cfg); (err != nil) != tt.wantErr {
+				t.Errorf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLimiter_Allow(t *testing.T) {
+	l, err := New(Config{
+		Default: &Limit{Rate: 10, Burst: 2},
+		Methods: map[string]Limit{
+			"/v1.BookService/ReadAll": {Rate: 1, Burst: 1},
+			"/v1.ApiKeyService/*":     {Rate: 1, Burst: 1},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(0, 0)
+	l.now = func() time.Time { return now }
+
+	type call struct {
+		after    time.Duration // advance the clock first
+		method   string
+		client   string
+		want     bool
+		wantWait time.Duration
+	}
+	calls := []call{
+		{0, "/v1.BookService/ReadAll", "sub:alice", true, 0},
+		{0, "/v1.BookService/ReadAll", "sub:alice", false, time.Second},
+		// buckets are per client
+		{0, "/v1.BookService/ReadAll", "sub:bob", true, 0},
+		// and per method
+		{0, "/v1.BookService/Read", "sub:alice", true, 0},
+		{0, "/v1.BookService/Read", "sub:alice", true, 0},
+		{0, "/v1.BookService/Read", "sub:alice", false, 100 * time.Millisecond},
+		// rejected calls don't take a token
+		{400 * time.Millisecond, "/v1.BookService/ReadAll", "sub:alice", false, 600 * time.Millisecond},
+		{600 * time.Millisecond, "/v1.BookService/ReadAll", "sub:alice", true, 0},
+		// a service entry is one budget for all its methods
+		{0, "/v1.ApiKeyService/List", "sub:alice", true, 0},
+		{0, "/v1.ApiKeyService/Issue", "sub:alice", false, time.Second},
+	}
+	for i, c := range calls {
+		now = now.Add(c.after)
+		got, wait := l.Allow(c.method, c.client)
+		if got != c.want || wait != c.wantWait {
+			t.Errorf("call %d: Allow(%s, %s) = %v, %v, want %v, %v", i, c.method, c.client, got, wait, c.want, c.wantWait)
+		}
+	}
+
+	// buckets that refilled are dropped on the next sweep
+	now = now.Add(sweepInterval)
+	l.Allow("/v1.BookService/Read", "sub:carol")
+	if len(l.buckets) != 1 {
+		t.Errorf("%d buckets after sweep, want 1", len(l.buckets))
+	}
+}
+
+func TestLimiter_AllowUnlimited(t *testing.T) {
+	l, err := New(Config{Methods: map[string]Limit{"/v1.BookService/ReadAll": {Rate: 1, Burst: 1}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		if ok, _ := l.Allow("/v1.BookService/Read", "ip:10.0.0.1"); !ok {
+			t.Fatalf("call %d of a method without a limit was rejected", i)
+		}
+	}
+}
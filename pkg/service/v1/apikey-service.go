@@ -0,0 +1,266 @@
+package v1
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/lib/pq"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/radean0909/redeam-rest/pkg/api/v1"
+	"github.com/radean0909/redeam-rest/pkg/auth"
+	"github.com/radean0909/redeam-rest/pkg/logger"
+)
+
+const (
+	issueKeySQL  = "INSERT INTO ApiKey (Name, Prefix, Hash, Scopes, ExpiresAt) VALUES ($1, $2, $3, $4, $5) RETURNING Id, CreatedAt"
+	rotateKeySQL = "UPDATE ApiKey SET Prefix=$1, Hash=$2 WHERE Id=$3 AND RevokedAt IS NULL RETURNING Name, Scopes, ExpiresAt, CreatedAt"
+	revokeKeySQL = "UPDATE ApiKey SET RevokedAt=now() WHERE Id=$1 AND RevokedAt IS NULL"
+	listKeysSQL  = "SELECT Id, Name, Prefix, Scopes, ExpiresAt, CreatedAt, RevokedAt FROM ApiKey ORDER BY Id"
+	verifyKeySQL = "SELECT Id, Scopes FROM ApiKey WHERE Hash=$1 AND RevokedAt IS NULL AND (ExpiresAt IS NULL OR ExpiresAt > now())"
+)
+
+// apiKeySubject prefixes the key id in the subject of API key callers, telling them apart from token users
+const apiKeySubject = "apikey:"
+
+type apiKeyServiceServer struct {
+	db *sql.DB
+}
+
+// NewApiKeyServiceServer manages the API keys of machine clients
+func NewApiKeyServiceServer(db *sql.DB) v1.ApiKeyServiceServer {
+	return &apiKeyServiceServer{db: db}
+}
+
+// NewApiKeyVerifier authenticates callers by the API keys issued through the ApiKeyService,
+// the scopes of the key become the roles of the caller
+func NewApiKeyVerifier(db *sql.DB) auth.KeyVerifier {
+	return &apiKeyServiceServer{db: db}
+}
+
+// requireAdmin lets only admins manage keys, also when no authorization policy is configured
+func requireAdmin(ctx context.Context) error {
+	c, ok := auth.FromContext(ctx)
+	if !ok {
+		return status.Error(codes.Unauthenticated, "caller is not authenticated")
+	}
+	if !c.HasRole(auth.AdminRole) {
+		return status.Error(codes.PermissionDenied, "managing API keys requires the "+auth.AdminRole+" role")
+	}
+	return nil
+}
+
+// Issue request/response from proto definition
+func (s *apiKeyServiceServer) Issue(ctx context.Context, req *v1.IssueApiKeyRequest) (*v1.IssueApiKeyResponse, error) {
+	if err := checkAPIVersion(req.Api); err != nil {
+		return nil, err
+	}
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	if req.Name == "" || len(req.Name) > maxFieldLength {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("name must be 1 to %d characters", maxFieldLength))
+	}
+	if len(req.Scopes) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "at least one scope is required")
+	}
+
+	var expiresAt pq.NullTime
+	if req.ExpiresAt != nil {
+		t, err := ptypes.Timestamp(req.ExpiresAt)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "expiresAt field has invalid format: "+err.Error())
+		}
+		if !t.After(time.Now()) {
+			return nil, status.Error(codes.InvalidArgument, "expiresAt must be in the future")
+		}
+		expiresAt = pq.NullTime{Time: t, Valid: true}
+	}
+
+	secret, prefix, hash, err := auth.NewAPIKey()
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to generate key: "+err.Error())
+	}
+
+	key := &v1.ApiKey{
+		Name:      req.Name,
+		Prefix:    prefix,
+		Scopes:    req.Scopes,
+		ExpiresAt: req.ExpiresAt,
+	}
+	var createdAt time.Time
+	qctx, done := traceSQL(ctx, "api_key.issue")
+	err = s.db.QueryRowContext(qctx, issueKeySQL, req.Name, prefix, hash, pq.Array(req.Scopes), expiresAt).Scan(&key.Id, &createdAt)
+	done(err)
+	if err != nil {
+		return nil, status.Error(codes.Unknown, "failed to insert: "+err.Error())
+	}
+	key.CreatedAt, _ = ptypes.TimestampProto(createdAt)
+
+	audit(ctx).Info("issued API key", "key_id", key.Id, "name", key.Name, "prefix", key.Prefix, "scopes", key.Scopes)
+	return &v1.IssueApiKeyResponse{
+		Api:    apiVersion,
+		Key:    key,
+		Secret: secret,
+	}, nil
+}
+
+// List request/response from proto definition
+func (s *apiKeyServiceServer) List(ctx context.Context, req *v1.ListApiKeysRequest) (*v1.ListApiKeysResponse, error) {
+	if err := checkAPIVersion(req.Api); err != nil {
+		return nil, err
+	}
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	qctx, done := traceSQL(ctx, "api_key.list")
+	rows, err := s.db.QueryContext(qctx, listKeysSQL)
+	if err != nil {
+		done(err)
+		return nil, status.Error(codes.Unknown, "couldn't select: "+err.Error())
+	}
+	defer endRows(rows, done)
+
+	keys := []*v1.ApiKey{}
+	for rows.Next() {
+		var (
+			key                  v1.ApiKey
+			createdAt            time.Time
+			expiresAt, revokedAt pq.NullTime
+		)
+		if err := rows.Scan(&key.Id, &key.Name, &key.Prefix, pq.Array(&key.Scopes), &expiresAt, &createdAt, &revokedAt); err != nil {
+			return nil, status.Error(codes.Unknown, "couldn't retrieve field values: "+err.Error())
+		}
+		key.CreatedAt, _ = ptypes.TimestampProto(createdAt)
+		key.ExpiresAt = nullTimestamp(expiresAt)
+		key.RevokedAt = nullTimestamp(revokedAt)
+		keys = append(keys, &key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, status.Error(codes.Unknown, "failed to retrieve data: "+err.Error())
+	}
+
+	return &v1.ListApiKeysResponse{
+		Api:  apiVersion,
+		Keys: keys,
+	}, nil
+}
+
+// Rotate request/response from proto definition
+func (s *apiKeyServiceServer) Rotate(ctx context.Context, req *v1.RotateApiKeyRequest) (*v1.RotateApiKeyResponse, error) {
+	if err := checkAPIVersion(req.Api); err != nil {
+		return nil, err
+	}
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	secret, prefix, hash, err := auth.NewAPIKey()
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to generate key: "+err.Error())
+	}
+
+	key := &v1.ApiKey{Id: req.Id, Prefix: prefix}
+	var (
+		createdAt time.Time
+		expiresAt pq.NullTime
+	)
+	qctx, done := traceSQL(ctx, "api_key.rotate")
+	err = s.db.QueryRowContext(qctx, rotateKeySQL, prefix, hash, req.Id).Scan(&key.Name, pq.Array(&key.Scopes), &expiresAt, &createdAt)
+	done(err)
+	if err == sql.ErrNoRows {
+		return nil, status.Error(codes.NotFound, fmt.Sprintf("cannot find active key Id='%d'", req.Id))
+	}
+	if err != nil {
+		return nil, status.Error(codes.Unknown, "failed to update: "+err.Error())
+	}
+	key.CreatedAt, _ = ptypes.TimestampProto(createdAt)
+	key.ExpiresAt = nullTimestamp(expiresAt)
+
+	audit(ctx).Info("rotated API key", "key_id", key.Id, "prefix", key.Prefix)
+	return &v1.RotateApiKeyResponse{
+		Api:    apiVersion,
+		Key:    key,
+		Secret: secret,
+	}, nil
+}
+
+// Revoke request/response from proto definition
+func (s *apiKeyServiceServer) Revoke(ctx context.Context, req *v1.RevokeApiKeyRequest) (*v1.RevokeApiKeyResponse, error) {
+	if err := checkAPIVersion(req.Api); err != nil {
+		return nil, err
+	}
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	qctx, done := traceSQL(ctx, "api_key.revoke")
+	res, err := s.db.ExecContext(qctx, revokeKeySQL, req.Id)
+	done(err)
+	if err != nil {
+		return nil, status.Error(codes.Unknown, "failed to revoke: "+err.Error())
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return nil, status.Error(codes.Unknown, "failed to retrieve rows affected value: "+err.Error())
+	}
+	if rows == 0 {
+		return nil, status.Error(codes.NotFound, fmt.Sprintf("cannot find active key Id='%d'", req.Id))
+	}
+
+	audit(ctx).Info("revoked API key", "key_id", req.Id)
+	return &v1.RevokeApiKeyResponse{
+		Api:     apiVersion,
+		Revoked: rows,
+	}, nil
+}
+
+// VerifyKey looks up an active, unexpired key by the hash of its secret
+func (s *apiKeyServiceServer) VerifyKey(ctx context.Context, secret string) (*auth.Claims, error) {
+	var (
+		id     int64
+		scopes []string
+	)
+	qctx, done := traceSQL(ctx, "api_key.verify")
+	err := s.db.QueryRowContext(qctx, verifyKeySQL, auth.HashAPIKey(secret)).Scan(&id, pq.Array(&scopes))
+	done(err)
+	if err == sql.ErrNoRows {
+		return nil, auth.ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &auth.Claims{
+		Roles:            scopes,
+		RegisteredClaims: jwt.RegisteredClaims{Subject: apiKeySubject + strconv.FormatInt(id, 10)},
+	}, nil
+}
+
+// audit returns the logger of the request annotated with the caller, secrets must never be logged
+func audit(ctx context.Context) *slog.Logger {
+	l := logger.FromContext(ctx, slog.Default())
+	if c, ok := auth.FromContext(ctx); ok {
+		l = l.With("by", c.Subject)
+	}
+	return l
+}
+
+func nullTimestamp(t pq.NullTime) *timestamp.Timestamp {
+	if !t.Valid {
+		return nil
+	}
+	ts, _ := ptypes.TimestampProto(t.Time)
+	return ts
+}
@@ -0,0 +1,157 @@
+package v1
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/radean0909/redeam-rest/pkg/api/v1"
+	"github.com/radean0909/redeam-rest/pkg/auth"
+)
+
+func Test_apiKeyServiceServer_Issue(t *testing.T) {
+	ctx := auth.NewContext(context.Background(), &auth.Claims{Roles: []string{auth.AdminRole}})
+	// Get the DB
+	db, err := connectToDB()
+
+	if err != nil {
+		t.Errorf("Couldn't connect to DB.")
+	}
+	db.Exec("DELETE FROM ApiKey")
+
+	// Start the server
+	s := NewApiKeyServiceServer(db)
+
+	past, _ := ptypes.TimestampProto(time.Now().Add(-time.Hour))
+
+	tests := []struct {
+		name     string
+		req      *v1.IssueApiKeyRequest
+		wantCode codes.Code
+	}{
+		{
+			name: "OK",
+			req:  &v1.IssueApiKeyRequest{Api: "v1", Name: "partner", Scopes: []string{"patron"}},
+		},
+		{
+			name:     "Missing name",
+			req:      &v1.IssueApiKeyRequest{Api: "v1", Scopes: []string{"patron"}},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "Missing scopes",
+			req:      &v1.IssueApiKeyRequest{Api: "v1", Name: "partner"},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "Already expired",
+			req:      &v1.IssueApiKeyRequest{Api: "v1", Name: "partner", Scopes: []string{"patron"}, ExpiresAt: past},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "Unsupported API",
+			req:      &v1.IssueApiKeyRequest{Api: "v0", Name: "partner", Scopes: []string{"patron"}},
+			wantCode: codes.Unimplemented,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.Issue(ctx, tt.req)
+			if code := status.Code(err); code != tt.wantCode {
+				t.Errorf("apiKeyServiceServer.Issue() code = %v, want %v (%v)", code, tt.wantCode, err)
+				return
+			}
+			if err == nil && (got.Secret == "" || got.Key.Id == 0 || got.Key.Prefix != got.Secret[:len(got.Key.Prefix)]) {
+				t.Errorf("apiKeyServiceServer.Issue() = %v", got)
+			}
+		})
+	}
+}
+
+func Test_apiKeyServiceServer_Lifecycle(t *testing.T) {
+	ctx := auth.NewContext(context.Background(), &auth.Claims{Roles: []string{auth.AdminRole}})
+	// Get the DB
+	db, err := connectToDB()
+
+	if err != nil {
+		t.Errorf("Couldn't connect to DB.")
+	}
+	db.Exec("DELETE FROM ApiKey")
+
+	// Start the server
+	s := NewApiKeyServiceServer(db)
+	keys := NewApiKeyVerifier(db)
+
+	issued, err := s.Issue(ctx, &v1.IssueApiKeyRequest{Api: "v1", Name: "partner", Scopes: []string{"patron", "librarian"}})
+	if err != nil {
+		t.Fatalf("apiKeyServiceServer.Issue() error = %v", err)
+	}
+
+	claims, err := keys.VerifyKey(ctx, issued.Secret)
+	if err != nil {
+		t.Fatalf("VerifyKey() error = %v", err)
+	}
+	if len(claims.Roles) != 2 || claims.Roles[1] != "librarian" {
+		t.Errorf("VerifyKey() roles = %v, want the key scopes", claims.Roles)
+	}
+
+	rotated, err := s.Rotate(ctx, &v1.RotateApiKeyRequest{Api: "v1", Id: issued.Key.Id})
+	if err != nil {
+		t.Fatalf("apiKeyServiceServer.Rotate() error = %v", err)
+	}
+	if _, err := keys.VerifyKey(ctx, issued.Secret); err != auth.ErrInvalidAPIKey {
+		t.Errorf("VerifyKey() of the rotated secret error = %v, want %v", err, auth.ErrInvalidAPIKey)
+	}
+	if _, err := keys.VerifyKey(ctx, rotated.Secret); err != nil {
+		t.Errorf("VerifyKey() of the new secret error = %v", err)
+	}
+
+	if _, err := s.Revoke(ctx, &v1.RevokeApiKeyRequest{Api: "v1", Id: issued.Key.Id}); err != nil {
+		t.Fatalf("apiKeyServiceServer.Revoke() error = %v", err)
+	}
+	if _, err := keys.VerifyKey(ctx, rotated.Secret); err != auth.ErrInvalidAPIKey {
+		t.Errorf("VerifyKey() of a revoked key error = %v, want %v", err, auth.ErrInvalidAPIKey)
+	}
+	if _, err := s.Revoke(ctx, &v1.RevokeApiKeyRequest{Api: "v1", Id: issued.Key.Id}); status.Code(err) != codes.NotFound {
+		t.Errorf("apiKeyServiceServer.Revoke() twice code = %v, want %v", status.Code(err), codes.NotFound)
+	}
+	if _, err := s.Rotate(ctx, &v1.RotateApiKeyRequest{Api: "v1", Id: issued.Key.Id}); status.Code(err) != codes.NotFound {
+		t.Errorf("apiKeyServiceServer.Rotate() of a revoked key code = %v, want %v", status.Code(err), codes.NotFound)
+	}
+
+	list, err := s.List(ctx, &v1.ListApiKeysRequest{Api: "v1"})
+	if err != nil {
+		t.Fatalf("apiKeyServiceServer.List() error = %v", err)
+	}
+	if len(list.Keys) != 1 || list.Keys[0].RevokedAt == nil || list.Keys[0].Prefix != rotated.Key.Prefix {
+		t.Errorf("apiKeyServiceServer.List() = %v", list.Keys)
+	}
+}
+
+func Test_apiKeyServiceServer_RequiresAdmin(t *testing.T) {
+	// callers are turned away before the database is used
+	s := NewApiKeyServiceServer(nil)
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want codes.Code
+	}{
+		{"Anonymous", context.Background(), codes.Unauthenticated},
+		{"Librarian", auth.NewContext(context.Background(), &auth.Claims{Roles: []string{"librarian"}}), codes.PermissionDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := s.Issue(tt.ctx, &v1.IssueApiKeyRequest{Api: "v1", Name: "etl", Scopes: []string{"admin"}}); status.Code(err) != tt.want {
+				t.Errorf("apiKeyServiceServer.Issue() error = %v, want %v", err, tt.want)
+			}
+			if _, err := s.List(tt.ctx, &v1.ListApiKeysRequest{Api: "v1"}); status.Code(err) != tt.want {
+				t.Errorf("apiKeyServiceServer.List() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package v1
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/golang/protobuf/ptypes"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/radean0909/redeam-rest/pkg/api/v1"
+)
+
+const (
+	maxBatchSize = 1000 // keeps a single transaction from holding locks for too long
+)
+
+// batchItem applies entry i of a batch with the prepared statement and returns the affected book Id
+type batchItem func(ctx context.Context, stmt *sql.Stmt, i int) (int64, error)
+
+// runBatch applies n entries in one transaction using a single prepared statement, traced as statement.
+// With allOrNothing the first failing entry rolls back the batch, otherwise every entry
+// runs under its own savepoint and failures are reported in its result.
+func (s *bookServiceServer) runBatch(ctx context.Context, statement string, n int, allOrNothing bool, query string, item batchItem) (results []*v1.BatchResult, err error) {
+	if n == 0 {
+		return nil, status.Error(codes.InvalidArgument, "batch is empty")
+	}
+	if n > maxBatchSize {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("batch of %d entries exceeds the limit of %d", n, maxBatchSize))
+	}
+
+	c, err := s.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	ctx, done := traceSQL(ctx, statement)
+	defer func() { done(err) }()
+
+	tx, err := c.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, status.Error(codes.Unknown, "failed to begin transaction: "+err.Error())
+	}
+	defer tx.Rollback() // no-op once committed
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, status.Error(codes.Unknown, "failed to prepare: "+err.Error())
+	}
+	defer stmt.Close()
+
+	results = make([]*v1.BatchResult, n)
+	failed := 0
+	for i := 0; i < n; i++ {
+		if !allOrNothing {
+			if _, err := tx.ExecContext(ctx, "SAVEPOINT batch_item"); err != nil {
+				return nil, status.Error(codes.Unknown, "failed to create savepoint: "+err.Error())
+			}
+		}
+
+		id, err := item(ctx, stmt, i)
+		if err != nil {
+			st := status.Convert(err)
+			if allOrNothing {
+				return nil, status.Error(st.Code(), fmt.Sprintf("entry %d: %s", i, st.Message()))
+			}
+			if _, err := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT batch_item"); err != nil {
+				return nil, status.Error(codes.Unknown, "failed to roll back entry: "+err.Error())
+			}
+			results[i] = &v1.BatchResult{Id: id, Status: st.Proto()}
+			failed++
+			continue
+		}
+
+		if !allOrNothing {
+			if _, err := tx.ExecContext(ctx, "RELEASE SAVEPOINT batch_item"); err != nil {
+				return nil, status.Error(codes.Unknown, "failed to release savepoint: "+err.Error())
+			}
+		}
+		results[i] = &v1.BatchResult{Id: id, Status: status.New(codes.OK, "").Proto()}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, status.Error(codes.Unknown, "failed to commit: "+err.Error())
+	}
+	ids := make([]int64, len(results))
+	for i, r := range results {
+		ids[i] = r.Id
+	}
+	s.invalidate(ctx, ids...)
+
+	s.log(ctx).Info("applied batch", "statement", statement, "entries", n, "failed", failed)
+	return results, nil
+}
+
+// BatchCreate request/response from proto definition
+func (s *bookServiceServer) BatchCreate(ctx context.Context, req *v1.BatchCreateRequest) (*v1.BatchCreateResponse, error) {
+	if err := s.checkAPI(req.Api); err != nil {
+		return nil, err
+	}
+
+	results, err := s.runBatch(ctx, "book.batch_create", len(req.Books), req.AllOrNothing, createSQL, func(ctx context.Context, stmt *sql.Stmt, i int) (int64, error) {
+		book := req.Books[i]
+		if book == nil {
+			return 0, status.Error(codes.InvalidArgument, "invalid data format")
+		}
+
+		publishDate, err := ptypes.Timestamp(book.PublishDate)
+		if err != nil {
+			return 0, status.Error(codes.InvalidArgument, "publishDate field has invalid format: "+err.Error())
+		}
+
+		var id int64
+		err = stmt.QueryRowContext(ctx, book.Title, book.Author, book.Publisher, publishDate, book.Rating, book.Status, book.Isbn, actor(ctx)).Scan(&id)
+		if err != nil {
+			return 0, status.Error(codes.Unknown, "failed to insert: "+err.Error())
+		}
+		return id, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &v1.BatchCreateResponse{
+		Api:     apiVersion,
+		Results: results,
+	}, nil
+}
+
+// BatchUpdate request/response from proto definition
+func (s *bookServiceServer) BatchUpdate(ctx context.Context, req *v1.BatchUpdateRequest) (*v1.BatchUpdateResponse, error) {
+	if err := s.checkAPI(req.Api); err != nil {
+		return nil, err
+	}
+
+	results, err := s.runBatch(ctx, "book.batch_update", len(req.Books), req.AllOrNothing, updateSQL, func(ctx context.Context, stmt *sql.Stmt, i int) (int64, error) {
+		book := req.Books[i]
+		if book == nil {
+			return 0, status.Error(codes.InvalidArgument, "invalid data format")
+		}
+
+		publishDate, err := ptypes.Timestamp(book.PublishDate)
+		if err != nil {
+			return book.Id, status.Error(codes.InvalidArgument, "publishDate field has invalid format: "+err.Error())
+		}
+
+		res, err := stmt.ExecContext(ctx, book.Title, book.Author, book.Publisher, publishDate, book.Rating, book.Status, book.Isbn, book.Id, actor(ctx))
+		if err != nil {
+			return book.Id, status.Error(codes.Unknown, "failed to update: "+err.Error())
+		}
+		return book.Id, checkAffected(res, book.Id)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &v1.BatchUpdateResponse{
+		Api:     apiVersion,
+		Results: results,
+	}, nil
+}
+
+// BatchDelete request/response from proto definition
+func (s *bookServiceServer) BatchDelete(ctx context.Context, req *v1.BatchDeleteRequest) (*v1.BatchDeleteResponse, error) {
+	if err := s.checkAPI(req.Api); err != nil {
+		return nil, err
+	}
+
+	results, err := s.runBatch(ctx, "book.batch_delete", len(req.Ids), req.AllOrNothing, deleteSQL, func(ctx context.Context, stmt *sql.Stmt, i int) (int64, error) {
+		id := req.Ids[i]
+		res, err := stmt.ExecContext(ctx, id)
+		if err != nil {
+			return id, status.Error(codes.Unknown, "failed to delete: "+err.Error())
+		}
+		return id, checkAffected(res, id)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &v1.BatchDeleteResponse{
+		Api:     apiVersion,
+		Results: results,
+	}, nil
+}
+
+// checkAffected reports NotFound when a statement didn't touch the row with the given Id
+func checkAffected(res sql.Result, id int64) error {
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return status.Error(codes.Unknown, "failed to retrieve rows affected value: "+err.Error())
+	}
+	if rows == 0 {
+		return status.Error(codes.NotFound, fmt.Sprintf("Id='%d' is not found", id))
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package v1
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/radean0909/redeam-rest/pkg/api/v1"
+)
+
+func Test_bookServiceServer_BatchCreate(t *testing.T) {
+	ctx := context.Background()
+	// Get the DB
+	db, err := connectToDB()
+
+	if err != nil {
+		t.Errorf("Couldn't connect to DB.")
+	}
+	// Clear the table
+	clearTable(db)
+
+	// Start the server
+	s := NewBookServiceServer(db)
+
+	now, _ := time.Parse("RFC3339", "2002-10-02T10:00:00")
+	publishDate, _ := ptypes.TimestampProto(now)
+	book := &v1.Book{
+		Title:       "title",
+		Author:      "author",
+		Publisher:   "publisher",
+		PublishDate: publishDate,
+		Rating:      2.0,
+		Status:      1,
+	}
+
+	tests := []struct {
+		name      string
+		req       *v1.BatchCreateRequest
+		wantCodes []codes.Code
+		wantErr   bool
+	}{
+		{
+			name: "Per entry results",
+			req: &v1.BatchCreateRequest{
+				Api:   "v1",
+				Books: []*v1.Book{book, nil, book},
+			},
+			wantCodes: []codes.Code{codes.OK, codes.InvalidArgument, codes.OK},
+		},
+		{
+			name: "All or nothing",
+			req: &v1.BatchCreateRequest{
+				Api:          "v1",
+				Books:        []*v1.Book{book, nil},
+				AllOrNothing: true,
+			},
+			wantErr: true,
+		},
+		{
+			name: "Empty batch",
+			req: &v1.BatchCreateRequest{
+				Api: "v1",
+			},
+			wantErr: true,
+		},
+		{
+			name: "Invalid API Version",
+			req: &v1.BatchCreateRequest{
+				Api:   "v10000",
+				Books: []*v1.Book{book},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.BatchCreate(ctx, tt.req)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("bookServiceServer.BatchCreate() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+			if len(got.Results) != len(tt.wantCodes) {
+				t.Errorf("bookServiceServer.BatchCreate() returned %d results, want %d", len(got.Results), len(tt.wantCodes))
+				return
+			}
+			for i, r := range got.Results {
+				if c := status.FromProto(r.Status).Code(); c != tt.wantCodes[i] {
+					t.Errorf("bookServiceServer.BatchCreate() result %d = %v, want %v", i, c, tt.wantCodes[i])
+				}
+			}
+		})
+	}
+
+	// Only the successful entries of the first batch should have been stored
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM Book").Scan(&count); err != nil {
+		t.Errorf("Couldn't count books: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Book table has %d rows, want 2", count)
+	}
+
+	defer db.Close()
+}
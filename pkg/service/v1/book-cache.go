@@ -0,0 +1,157 @@
+package v1
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/radean0909/redeam-rest/pkg/cache"
+)
+
+const (
+	// bookKeyPrefix and listKeyPrefix start the cache keys of Read and ReadAll responses
+	bookKeyPrefix = "book:"
+	listKeyPrefix = "books:"
+
+	// ETagMetadata and LastModifiedMetadata are the response header metadata carrying the validators of
+	// Read and ReadAll responses, the gateway sends them as the ETag and Last-Modified HTTP headers
+	ETagMetadata         = "etag"
+	LastModifiedMetadata = "last-modified"
+
+	// lastChangeSQL reads the sequence of the last change of the Book table and when it was made
+	lastChangeSQL = "SELECT Seq, ChangedAt FROM BookChange ORDER BY Seq DESC LIMIT 1"
+)
+
+// WithCache reads Read and ReadAll responses through c. Mutations made by this server drop what they
+// change right away, those of other servers sharing the database show once the entries expire.
+func WithCache(c cache.Cache) Option {
+	return func(s *bookServiceServer) {
+		s.cache = c
+	}
+}
+
+// cacheGet decodes the response cached under key into msg and returns when its data last changed
+func (s *bookServiceServer) cacheGet(ctx context.Context, key string, msg proto.Message) (time.Time, bool) {
+	if s.cache == nil {
+		return time.Time{}, false
+	}
+	b, ok := s.cache.Get(ctx, key)
+	if !ok || len(b) < 8 {
+		return time.Time{}, false
+	}
+	if err := proto.Unmarshal(b[8:], msg); err != nil {
+		s.log(ctx).Warn("dropping undecodable cache entry", "key", key, "error", err)
+		s.cache.Delete(ctx, key)
+		return time.Time{}, false
+	}
+	var modified time.Time
+	if nanos := int64(binary.BigEndian.Uint64(b)); nanos != 0 {
+		modified = time.Unix(0, nanos).UTC()
+	}
+	return modified, true
+}
+
+// cacheGeneration is taken before reading what will be cached, see cacheSet
+func (s *bookServiceServer) cacheGeneration() uint64 {
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+	return s.cacheGen
+}
+
+// cacheSet stores msg under key along with when its data last changed, unless the cache was
+// invalidated since gen was taken: msg may then predate a change whose invalidation already ran
+func (s *bookServiceServer) cacheSet(ctx context.Context, key string, msg proto.Message, modified time.Time, gen uint64) {
+	if s.cache == nil {
+		return
+	}
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		return
+	}
+	b := make([]byte, 8, 8+len(data))
+	if !modified.IsZero() {
+		binary.BigEndian.PutUint64(b, uint64(modified.UnixNano()))
+	}
+
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+	if s.cacheGen != gen {
+		return
+	}
+	s.cache.Set(ctx, key, append(b, data...))
+}
+
+// invalidate drops the cached books with ids and every cached list
+func (s *bookServiceServer) invalidate(ctx context.Context, ids ...int64) {
+	if s.cache == nil {
+		return
+	}
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = bookKey(id)
+	}
+
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+	s.cacheGen++
+	s.cache.Delete(ctx, keys...)
+	s.cache.DeletePrefix(ctx, listKeyPrefix)
+}
+
+func bookKey(id int64) string {
+	return bookKeyPrefix + strconv.FormatInt(id, 10)
+}
+
+// lastChange returns the sequence of the last change of the Book table and when it was made, zeros
+// before the first change
+func (s *bookServiceServer) lastChange(ctx context.Context) (_ int64, _ time.Time, err error) {
+	c, err := s.connect(ctx)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	defer c.Close()
+
+	ctx, done := traceSQL(ctx, "book.last_change")
+	defer func() { done(err) }()
+
+	var (
+		seq     int64
+		changed time.Time
+	)
+	err = c.QueryRowContext(ctx, lastChangeSQL).Scan(&seq, &changed)
+	if err == sql.ErrNoRows {
+		return 0, time.Time{}, nil
+	}
+	if err != nil {
+		return 0, time.Time{}, status.Error(codes.Unknown, "failed to read last change: "+err.Error())
+	}
+	return seq, changed, nil
+}
+
+// setValidators sends the ETag of msg and the time its data last changed as header metadata, so
+// clients can revalidate what they hold instead of reading it again. Only the ETag, a hash of msg,
+// tells every change apart: HTTP dates are whole seconds.
+func setValidators(ctx context.Context, msg proto.Message, modified time.Time) {
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		return
+	}
+	sum := sha256.Sum256(data)
+	// weak, the gateway may encode the same message differently, e.g. compressed
+	md := metadata.Pairs(ETagMetadata, `W/"`+hex.EncodeToString(sum[:16])+`"`)
+	if !modified.IsZero() {
+		md.Set(LastModifiedMetadata, modified.UTC().Format(http.TimeFormat))
+	}
+	grpc.SetHeader(ctx, md)
+}
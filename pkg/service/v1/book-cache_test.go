@@ -0,0 +1,32 @@
+package v1
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/radean0909/redeam-rest/pkg/api/v1"
+	"github.com/radean0909/redeam-rest/pkg/cache"
+)
+
+func Test_bookServiceServer_cacheSet(t *testing.T) {
+	ctx := context.Background()
+	s := &bookServiceServer{cache: cache.NewLRU(10, time.Minute)}
+	stale := &v1.ReadResponse{Api: "v1", Book: &v1.Book{Id: 1, Title: "title"}}
+
+	// a Read loads the book, an Update changes and invalidates it before the Read stores what it loaded
+	gen := s.cacheGeneration()
+	s.invalidate(ctx, 1)
+	s.cacheSet(ctx, bookKey(1), stale, time.Time{}, gen)
+	if _, ok := s.cacheGet(ctx, bookKey(1), new(v1.ReadResponse)); ok {
+		t.Errorf("cacheSet() stored a response loaded before the invalidation")
+	}
+
+	// without a change in between the next Read stores its response
+	gen = s.cacheGeneration()
+	s.cacheSet(ctx, bookKey(1), stale, time.Time{}, gen)
+	got := new(v1.ReadResponse)
+	if _, ok := s.cacheGet(ctx, bookKey(1), got); !ok || got.Book.Title != "title" {
+		t.Errorf("cacheGet() = %v, %v, want the stored response", got, ok)
+	}
+}
@@ -0,0 +1,163 @@
+package v1
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+	"unicode/utf8"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/lib/pq"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/radean0909/redeam-rest/pkg/api/v1"
+)
+
+const (
+	maxFieldLength = 200 // varchar size of the Book text columns
+	maxIsbnLength  = 20
+)
+
+// ImportBooks request/response from proto definition.
+// Valid books are streamed into Postgres with COPY inside one transaction, invalid ones are
+// skipped and reported. A database error aborts the whole import. In dry run mode the books
+// are validated and counted but the transaction is never committed.
+func (s *bookServiceServer) ImportBooks(stream v1.BookService_ImportBooksServer) error {
+	first, err := stream.Recv()
+	if err == io.EOF {
+		return stream.SendAndClose(&v1.ImportBooksResponse{Api: apiVersion})
+	}
+	if err != nil {
+		return err
+	}
+	if err := s.checkAPI(first.Api); err != nil {
+		return err
+	}
+
+	next := func() (*v1.Book, error) {
+		if first != nil {
+			b := first.Book
+			first = nil
+			return b, nil
+		}
+		req, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		if err := s.checkAPI(req.Api); err != nil {
+			return nil, err
+		}
+		return req.Book, nil
+	}
+
+	res, err := s.copyBooks(stream.Context(), first.DryRun, next)
+	if err != nil {
+		return err
+	}
+	return stream.SendAndClose(res)
+}
+
+// copyBooks imports books returned by next until it returns io.EOF, any other error aborts the import
+func (s *bookServiceServer) copyBooks(ctx context.Context, dryRun bool, next func() (*v1.Book, error)) (_ *v1.ImportBooksResponse, err error) {
+	c, err := s.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	ctx, done := traceSQL(ctx, "book.copy")
+	defer func() { done(err) }()
+
+	tx, err := c.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, status.Error(codes.Unknown, "failed to begin transaction: "+err.Error())
+	}
+	defer tx.Rollback() // no-op once committed
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("book", "title", "author", "publisher", "publishdate", "rating", "status", "isbn", "createdby", "updatedby"))
+	if err != nil {
+		return nil, status.Error(codes.Unknown, "failed to start copy: "+err.Error())
+	}
+	defer stmt.Close()
+
+	by := actor(ctx)
+	res := &v1.ImportBooksResponse{Api: apiVersion}
+	for {
+		b, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		res.Received++
+
+		publishDate, err := validateImport(b)
+		if err != nil {
+			res.Errors = append(res.Errors, &v1.ImportError{
+				Row:    res.Received,
+				Status: status.Convert(err).Proto(),
+			})
+			continue
+		}
+
+		if dryRun {
+			res.Imported++
+			continue
+		}
+
+		if _, err := stmt.ExecContext(ctx, b.Title, b.Author, b.Publisher, publishDate, b.Rating, int32(b.Status), b.Isbn, by, by); err != nil {
+			return nil, status.Error(codes.Unknown, fmt.Sprintf("failed to copy row %d: %s", res.Received, err.Error()))
+		}
+		res.Imported++
+	}
+
+	if dryRun {
+		s.log(ctx).Info("validated import", "received", res.Received, "valid", res.Imported, "rejected", len(res.Errors))
+		return res, nil
+	}
+
+	// flush buffered rows
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		return nil, status.Error(codes.Unknown, "failed to copy: "+err.Error())
+	}
+	if err := stmt.Close(); err != nil {
+		return nil, status.Error(codes.Unknown, "failed to copy: "+err.Error())
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, status.Error(codes.Unknown, "failed to commit: "+err.Error())
+	}
+	s.invalidate(ctx)
+
+	s.log(ctx).Info("imported books", "received", res.Received, "imported", res.Imported, "rejected", len(res.Errors))
+	return res, nil
+}
+
+// validateImport catches the errors that would otherwise abort the whole COPY
+func validateImport(b *v1.Book) (time.Time, error) {
+	if b == nil {
+		return time.Time{}, status.Error(codes.InvalidArgument, "invalid data format")
+	}
+
+	publishDate, err := ptypes.Timestamp(b.PublishDate)
+	if err != nil {
+		return time.Time{}, status.Error(codes.InvalidArgument, "publishDate field has invalid format: "+err.Error())
+	}
+
+	for _, f := range []struct{ name, value string }{{"title", b.Title}, {"author", b.Author}, {"publisher", b.Publisher}} {
+		if utf8.RuneCountInString(f.value) > maxFieldLength {
+			return time.Time{}, status.Error(codes.InvalidArgument, fmt.Sprintf("%s field is longer than %d characters", f.name, maxFieldLength))
+		}
+	}
+	if len(b.Isbn) > maxIsbnLength {
+		return time.Time{}, status.Error(codes.InvalidArgument, fmt.Sprintf("isbn field is longer than %d characters", maxIsbnLength))
+	}
+
+	if _, ok := v1.Book_Status_name[int32(b.Status)]; !ok {
+		return time.Time{}, status.Error(codes.InvalidArgument, fmt.Sprintf("status field has unknown value %d", b.Status))
+	}
+
+	return publishDate, nil
+}
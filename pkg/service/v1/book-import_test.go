@@ -0,0 +1,70 @@
+package v1
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/radean0909/redeam-rest/pkg/api/v1"
+)
+
+func Test_validateImport(t *testing.T) {
+	now, _ := time.Parse(time.RFC3339, "2002-10-02T10:00:00Z")
+	publishDate, _ := ptypes.TimestampProto(now)
+
+	tests := []struct {
+		name     string
+		book     *v1.Book
+		wantCode codes.Code
+	}{
+		{
+			name: "OK",
+			book: &v1.Book{
+				Title:       "title",
+				Author:      "author",
+				Publisher:   "publisher",
+				PublishDate: publishDate,
+				Rating:      2.0,
+				Status:      1,
+			},
+			wantCode: codes.OK,
+		},
+		{
+			name:     "Missing book",
+			book:     nil,
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "Missing publish date",
+			book:     &v1.Book{Title: "title"},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "Title too long",
+			book:     &v1.Book{Title: strings.Repeat("x", 201), PublishDate: publishDate},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "Unknown status",
+			book:     &v1.Book{Title: "title", PublishDate: publishDate, Status: 42},
+			wantCode: codes.InvalidArgument,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := validateImport(tt.book)
+			if c := status.Code(err); c != tt.wantCode {
+				t.Errorf("validateImport() error = %v, want code %v", err, tt.wantCode)
+				return
+			}
+			if err == nil && !got.Equal(now) {
+				t.Errorf("validateImport() = %v, want %v", got, now)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package v1
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/radean0909/redeam-rest/pkg/api/v1"
+	"github.com/radean0909/redeam-rest/pkg/marc"
+)
+
+const (
+	// marcPageSize is how many books ExportMarc reads at a time
+	marcPageSize = 500
+	// marcChunkSize is the amount of encoded records from which ExportMarc sends them
+	marcChunkSize = 64 << 10
+)
+
+// ImportMarc request/response from proto definition.
+// Records that can't be mapped to a book are skipped and reported, a malformed file aborts the import.
+func (s *bookServiceServer) ImportMarc(ctx context.Context, req *v1.ImportMarcRequest) (*v1.ImportBooksResponse, error) {
+	if err := s.checkAPI(req.Api); err != nil {
+		return nil, err
+	}
+
+	var read func() (*marc.Record, error)
+	switch req.Format {
+	case v1.MarcFormat_ISO2709:
+		read = marc.NewReader(bytes.NewReader(req.Data)).Read
+	case v1.MarcFormat_MARCXML:
+		read = marc.NewXMLReader(bytes.NewReader(req.Data)).Read
+	default:
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("unsupported MARC format %v", req.Format))
+	}
+
+	var (
+		n       int64             // records read so far
+		rows    []int64           // record number of each book handed to copyBooks
+		skipped []*v1.ImportError // records that couldn't be mapped
+	)
+	next := func() (*v1.Book, error) {
+		for {
+			rec, err := read()
+			if err == io.EOF {
+				return nil, io.EOF
+			}
+			n++
+			if err != nil {
+				return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("record %d: %v", n, err))
+			}
+
+			book, err := marc.ToBook(rec)
+			if err != nil {
+				skipped = append(skipped, &v1.ImportError{
+					Row:    n,
+					Status: status.New(codes.InvalidArgument, err.Error()).Proto(),
+				})
+				continue
+			}
+			rows = append(rows, n)
+			return book, nil
+		}
+	}
+
+	res, err := s.copyBooks(ctx, req.DryRun, next)
+	if err != nil {
+		return nil, err
+	}
+
+	// copyBooks numbers rows by the books it was given, report record numbers instead
+	for _, e := range res.Errors {
+		e.Row = rows[e.Row-1]
+	}
+	res.Errors = append(res.Errors, skipped...)
+	sort.Slice(res.Errors, func(i, j int) bool { return res.Errors[i].Row < res.Errors[j].Row })
+	res.Received = n
+
+	return res, nil
+}
+
+// ExportMarc request/response from proto definition.
+// Books are read marcPageSize at a time and sent in parts of about marcChunkSize bytes.
+func (s *bookServiceServer) ExportMarc(req *v1.ExportMarcRequest, stream v1.BookService_ExportMarcServer) error {
+	if err := s.checkAPI(req.Api); err != nil {
+		return err
+	}
+
+	var (
+		buf    bytes.Buffer
+		write  func(*marc.Record) error
+		finish = func() error { return nil }
+	)
+	switch req.Format {
+	case v1.MarcFormat_ISO2709:
+		write = marc.NewWriter(&buf).Write
+	case v1.MarcFormat_MARCXML:
+		w := marc.NewXMLWriter(&buf)
+		write, finish = w.Write, w.Close
+	default:
+		return status.Error(codes.InvalidArgument, fmt.Sprintf("unsupported MARC format %v", req.Format))
+	}
+
+	var exported int64
+	send := func() error {
+		data := append([]byte(nil), buf.Bytes()...)
+		buf.Reset()
+		return stream.Send(&v1.ExportMarcResponse{Api: apiVersion, Data: data, Exported: exported})
+	}
+
+	ctx := stream.Context()
+	for after := int64(0); ; {
+		list, err := s.listBooks(ctx, after, marcPageSize, time.Time{}, 0)
+		if err != nil {
+			return err
+		}
+		for _, b := range list {
+			if err := write(marc.FromBook(b)); err != nil {
+				return status.Error(codes.Unknown, fmt.Sprintf("failed to encode Id='%d': %s", b.Id, err.Error()))
+			}
+			exported++
+			if buf.Len() >= marcChunkSize {
+				if err := send(); err != nil {
+					return err
+				}
+			}
+		}
+		if len(list) < marcPageSize {
+			break
+		}
+		after = list[len(list)-1].Id
+	}
+	if err := finish(); err != nil {
+		return status.Error(codes.Unknown, "failed to encode: "+err.Error())
+	}
+
+	// the last part carries the total, even when there is nothing left to send
+	return send()
+}
@@ -0,0 +1,70 @@
+package v1
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"google.golang.org/grpc"
+
+	"github.com/radean0909/redeam-rest/pkg/api/v1"
+	"github.com/radean0909/redeam-rest/pkg/marc"
+)
+
+// exportStream collects the parts sent by ExportMarc
+type exportStream struct {
+	grpc.ServerStream
+	parts []*v1.ExportMarcResponse
+}
+
+func (s *exportStream) Context() context.Context {
+	return context.Background()
+}
+
+func (s *exportStream) Send(res *v1.ExportMarcResponse) error {
+	s.parts = append(s.parts, res)
+	return nil
+}
+
+func Test_bookServiceServer_ExportMarc(t *testing.T) {
+	db, err := connectToDB()
+	if err != nil {
+		t.Fatalf("Couldn't connect to DB.")
+	}
+	defer db.Close()
+	if err := db.Ping(); err != nil {
+		t.Fatalf("Couldn't connect to DB: %v", err)
+	}
+	// more than a page, so the export reads the books in two
+	num := marcPageSize + 1
+	addEntries(num)
+	s := NewBookServiceServer(db)
+
+	stream := &exportStream{}
+	if err := s.ExportMarc(&v1.ExportMarcRequest{Api: "v1", Format: v1.MarcFormat_ISO2709}, stream); err != nil {
+		t.Fatalf("bookServiceServer.ExportMarc() error = %v", err)
+	}
+
+	var data bytes.Buffer
+	for _, p := range stream.parts {
+		data.Write(p.Data)
+	}
+	if total := stream.parts[len(stream.parts)-1].Exported; total != int64(num) {
+		t.Errorf("exported = %d, want %d", total, num)
+	}
+
+	r := marc.NewReader(&data)
+	var records int
+	for {
+		if _, err := r.Read(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("record %d: %v", records+1, err)
+		}
+		records++
+	}
+	if records != num {
+		t.Errorf("records = %d, want %d", records, num)
+	}
+}
@@ -0,0 +1,71 @@
+package v1
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/radean0909/redeam-rest/pkg/api/v1"
+)
+
+// collectTimeout bounds the query run on every scrape
+const collectTimeout = 5 * time.Second
+
+type bookCollector struct {
+	db    *sql.DB
+	books *prometheus.Desc
+}
+
+// NewBookCollector reports the number of books by status, counted from the database on every scrape
+func NewBookCollector(db *sql.DB) prometheus.Collector {
+	return &bookCollector{
+		db: db,
+		books: prometheus.NewDesc("redeam_books",
+			"Number of books in the library by status.", []string{"status"}, nil),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *bookCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.books
+}
+
+// Collect implements prometheus.Collector
+func (c *bookCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), collectTimeout)
+	defer cancel()
+
+	rows, err := c.db.QueryContext(ctx, "SELECT COALESCE(Status, 0), COUNT(*) FROM Book GROUP BY 1")
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.books, err)
+		return
+	}
+	defer rows.Close()
+
+	// report every status so a series drops to zero instead of disappearing
+	counts := make(map[v1.Book_Status]float64, len(v1.Book_Status_name))
+	for s := range v1.Book_Status_name {
+		counts[v1.Book_Status(s)] = 0
+	}
+	for rows.Next() {
+		var (
+			s v1.Book_Status
+			n float64
+		)
+		if err := rows.Scan(&s, &n); err != nil {
+			ch <- prometheus.NewInvalidMetric(c.books, err)
+			return
+		}
+		counts[s] += n
+	}
+	if err := rows.Err(); err != nil {
+		ch <- prometheus.NewInvalidMetric(c.books, err)
+		return
+	}
+
+	for s, n := range counts {
+		ch <- prometheus.MustNewConstMetric(c.books, prometheus.GaugeValue, n, s.String())
+	}
+}
@@ -0,0 +1,30 @@
+package v1
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func Test_bookCollector(t *testing.T) {
+	// Get the DB
+	db, err := connectToDB()
+
+	if err != nil {
+		t.Errorf("Couldn't connect to DB.")
+	}
+	// 3 books checked out, see addEntries
+	addEntries(3)
+
+	want := `
+# HELP redeam_books Number of books in the library by status.
+# TYPE redeam_books gauge
+redeam_books{status="CHECKED_IN"} 0
+redeam_books{status="CHECKED_OUT"} 3
+redeam_books{status="UNKNOWN"} 0
+`
+	if err := testutil.CollectAndCompare(NewBookCollector(db), strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+}
@@ -3,7 +3,12 @@ package v1
 import (
 	"context"
 	"database/sql"
+	"encoding/base64"
 	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang/protobuf/ptypes"
@@ -11,22 +16,87 @@ import (
 	"google.golang.org/grpc/status"
 
 	"github.com/radean0909/redeam-rest/pkg/api/v1"
+	"github.com/radean0909/redeam-rest/pkg/auth"
+	"github.com/radean0909/redeam-rest/pkg/cache"
+	"github.com/radean0909/redeam-rest/pkg/logger"
 )
 
 const (
 	apiVersion = "v1" // sanity check
+
+	createSQL = `INSERT INTO Book (Title, Author, Publisher, PublishDate, Rating, Status, Isbn, CreatedBy, UpdatedBy) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $8) RETURNING Id`
+	updateSQL = "UPDATE Book SET Title=$1, Author=$2, Publisher=$3, PublishDate=$4, Rating=$5, Status=$6, Isbn=$7, UpdatedAt=now(), UpdatedBy=$9 WHERE Id=$8"
+	deleteSQL = "DELETE FROM Book WHERE Id=$1"
+	listSQL   = "SELECT Id, Title, Author, Publisher, PublishDate, Rating, Status, Isbn, CreatedAt, UpdatedAt, CreatedBy, UpdatedBy FROM Book WHERE Id > $1 AND UpdatedAt >= $2"
+	readSQL   = "SELECT Id, Title, Author, Publisher, PublishDate, Rating, Status, Isbn, CreatedAt, UpdatedAt, CreatedBy, UpdatedBy FROM Book WHERE Id=$1"
+
+	// maxPageSize bounds ReadAll pages, larger page sizes are lowered to it
+	maxPageSize = 1000
 )
 
+// Tables lists the tables the services need, see init-db.sql
+var Tables = []string{"book", "bookchange", "apikey", "idempotencykey", "schemaversion"}
+
+// SchemaVersion is the version of init-db.sql the services need
+const SchemaVersion = 4
+
 type bookServiceServer struct {
-	db *sql.DB
+	db       *sql.DB
+	notifier ChangeNotifier
+	logger   *slog.Logger
+	cache    cache.Cache
+	stopping <-chan struct{}
+
+	// cacheMu orders cacheSet against invalidate, cacheGen counts the invalidations
+	cacheMu  sync.Mutex
+	cacheGen uint64
+}
+
+// Option configures optional collaborators of the book service
+type Option func(*bookServiceServer)
+
+// WithNotifier wakes WatchBooks streams as soon as the Book table changes
+func WithNotifier(n ChangeNotifier) Option {
+	return func(s *bookServiceServer) {
+		s.notifier = n
+	}
+}
+
+// WithShutdown ends WatchBooks streams with Unavailable once stopping is closed, so they don't hold
+// up a graceful stop of the server. Clients resume them with since_sequence.
+func WithShutdown(stopping <-chan struct{}) Option {
+	return func(s *bookServiceServer) {
+		s.stopping = stopping
+	}
 }
 
-func NewBookServiceServer(db *sql.DB) v1.BookServiceServer {
-	return &bookServiceServer{db: db}
+// WithLogger sets the logger used outside of requests, calls log with the request scoped logger
+// of the logging interceptor when there is one
+func WithLogger(l *slog.Logger) Option {
+	return func(s *bookServiceServer) {
+		s.logger = l
+	}
+}
+
+func NewBookServiceServer(db *sql.DB, opts ...Option) v1.BookServiceServer {
+	s := &bookServiceServer{db: db, logger: slog.Default()}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// log returns the logger of the request
+func (s *bookServiceServer) log(ctx context.Context) *slog.Logger {
+	return logger.FromContext(ctx, s.logger)
 }
 
 // version sanity check
 func (s *bookServiceServer) checkAPI(api string) error {
+	return checkAPIVersion(api)
+}
+
+func checkAPIVersion(api string) error {
 	if len(api) > 0 {
 		if apiVersion != api {
 			return status.Errorf(codes.Unimplemented,
@@ -68,7 +138,6 @@ func (s *bookServiceServer) Create(ctx context.Context, req *v1.CreateRequest) (
 		return nil, status.Error(codes.InvalidArgument, "publishDate field has invalid format: "+err.Error())
 	}
 
-	createSQL := `INSERT INTO Book (Title, Author, Publisher, PublishDate, Rating, Status) VALUES ($1, $2, $3, $4, $5, $6) RETURNING Id`
 	var id int64
 
 	stmt, err := c.PrepareContext(ctx, createSQL)
@@ -77,10 +146,13 @@ func (s *bookServiceServer) Create(ctx context.Context, req *v1.CreateRequest) (
 	}
 	defer stmt.Close()
 
-	err = stmt.QueryRow(req.Book.Title, req.Book.Author, req.Book.Publisher, publishDate, req.Book.Rating, req.Book.Status).Scan(&id)
+	qctx, done := traceSQL(ctx, "book.create")
+	err = stmt.QueryRowContext(qctx, req.Book.Title, req.Book.Author, req.Book.Publisher, publishDate, req.Book.Rating, req.Book.Status, req.Book.Isbn, actor(ctx)).Scan(&id)
+	done(err)
 	if err != nil {
 		return nil, status.Error(codes.Unknown, "failed to insert: "+err.Error())
 	}
+	s.invalidate(ctx)
 
 	return &v1.CreateResponse{
 		Api: apiVersion,
@@ -93,18 +165,27 @@ func (s *bookServiceServer) Read(ctx context.Context, req *v1.ReadRequest) (*v1.
 	if err := s.checkAPI(req.Api); err != nil {
 		return nil, err
 	}
+	key := bookKey(req.Id)
+	cached := new(v1.ReadResponse)
+	if modified, ok := s.cacheGet(ctx, key, cached); ok {
+		setValidators(ctx, cached, modified)
+		return cached, nil
+	}
+	gen := s.cacheGeneration()
+
 	c, err := s.connect(ctx)
 	if err != nil {
 		return nil, err
 	}
 	defer c.Close()
 
-	rows, err := c.QueryContext(ctx, "SELECT Id, Title, Author, Publisher, PublishDate, Rating, Status FROM Book WHERE Id=$1",
-		req.Id)
+	qctx, done := traceSQL(ctx, "book.read")
+	rows, err := c.QueryContext(qctx, readSQL, req.Id)
 	if err != nil {
+		done(err)
 		return nil, status.Error(codes.Unknown, "couldn't select: "+err.Error())
 	}
-	defer rows.Close()
+	defer endRows(rows, done)
 
 	if !rows.Next() {
 		if err := rows.Err(); err != nil {
@@ -115,10 +196,12 @@ func (s *bookServiceServer) Read(ctx context.Context, req *v1.ReadRequest) (*v1.
 	}
 
 	var row v1.Book
-	var publishDate time.Time
-	if err := rows.Scan(&row.Id, &row.Title, &row.Author, &row.Publisher, &publishDate, &row.Rating, &row.Status); err != nil {
+	var publishDate, created, modified time.Time
+	if err := rows.Scan(&row.Id, &row.Title, &row.Author, &row.Publisher, &publishDate, &row.Rating, &row.Status, &row.Isbn,
+		&created, &modified, &row.CreatedBy, &row.UpdatedBy); err != nil {
 		return nil, status.Error(codes.Unknown, "couldn't retrieve field values: "+err.Error())
 	}
+	setAuditTimes(&row, created, modified)
 	row.PublishDate, err = ptypes.TimestampProto(publishDate)
 	if err != nil {
 		return nil, status.Error(codes.InvalidArgument, "publishDate field has invalid format: "+err.Error())
@@ -129,11 +212,13 @@ func (s *bookServiceServer) Read(ctx context.Context, req *v1.ReadRequest) (*v1.
 			req.Id))
 	}
 
-	return &v1.ReadResponse{
+	res := &v1.ReadResponse{
 		Api:  apiVersion,
 		Book: &row,
-	}, nil
-
+	}
+	s.cacheSet(ctx, key, res, modified, gen)
+	setValidators(ctx, res, modified)
+	return res, nil
 }
 
 // Update request/response from proto definition
@@ -157,8 +242,10 @@ func (s *bookServiceServer) Update(ctx context.Context, req *v1.UpdateRequest) (
 		return nil, status.Error(codes.InvalidArgument, "publishDate field has invalid format: "+err.Error())
 	}
 
-	res, err := c.ExecContext(ctx, "UPDATE Book SET Title=$1, Author=$2, Publisher=$3, PublishDate=$4, Rating=$5, Status=$6 WHERE Id=$7",
-		req.Book.Title, req.Book.Author, req.Book.Publisher, publishDate, req.Book.Rating, req.Book.Status, req.Book.Id)
+	qctx, done := traceSQL(ctx, "book.update")
+	res, err := c.ExecContext(qctx, updateSQL,
+		req.Book.Title, req.Book.Author, req.Book.Publisher, publishDate, req.Book.Rating, req.Book.Status, req.Book.Isbn, req.Book.Id, actor(ctx))
+	done(err)
 	if err != nil {
 		return nil, status.Error(codes.Unknown, "failed to update: "+err.Error())
 	}
@@ -172,6 +259,7 @@ func (s *bookServiceServer) Update(ctx context.Context, req *v1.UpdateRequest) (
 		return nil, status.Error(codes.NotFound, fmt.Sprintf("Id='%d' not found",
 			req.Book.Id))
 	}
+	s.invalidate(ctx, req.Book.Id)
 
 	return &v1.UpdateResponse{
 		Api:     apiVersion,
@@ -190,7 +278,9 @@ func (s *bookServiceServer) Delete(ctx context.Context, req *v1.DeleteRequest) (
 	}
 	defer c.Close()
 
-	res, err := c.ExecContext(ctx, "DELETE FROM Book WHERE Id=$1", req.Id)
+	qctx, done := traceSQL(ctx, "book.delete")
+	res, err := c.ExecContext(qctx, deleteSQL, req.Id)
+	done(err)
 	if err != nil {
 		return nil, status.Error(codes.Unknown, "failed to delete: "+err.Error())
 	}
@@ -204,6 +294,7 @@ func (s *bookServiceServer) Delete(ctx context.Context, req *v1.DeleteRequest) (
 		return nil, status.Error(codes.NotFound, fmt.Sprintf("Id='%d' is not found",
 			req.Id))
 	}
+	s.invalidate(ctx, req.Id)
 
 	return &v1.DeleteResponse{
 		Api:     apiVersion,
@@ -216,25 +307,145 @@ func (s *bookServiceServer) ReadAll(ctx context.Context, req *v1.ReadAllRequest)
 	if err := s.checkAPI(req.Api); err != nil {
 		return nil, err
 	}
+
+	if req.PageSize < 0 {
+		return nil, status.Error(codes.InvalidArgument, "page_size must not be negative")
+	}
+	after, seq, err := decodePageToken(req.PageToken)
+	if err != nil {
+		return nil, err
+	}
+	if req.PageSize == 0 && after != 0 {
+		return nil, status.Error(codes.InvalidArgument, "page_token requires a page_size")
+	}
+	var since time.Time
+	if req.UpdatedSince != nil {
+		if since, err = ptypes.Timestamp(req.UpdatedSince); err != nil {
+			return nil, status.Error(codes.InvalidArgument, "updated_since field has invalid format: "+err.Error())
+		}
+	}
+	if req.ChangedSince < 0 {
+		return nil, status.Error(codes.InvalidArgument, "changed_since must not be negative")
+	}
+	if req.ChangedSince > 0 {
+		// books changed in pruned changes would be missed
+		oldest, err := s.oldestChange(ctx)
+		if err != nil {
+			return nil, status.Error(codes.Unknown, "failed to read change log position: "+err.Error())
+		}
+		if req.ChangedSince < oldest-1 {
+			return nil, status.Error(codes.OutOfRange, fmt.Sprintf("changes after sequence %d were pruned, read all books again", req.ChangedSince))
+		}
+	}
+
+	key := listKeyPrefix + strconv.Itoa(int(req.PageSize)) + ":" + req.PageToken + ":" + strconv.FormatInt(since.UnixNano(), 10) + ":" + strconv.FormatInt(req.ChangedSince, 10)
+	cached := new(v1.ReadAllResponse)
+	if modified, ok := s.cacheGet(ctx, key, cached); ok {
+		setValidators(ctx, cached, modified)
+		return cached, nil
+	}
+	gen := s.cacheGeneration()
+
+	// read ahead of the books, a change in between leaves the sequence and the time older than the
+	// data, never newer
+	latest, modified, err := s.lastChange(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if seq == 0 {
+		// the first page, the next ones keep its sequence: a book of an earlier page changed
+		// while reading a later one has a later sequence
+		seq = latest
+	}
+
+	res := &v1.ReadAllResponse{Api: apiVersion, Sequence: seq}
+	if req.PageSize == 0 {
+		if res.Books, err = s.listBooks(ctx, 0, 0, since, req.ChangedSince); err != nil {
+			return nil, err
+		}
+	} else {
+		size := int(req.PageSize)
+		if size > maxPageSize {
+			size = maxPageSize
+		}
+		// one more row than the page tells whether another page follows
+		list, err := s.listBooks(ctx, after, size+1, since, req.ChangedSince)
+		if err != nil {
+			return nil, err
+		}
+		res.Books = list
+		if len(list) > size {
+			res.Books = list[:size]
+			res.NextPageToken = encodePageToken(list[size-1].Id, seq)
+		}
+	}
+
+	s.cacheSet(ctx, key, res, modified, gen)
+	setValidators(ctx, res, modified)
+	return res, nil
+}
+
+// encodePageToken makes the opaque page token of the page after the book with id last, of a list
+// at change log sequence seq
+func encodePageToken(last, seq int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(last, 10) + ":" + strconv.FormatInt(seq, 10)))
+}
+
+// decodePageToken returns the id of the last book of the previous page and the sequence of the
+// list, zeros for the first page. Tokens without a sequence leave it zero.
+func decodePageToken(token string) (last, seq int64, err error) {
+	if token == "" {
+		return 0, 0, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err == nil {
+		id, sq, hasSeq := strings.Cut(string(b), ":")
+		if last, err = strconv.ParseInt(id, 10, 64); err == nil && hasSeq {
+			seq, err = strconv.ParseInt(sq, 10, 64)
+		}
+		if err == nil && last > 0 && seq >= 0 {
+			return last, seq, nil
+		}
+	}
+	return 0, 0, status.Error(codes.InvalidArgument, "invalid page_token")
+}
+
+// listBooks reads books by id, those after the id after, updated since since and, when changedSince
+// is set, changed after that change log sequence, at most limit of them when limit is set
+func (s *bookServiceServer) listBooks(ctx context.Context, after int64, limit int, since time.Time, changedSince int64) ([]*v1.Book, error) {
 	c, err := s.connect(ctx)
 	if err != nil {
 		return nil, err
 	}
 	defer c.Close()
 
-	rows, err := c.QueryContext(ctx, "SELECT Id, Title, Author, Publisher, PublishDate, Rating, Status FROM Book")
+	query, args := listSQL, []interface{}{after, since}
+	if changedSince > 0 {
+		args = append(args, changedSince)
+		query += " AND Id IN (SELECT BookId FROM BookChange WHERE Seq > $" + strconv.Itoa(len(args)) + ")"
+	}
+	query += " ORDER BY Id"
+	if limit > 0 {
+		args = append(args, limit)
+		query += " LIMIT $" + strconv.Itoa(len(args))
+	}
+	qctx, done := traceSQL(ctx, "book.list")
+	rows, err := c.QueryContext(qctx, query, args...)
 	if err != nil {
+		done(err)
 		return nil, status.Error(codes.Unknown, "failed to SELECT: "+err.Error())
 	}
-	defer rows.Close()
+	defer endRows(rows, done)
 
-	var publishDate time.Time
+	var publishDate, created, updated time.Time
 	list := []*v1.Book{}
 	for rows.Next() {
 		row := new(v1.Book)
-		if err := rows.Scan(&row.Id, &row.Title, &row.Author, &row.Publisher, &publishDate, &row.Rating, &row.Status); err != nil {
+		if err := rows.Scan(&row.Id, &row.Title, &row.Author, &row.Publisher, &publishDate, &row.Rating, &row.Status, &row.Isbn,
+			&created, &updated, &row.CreatedBy, &row.UpdatedBy); err != nil {
 			return nil, status.Error(codes.Unknown, "couldn't retrieve field values: "+err.Error())
 		}
+		setAuditTimes(row, created, updated)
 		row.PublishDate, err = ptypes.TimestampProto(publishDate)
 		if err != nil {
 			return nil, status.Error(codes.InvalidArgument, "publishDate field has invalid format: "+err.Error())
@@ -246,8 +457,28 @@ func (s *bookServiceServer) ReadAll(ctx context.Context, req *v1.ReadAllRequest)
 		return nil, status.Error(codes.Unknown, "couldn't retrieve: "+err.Error())
 	}
 
-	return &v1.ReadAllResponse{
-		Api:   apiVersion,
-		Books: list,
-	}, nil
+	return list, nil
+}
+
+// actor is the subject of the caller, recorded as CreatedBy and UpdatedBy of the books it changes
+func actor(ctx context.Context) string {
+	c, ok := auth.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	// varchar counts characters, cut before the first one too many rather than within it
+	n := 0
+	for i := range c.Subject {
+		if n == maxFieldLength {
+			return c.Subject[:i]
+		}
+		n++
+	}
+	return c.Subject
+}
+
+// setAuditTimes sets the server managed times of b, database times are always valid timestamps
+func setAuditTimes(b *v1.Book, created, updated time.Time) {
+	b.CreatedAt, _ = ptypes.TimestampProto(created)
+	b.UpdatedAt, _ = ptypes.TimestampProto(updated)
 }
@@ -3,16 +3,22 @@ package v1
 import (
 	"context"
 	"database/sql"
+	"encoding/base64"
 	"fmt"
 	"reflect"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/golang-jwt/jwt/v4"
 	"github.com/golang/protobuf/ptypes"
 	_ "github.com/lib/pq"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"github.com/radean0909/redeam-rest/pkg/api/v1"
+	"github.com/radean0909/redeam-rest/pkg/auth"
 )
 
 func connectToDB() (*sql.DB, error) {
@@ -32,6 +38,17 @@ func clearTable(db *sql.DB) {
 	db.Exec("ALTER SEQUENCE book_id_seq RESTART WITH 1")
 }
 
+// clearAuditTimes checks the server set the times of books and clears them for comparison
+func clearAuditTimes(t *testing.T, books ...*v1.Book) {
+	t.Helper()
+	for _, b := range books {
+		if b.CreatedAt == nil || b.UpdatedAt == nil {
+			t.Errorf("book %d has created_at %v and updated_at %v, want both set", b.Id, b.CreatedAt, b.UpdatedAt)
+		}
+		b.CreatedAt, b.UpdatedAt = nil, nil
+	}
+}
+
 func addEntries(num int) {
 	ctx := context.Background()
 	// Get the DB
@@ -241,6 +258,9 @@ func Test_bookServiceServer_Read(t *testing.T) {
 				t.Errorf("bookServiceServer.Read() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
+			if got != nil {
+				clearAuditTimes(t, got.Book)
+			}
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("bookServiceServer.Read() = %v, want %v", got, tt.want)
 				return
@@ -460,6 +480,10 @@ func Test_bookServiceServer_ReadAll(t *testing.T) {
 
 	// Add some entries
 	addEntries(4)
+	var seq int64
+	if err := db.QueryRow("SELECT MAX(Seq) FROM BookChange").Scan(&seq); err != nil {
+		t.Fatal(err)
+	}
 
 	// run tests
 	type args struct {
@@ -487,7 +511,8 @@ func Test_bookServiceServer_ReadAll(t *testing.T) {
 				},
 			},
 			want: &v1.ReadAllResponse{
-				Api: "v1",
+				Api:      "v1",
+				Sequence: seq,
 				Books: []*v1.Book{
 					{
 						Id:          1,
@@ -529,6 +554,122 @@ func Test_bookServiceServer_ReadAll(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "First page",
+			s:    s,
+			args: args{
+				ctx: ctx,
+				req: &v1.ReadAllRequest{
+					Api:      "v1",
+					PageSize: 3,
+				},
+			},
+			want: &v1.ReadAllResponse{
+				Api:      "v1",
+				Sequence: seq,
+				Books: []*v1.Book{
+					{
+						Id:          1,
+						Title:       "title1",
+						Author:      "author1",
+						Publisher:   "publisher",
+						PublishDate: publishDate,
+						Rating:      1.0,
+						Status:      2,
+					},
+					{
+						Id:          2,
+						Title:       "title2",
+						Author:      "author2",
+						Publisher:   "publisher",
+						PublishDate: publishDate,
+						Rating:      1.0,
+						Status:      2,
+					},
+					{
+						Id:          3,
+						Title:       "title3",
+						Author:      "author3",
+						Publisher:   "publisher",
+						PublishDate: publishDate,
+						Rating:      1.0,
+						Status:      2,
+					},
+				},
+				NextPageToken: encodePageToken(3, seq),
+			},
+			wantErr: false,
+		},
+		{
+			name: "Last page",
+			s:    s,
+			args: args{
+				ctx: ctx,
+				req: &v1.ReadAllRequest{
+					Api:       "v1",
+					PageSize:  3,
+					PageToken: encodePageToken(3, seq),
+				},
+			},
+			want: &v1.ReadAllResponse{
+				Api:      "v1",
+				Sequence: seq,
+				Books: []*v1.Book{
+					{
+						Id:          4,
+						Title:       "title4",
+						Author:      "author4",
+						Publisher:   "publisher",
+						PublishDate: publishDate,
+						Rating:      1.0,
+						Status:      2,
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Updated since",
+			s:    s,
+			args: args{
+				ctx: ctx,
+				req: &v1.ReadAllRequest{
+					Api:          "v1",
+					UpdatedSince: ptypes.TimestampNow(),
+				},
+			},
+			want: &v1.ReadAllResponse{
+				Api:      "v1",
+				Books:    []*v1.Book{},
+				Sequence: seq,
+			},
+			wantErr: false,
+		},
+		{
+			name: "Negative page size",
+			s:    s,
+			args: args{
+				ctx: ctx,
+				req: &v1.ReadAllRequest{
+					Api:      "v1",
+					PageSize: -1,
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Invalid page token",
+			s:    s,
+			args: args{
+				ctx: ctx,
+				req: &v1.ReadAllRequest{
+					Api:       "v1",
+					PageSize:  3,
+					PageToken: "not a token",
+				},
+			},
+			wantErr: true,
+		},
 		{
 			name: "Invalid API Version",
 			s:    s,
@@ -549,6 +690,9 @@ func Test_bookServiceServer_ReadAll(t *testing.T) {
 				t.Errorf("bookServiceServer.Read() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
+			if got != nil {
+				clearAuditTimes(t, got.Books...)
+			}
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("bookServiceServer.Read() = %v, want %v", got, tt.want)
 				return
@@ -558,3 +702,232 @@ func Test_bookServiceServer_ReadAll(t *testing.T) {
 
 	defer db.Close()
 }
+
+func Test_bookServiceServer_Audit(t *testing.T) {
+	db, err := connectToDB()
+	if err != nil {
+		t.Fatalf("Couldn't connect to DB.")
+	}
+	defer db.Close()
+	clearTable(db)
+	s := NewBookServiceServer(db)
+
+	as := func(subject string) context.Context {
+		return auth.NewContext(context.Background(), &auth.Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: subject}})
+	}
+	book := &v1.Book{Title: "title", PublishDate: ptypes.TimestampNow(), CreatedBy: "ignored", CreatedAt: ptypes.TimestampNow()}
+
+	created, err := s.Create(as("alice"), &v1.CreateRequest{Api: "v1", Book: book})
+	if err != nil {
+		t.Fatalf("bookServiceServer.Create() error = %v", err)
+	}
+	first, err := s.Read(context.Background(), &v1.ReadRequest{Api: "v1", Id: created.Id})
+	if err != nil {
+		t.Fatalf("bookServiceServer.Read() error = %v", err)
+	}
+	if first.Book.CreatedBy != "alice" || first.Book.UpdatedBy != "alice" {
+		t.Errorf("created_by = %q, updated_by = %q, want alice", first.Book.CreatedBy, first.Book.UpdatedBy)
+	}
+
+	book.Id, book.Title = created.Id, "title (UPDATED)"
+	if _, err := s.Update(as("bob"), &v1.UpdateRequest{Api: "v1", Book: book}); err != nil {
+		t.Fatalf("bookServiceServer.Update() error = %v", err)
+	}
+	second, err := s.Read(context.Background(), &v1.ReadRequest{Api: "v1", Id: created.Id})
+	if err != nil {
+		t.Fatalf("bookServiceServer.Read() error = %v", err)
+	}
+	if second.Book.CreatedBy != "alice" || second.Book.UpdatedBy != "bob" {
+		t.Errorf("created_by = %q, updated_by = %q, want alice and bob", second.Book.CreatedBy, second.Book.UpdatedBy)
+	}
+	if !reflect.DeepEqual(second.Book.CreatedAt, first.Book.CreatedAt) {
+		t.Errorf("created_at = %v after the update, want %v", second.Book.CreatedAt, first.Book.CreatedAt)
+	}
+
+	// the update is the only change since the first read
+	res, err := s.ReadAll(context.Background(), &v1.ReadAllRequest{Api: "v1", UpdatedSince: second.Book.UpdatedAt})
+	if err != nil {
+		t.Fatalf("bookServiceServer.ReadAll() error = %v", err)
+	}
+	if len(res.Books) != 1 || res.Books[0].Id != created.Id {
+		t.Errorf("bookServiceServer.ReadAll() = %v, want the updated book", res.Books)
+	}
+}
+
+func Test_bookServiceServer_ReadAll_ChangedSince(t *testing.T) {
+	ctx := context.Background()
+	db, err := connectToDB()
+	if err != nil {
+		t.Fatalf("Couldn't connect to DB.")
+	}
+	defer db.Close()
+	if err := db.Ping(); err != nil {
+		t.Fatalf("Couldn't connect to DB: %v", err)
+	}
+	addEntries(3)
+	s := NewBookServiceServer(db)
+
+	first, err := s.ReadAll(ctx, &v1.ReadAllRequest{Api: "v1", PageSize: 2})
+	if err != nil {
+		t.Fatalf("bookServiceServer.ReadAll() error = %v", err)
+	}
+	book := first.Books[1]
+	book.Title = "title2 (UPDATED)"
+	if _, err := s.Update(ctx, &v1.UpdateRequest{Api: "v1", Book: book}); err != nil {
+		t.Fatalf("bookServiceServer.Update() error = %v", err)
+	}
+
+	// later pages keep the sequence of the first, the update comes again in the next sync
+	rest, err := s.ReadAll(ctx, &v1.ReadAllRequest{Api: "v1", PageSize: 2, PageToken: first.NextPageToken})
+	if err != nil {
+		t.Fatalf("bookServiceServer.ReadAll() error = %v", err)
+	}
+	if rest.Sequence != first.Sequence {
+		t.Errorf("bookServiceServer.ReadAll() sequence = %d on the next page, want %d", rest.Sequence, first.Sequence)
+	}
+
+	delta, err := s.ReadAll(ctx, &v1.ReadAllRequest{Api: "v1", ChangedSince: first.Sequence})
+	if err != nil {
+		t.Fatalf("bookServiceServer.ReadAll() error = %v", err)
+	}
+	if len(delta.Books) != 1 || delta.Books[0].Title != book.Title {
+		t.Errorf("bookServiceServer.ReadAll() = %v, want only the updated book", delta.Books)
+	}
+	if delta.Sequence <= first.Sequence {
+		t.Errorf("bookServiceServer.ReadAll() sequence = %d, want after %d", delta.Sequence, first.Sequence)
+	}
+
+	if _, err := s.ReadAll(ctx, &v1.ReadAllRequest{Api: "v1", ChangedSince: -1}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("bookServiceServer.ReadAll() error = %v, want InvalidArgument for a negative changed_since", err)
+	}
+	if _, err := pruneChanges(ctx, db, time.Nanosecond); err != nil {
+		t.Fatalf("pruneChanges() error = %v", err)
+	}
+	if _, err := s.ReadAll(ctx, &v1.ReadAllRequest{Api: "v1", ChangedSince: first.Sequence - 1}); status.Code(err) != codes.OutOfRange {
+		t.Errorf("bookServiceServer.ReadAll() error = %v, want OutOfRange after the changes were pruned", err)
+	}
+}
+
+func Test_actor(t *testing.T) {
+	long := strings.Repeat("a", maxFieldLength-1) + "éé"
+	tests := []struct {
+		name    string
+		subject string
+		want    string
+	}{
+		{"short", "alice", "alice"},
+		{"at the limit", strings.Repeat("é", maxFieldLength), strings.Repeat("é", maxFieldLength)},
+		{"over the limit", long, long[:len(long)-len("é")]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := auth.NewContext(context.Background(), &auth.Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: tt.subject}})
+			if got := actor(ctx); got != tt.want {
+				t.Errorf("actor() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+	if got := actor(context.Background()); got != "" {
+		t.Errorf("actor() = %q without claims, want none", got)
+	}
+}
+
+func Test_pageToken(t *testing.T) {
+	token := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+	tests := []struct {
+		name     string
+		token    string
+		wantLast int64
+		wantSeq  int64
+		wantErr  bool
+	}{
+		{"first page", "", 0, 0, false},
+		{"encoded", encodePageToken(3, 42), 3, 42, false},
+		{"without sequence", token("3"), 3, 0, false},
+		{"not base64", "not a token", 0, 0, true},
+		{"no id", token("0:42"), 0, 0, true},
+		{"negative id", token("-3:42"), 0, 0, true},
+		{"negative sequence", token("3:-1"), 0, 0, true},
+		{"not a sequence", token("3:x"), 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			last, seq, err := decodePageToken(tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodePageToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if status.Code(err) != codes.OK && status.Code(err) != codes.InvalidArgument {
+				t.Errorf("decodePageToken() error = %v, want InvalidArgument", err)
+			}
+			if last != tt.wantLast || seq != tt.wantSeq {
+				t.Errorf("decodePageToken() = %d, %d, want %d, %d", last, seq, tt.wantLast, tt.wantSeq)
+			}
+		})
+	}
+}
+
+func Test_bookServiceServer_ReadAll_InvalidPage(t *testing.T) {
+	// rejected before the database is read
+	s := NewBookServiceServer(nil)
+	tests := []struct {
+		name string
+		req  *v1.ReadAllRequest
+	}{
+		{"negative page size", &v1.ReadAllRequest{Api: "v1", PageSize: -1}},
+		{"invalid page token", &v1.ReadAllRequest{Api: "v1", PageSize: 3, PageToken: "not a token"}},
+		{"page token without page size", &v1.ReadAllRequest{Api: "v1", PageToken: encodePageToken(3, 42)}},
+		{"negative changed_since", &v1.ReadAllRequest{Api: "v1", ChangedSince: -1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := s.ReadAll(context.Background(), tt.req); status.Code(err) != codes.InvalidArgument {
+				t.Errorf("bookServiceServer.ReadAll() error = %v, want InvalidArgument", err)
+			}
+		})
+	}
+}
+
+func Test_bookServiceServer_ReadAll_Pages(t *testing.T) {
+	ctx := context.Background()
+	db, err := connectToDB()
+	if err != nil {
+		t.Fatalf("Couldn't connect to DB.")
+	}
+	defer db.Close()
+	if err := db.Ping(); err != nil {
+		t.Fatalf("Couldn't connect to DB: %v", err)
+	}
+	addEntries(5)
+	s := NewBookServiceServer(db)
+
+	// pages follow each other by id, a book deleted between pages doesn't shift the next one
+	var ids []int64
+	req := &v1.ReadAllRequest{Api: "v1", PageSize: 2}
+	for pages := 1; ; pages++ {
+		res, err := s.ReadAll(ctx, req)
+		if err != nil {
+			t.Fatalf("bookServiceServer.ReadAll() error = %v", err)
+		}
+		if len(res.Books) > 2 {
+			t.Errorf("bookServiceServer.ReadAll() page %d has %d books, want at most 2", pages, len(res.Books))
+		}
+		for _, b := range res.Books {
+			ids = append(ids, b.Id)
+		}
+		if pages == 1 {
+			if _, err := s.Delete(ctx, &v1.DeleteRequest{Api: "v1", Id: 2}); err != nil {
+				t.Fatalf("bookServiceServer.Delete() error = %v", err)
+			}
+		}
+		if res.NextPageToken == "" {
+			break
+		}
+		if pages == 3 {
+			t.Fatalf("bookServiceServer.ReadAll() = more than 3 pages of 5 books")
+		}
+		req.PageToken = res.NextPageToken
+	}
+	if want := []int64{1, 2, 3, 4, 5}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("bookServiceServer.ReadAll() pages = %v, want %v", ids, want)
+	}
+}
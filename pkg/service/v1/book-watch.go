@@ -0,0 +1,237 @@
+package v1
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/lib/pq"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/radean0909/redeam-rest/pkg/api/v1"
+)
+
+const (
+	// BookChangesChannel is the Postgres NOTIFY channel the BookChange trigger publishes on
+	BookChangesChannel = "book_changes"
+
+	// fallback for watchers when no notifier is configured or a notification is lost
+	watchPollInterval = 5 * time.Second
+
+	// pruneInterval is how often PruneChanges deletes old changes
+	pruneInterval = time.Hour
+
+	// pruneChangesSQL keeps the latest change, it dates the catalog for conditional reads
+	pruneChangesSQL = "DELETE FROM BookChange WHERE ChangedAt < now() - make_interval(secs => $1) AND Seq < (SELECT MAX(Seq) FROM BookChange)"
+)
+
+// ChangeNotifier wakes watchers whenever new rows are appended to BookChange
+type ChangeNotifier interface {
+	Subscribe() (<-chan struct{}, func())
+}
+
+// Notifier fans out change notifications to every subscribed watcher
+type Notifier struct {
+	mu   sync.Mutex
+	subs map[chan struct{}]struct{}
+}
+
+func NewNotifier() *Notifier {
+	return &Notifier{subs: make(map[chan struct{}]struct{})}
+}
+
+// Subscribe returns a channel that receives a value after each change and a func to unsubscribe
+func (n *Notifier) Subscribe() (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+
+	n.mu.Lock()
+	n.subs[ch] = struct{}{}
+	n.mu.Unlock()
+
+	return ch, func() {
+		n.mu.Lock()
+		delete(n.subs, ch)
+		n.mu.Unlock()
+	}
+}
+
+// Broadcast wakes all subscribers, watchers that are busy already have a wakeup pending
+func (n *Notifier) Broadcast() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for ch := range n.subs {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Listen relays NOTIFY events from l to the subscribers until ctx is done
+func (n *Notifier) Listen(ctx context.Context, l *pq.Listener) error {
+	if err := l.Listen(BookChangesChannel); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return l.Close()
+		case <-l.Notify:
+			// a nil notification means the connection was re-established and events may have been missed,
+			// watchers re-read the change log either way
+			n.Broadcast()
+		case <-time.After(90 * time.Second):
+			go l.Ping()
+		}
+	}
+}
+
+// WatchBooks request/response from proto definition
+func (s *bookServiceServer) WatchBooks(req *v1.WatchBooksRequest, stream v1.BookService_WatchBooksServer) error {
+	if err := s.checkAPI(req.Api); err != nil {
+		return err
+	}
+	ctx := stream.Context()
+
+	// Subscribe before reading the log so no change slips between catch-up and live updates
+	var wake <-chan struct{}
+	if s.notifier != nil {
+		ch, cancel := s.notifier.Subscribe()
+		defer cancel()
+		wake = ch
+	}
+
+	last := req.SinceSequence
+	if last <= 0 {
+		qctx, done := traceSQL(ctx, "book_change.last_seq")
+		err := s.db.QueryRowContext(qctx, "SELECT COALESCE(MAX(Seq), 0) FROM BookChange").Scan(&last)
+		done(err)
+		if err != nil {
+			return status.Error(codes.Unknown, "failed to read change log position: "+err.Error())
+		}
+	} else {
+		// resuming behind the oldest change kept would skip the pruned ones
+		oldest, err := s.oldestChange(ctx)
+		if err != nil {
+			return status.Error(codes.Unknown, "failed to read change log position: "+err.Error())
+		}
+		if last < oldest-1 {
+			return status.Error(codes.OutOfRange, fmt.Sprintf("changes after sequence %d were pruned, read the books again and watch from the latest change", last))
+		}
+	}
+
+	s.log(ctx).Debug("watching book changes", "since_sequence", last)
+	for {
+		var err error
+		if last, err = s.sendChanges(ctx, stream, last); err != nil {
+			s.log(ctx).Debug("stopped watching book changes", "sequence", last)
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			s.log(ctx).Debug("stopped watching book changes", "sequence", last)
+			return status.Error(codes.Canceled, ctx.Err().Error())
+		case <-s.stopping:
+			s.log(ctx).Debug("stopped watching book changes for shutdown", "sequence", last)
+			return status.Error(codes.Unavailable, fmt.Sprintf("server is shutting down, resume with since_sequence %d", last))
+		case <-wake:
+		case <-time.After(watchPollInterval):
+		}
+	}
+}
+
+// oldestChange returns the sequence of the oldest change kept, zero while the log is empty
+func (s *bookServiceServer) oldestChange(ctx context.Context) (_ int64, err error) {
+	ctx, done := traceSQL(ctx, "book_change.first_seq")
+	defer func() { done(err) }()
+
+	var oldest int64
+	err = s.db.QueryRowContext(ctx, "SELECT COALESCE(MIN(Seq), 0) FROM BookChange").Scan(&oldest)
+	return oldest, err
+}
+
+// sendChanges streams every change after seq and returns the last sequence sent
+func (s *bookServiceServer) sendChanges(ctx context.Context, stream v1.BookService_WatchBooksServer, seq int64) (int64, error) {
+	c, err := s.connect(ctx)
+	if err != nil {
+		return seq, err
+	}
+	defer c.Close()
+
+	qctx, done := traceSQL(ctx, "book_change.list")
+	rows, err := c.QueryContext(qctx, "SELECT Seq, ChangeType, BookId, Title, Author, Publisher, PublishDate, Rating, Status, Isbn, CreatedAt, UpdatedAt, CreatedBy, UpdatedBy FROM BookChange WHERE Seq>$1 ORDER BY Seq",
+		seq)
+	if err != nil {
+		done(err)
+		return seq, status.Error(codes.Unknown, "failed to SELECT: "+err.Error())
+	}
+	defer endRows(rows, done)
+
+	var publishDate, created, updated time.Time
+	for rows.Next() {
+		res := &v1.WatchBooksResponse{
+			Api:  apiVersion,
+			Book: new(v1.Book),
+		}
+		if err := rows.Scan(&res.Sequence, &res.Type, &res.Book.Id, &res.Book.Title, &res.Book.Author, &res.Book.Publisher, &publishDate, &res.Book.Rating, &res.Book.Status, &res.Book.Isbn,
+			&created, &updated, &res.Book.CreatedBy, &res.Book.UpdatedBy); err != nil {
+			return seq, status.Error(codes.Unknown, "couldn't retrieve field values: "+err.Error())
+		}
+		setAuditTimes(res.Book, created, updated)
+		res.Book.PublishDate, err = ptypes.TimestampProto(publishDate)
+		if err != nil {
+			return seq, status.Error(codes.InvalidArgument, "publishDate field has invalid format: "+err.Error())
+		}
+		if err := stream.Send(res); err != nil {
+			return seq, err
+		}
+		seq = res.Sequence
+	}
+
+	if err := rows.Err(); err != nil {
+		return seq, status.Error(codes.Unknown, "couldn't retrieve: "+err.Error())
+	}
+
+	return seq, nil
+}
+
+// PruneChanges deletes changes older than retention every pruneInterval until ctx is done.
+// Watchers resuming from a pruned position fail with OutOfRange.
+func PruneChanges(ctx context.Context, db *sql.DB, retention time.Duration) {
+	t := time.NewTicker(pruneInterval)
+	defer t.Stop()
+
+	for {
+		if n, err := pruneChanges(ctx, db, retention); err != nil {
+			slog.Warn("failed to prune book changes", "error", err)
+		} else {
+			slog.Debug("pruned book changes", "deleted", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// pruneChanges deletes the changes older than retention but the latest and returns how many
+func pruneChanges(ctx context.Context, db *sql.DB, retention time.Duration) (_ int64, err error) {
+	ctx, done := traceSQL(ctx, "book_change.prune")
+	defer func() { done(err) }()
+
+	res, err := db.ExecContext(ctx, pruneChangesSQL, retention.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
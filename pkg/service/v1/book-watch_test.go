@@ -0,0 +1,241 @@
+package v1
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/radean0909/redeam-rest/pkg/api/v1"
+)
+
+// watchStream hands the changes sent by WatchBooks to the test
+type watchStream struct {
+	grpc.ServerStream
+	ctx     context.Context
+	changes chan *v1.WatchBooksResponse
+}
+
+func (s *watchStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *watchStream) Send(res *v1.WatchBooksResponse) error {
+	s.changes <- res
+	return nil
+}
+
+func TestNotifier_Broadcast(t *testing.T) {
+	n := NewNotifier()
+
+	a, cancelA := n.Subscribe()
+	b, cancelB := n.Subscribe()
+	defer cancelA()
+
+	// Multiple changes while a watcher is busy collapse into a single wakeup
+	n.Broadcast()
+	n.Broadcast()
+
+	for name, ch := range map[string]<-chan struct{}{"a": a, "b": b} {
+		select {
+		case <-ch:
+		case <-time.After(time.Second):
+			t.Errorf("subscriber %s was not woken", name)
+		}
+		select {
+		case <-ch:
+			t.Errorf("subscriber %s was woken twice", name)
+		default:
+		}
+	}
+
+	cancelB()
+	n.Broadcast()
+
+	select {
+	case <-b:
+		t.Errorf("unsubscribed subscriber was woken")
+	default:
+	}
+	select {
+	case <-a:
+	case <-time.After(time.Second):
+		t.Errorf("subscriber a was not woken after b unsubscribed")
+	}
+}
+
+func Test_bookServiceServer_WatchBooks(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	db, err := connectToDB()
+	if err != nil {
+		t.Fatalf("Couldn't connect to DB.")
+	}
+	defer db.Close()
+	if err := db.Ping(); err != nil {
+		t.Fatalf("Couldn't connect to DB: %v", err)
+	}
+	clearTable(db)
+	n := NewNotifier()
+	s := NewBookServiceServer(db, WithNotifier(n))
+
+	book := &v1.Book{Title: "title", PublishDate: ptypes.TimestampNow()}
+	first, err := s.Create(ctx, &v1.CreateRequest{Api: "v1", Book: book})
+	if err != nil {
+		t.Fatalf("bookServiceServer.Create() error = %v", err)
+	}
+	var since int64
+	if err := db.QueryRow("SELECT MAX(Seq) FROM BookChange").Scan(&since); err != nil {
+		t.Fatal(err)
+	}
+
+	// changes made while the watcher was away are replayed, a batch as one change per book
+	if _, err := s.BatchCreate(ctx, &v1.BatchCreateRequest{Api: "v1", Books: []*v1.Book{book, book}}); err != nil {
+		t.Fatalf("bookServiceServer.BatchCreate() error = %v", err)
+	}
+	updated := &v1.Book{Id: first.Id, Title: "title (UPDATED)", PublishDate: book.PublishDate}
+	if _, err := s.Update(ctx, &v1.UpdateRequest{Api: "v1", Book: updated}); err != nil {
+		t.Fatalf("bookServiceServer.Update() error = %v", err)
+	}
+	if _, err := s.Delete(ctx, &v1.DeleteRequest{Api: "v1", Id: first.Id}); err != nil {
+		t.Fatalf("bookServiceServer.Delete() error = %v", err)
+	}
+
+	stream := &watchStream{ctx: ctx, changes: make(chan *v1.WatchBooksResponse, 10)}
+	errc := make(chan error, 1)
+	go func() {
+		errc <- s.WatchBooks(&v1.WatchBooksRequest{Api: "v1", SinceSequence: since}, stream)
+	}()
+
+	next := func(want v1.WatchBooksResponse_ChangeType, timeout time.Duration) *v1.WatchBooksResponse {
+		t.Helper()
+		select {
+		case c := <-stream.changes:
+			if c.Type != want || c.Sequence <= since {
+				t.Errorf("change %d is %v, want %v after sequence %d", c.Sequence, c.Type, want, since)
+			}
+			since = c.Sequence
+			return c
+		case <-time.After(timeout):
+			t.Fatalf("no %v change within %v", want, timeout)
+			return nil
+		}
+	}
+	next(v1.WatchBooksResponse_CREATED, 5*time.Second)
+	next(v1.WatchBooksResponse_CREATED, time.Second)
+	if c := next(v1.WatchBooksResponse_UPDATED, time.Second); c.Book.Title != updated.Title {
+		t.Errorf("updated book = %v, want %v", c.Book, updated)
+	}
+	if c := next(v1.WatchBooksResponse_DELETED, time.Second); c.Book.Id != first.Id {
+		t.Errorf("deleted book = %v, want %d", c.Book, first.Id)
+	}
+
+	// a notification wakes the watcher well before it would poll
+	if _, err := s.Create(ctx, &v1.CreateRequest{Api: "v1", Book: book}); err != nil {
+		t.Fatalf("bookServiceServer.Create() error = %v", err)
+	}
+	n.Broadcast()
+	next(v1.WatchBooksResponse_CREATED, watchPollInterval/2)
+
+	cancel()
+	if err := <-errc; status.Code(err) != codes.Canceled {
+		t.Errorf("bookServiceServer.WatchBooks() error = %v, want Canceled", err)
+	}
+}
+
+func Test_bookServiceServer_WatchBooks_Pruned(t *testing.T) {
+	ctx := context.Background()
+	db, err := connectToDB()
+	if err != nil {
+		t.Fatalf("Couldn't connect to DB.")
+	}
+	defer db.Close()
+	if err := db.Ping(); err != nil {
+		t.Fatalf("Couldn't connect to DB: %v", err)
+	}
+	addEntries(3)
+	s := NewBookServiceServer(db)
+
+	if _, err := pruneChanges(ctx, db, time.Nanosecond); err != nil {
+		t.Fatalf("pruneChanges() error = %v", err)
+	}
+	var oldest, latest int64
+	if err := db.QueryRow("SELECT MIN(Seq), MAX(Seq) FROM BookChange").Scan(&oldest, &latest); err != nil {
+		t.Fatal(err)
+	}
+	if oldest != latest {
+		t.Errorf("pruneChanges() kept changes %d to %d, want only the latest", oldest, latest)
+	}
+
+	stream := &watchStream{ctx: ctx, changes: make(chan *v1.WatchBooksResponse, 10)}
+	err = s.WatchBooks(&v1.WatchBooksRequest{Api: "v1", SinceSequence: latest - 2}, stream)
+	if status.Code(err) != codes.OutOfRange {
+		t.Errorf("bookServiceServer.WatchBooks() error = %v, want OutOfRange", err)
+	}
+}
+
+func Test_bookServiceServer_WatchBooks_CommitOrder(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	db, err := connectToDB()
+	if err != nil {
+		t.Fatalf("Couldn't connect to DB.")
+	}
+	defer db.Close()
+	if err := db.Ping(); err != nil {
+		t.Fatalf("Couldn't connect to DB: %v", err)
+	}
+	clearTable(db)
+	s := NewBookServiceServer(db)
+
+	var since int64
+	if err := db.QueryRow("SELECT COALESCE(MAX(Seq), 0) FROM BookChange").Scan(&since); err != nil {
+		t.Fatal(err)
+	}
+	stream := &watchStream{ctx: ctx, changes: make(chan *v1.WatchBooksResponse, 10)}
+	go s.WatchBooks(&v1.WatchBooksRequest{Api: "v1", SinceSequence: since}, stream)
+
+	// a long transaction, like an import, logs its change first and commits last
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, "INSERT INTO Book (Title) VALUES ('slow')"); err != nil {
+		t.Fatal(err)
+	}
+	created := make(chan error, 1)
+	go func() {
+		_, err := s.Create(ctx, &v1.CreateRequest{Api: "v1", Book: &v1.Book{Title: "quick", PublishDate: ptypes.TimestampNow()}})
+		created <- err
+	}()
+	select {
+	case err := <-created:
+		t.Fatalf("Create() = %v while an earlier transaction was open, want it to wait for its commit", err)
+	case c := <-stream.changes:
+		t.Fatalf("watcher got change %d while an earlier transaction was open", c.Sequence)
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-created; err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	for _, want := range []string{"slow", "quick"} {
+		select {
+		case c := <-stream.changes:
+			if c.Book.Title != want || c.Sequence <= since {
+				t.Errorf("change %d of %q, want %q after sequence %d", c.Sequence, c.Book.Title, want, since)
+			}
+			since = c.Sequence
+		case <-time.After(2 * watchPollInterval):
+			t.Fatalf("no change of %q", want)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package v1
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/radean0909/redeam-rest/pkg/idempotency"
+)
+
+const (
+	// claimKeySQL inserts a key or takes over an expired one, it affects no row while the key is held
+	claimKeySQL = "INSERT INTO IdempotencyKey (Key, RequestHash, ExpiresAt) VALUES ($1, $2, now() + $3 * interval '1 second') " +
+		"ON CONFLICT (Key) DO UPDATE SET RequestHash=EXCLUDED.RequestHash, Response=NULL, ExpiresAt=EXCLUDED.ExpiresAt " +
+		"WHERE IdempotencyKey.ExpiresAt <= now()"
+	readKeySQL     = "SELECT RequestHash, Response FROM IdempotencyKey WHERE Key=$1"
+	completeKeySQL = "UPDATE IdempotencyKey SET Response=$2, ExpiresAt=now() + $3 * interval '1 second' WHERE Key=$1"
+	releaseKeySQL  = "DELETE FROM IdempotencyKey WHERE Key=$1 AND Response IS NULL"
+	purgeKeysSQL   = "DELETE FROM IdempotencyKey WHERE ExpiresAt <= now()"
+
+	// purgeInterval is how often expired keys are deleted
+	purgeInterval = 10 * time.Minute
+)
+
+type idempotencyStore struct {
+	db     *sql.DB
+	window time.Duration
+
+	mu        sync.Mutex
+	lastPurge time.Time
+}
+
+// NewIdempotencyStore keeps idempotent responses in the database for window, so every server
+// sharing it replays them
+func NewIdempotencyStore(db *sql.DB, window time.Duration) idempotency.Store {
+	return &idempotencyStore{db: db, window: window}
+}
+
+// Begin claims key, or returns the response or state of the call holding it
+func (s *idempotencyStore) Begin(ctx context.Context, key, hash string) (_ []byte, err error) {
+	s.purge(ctx)
+
+	ctx, done := traceSQL(ctx, "idempotency.begin")
+	defer func() { done(err) }()
+
+	res, err := s.db.ExecContext(ctx, claimKeySQL, key, hash, idempotency.PendingTTL.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 1 {
+		return nil, nil
+	}
+
+	var (
+		stored   string
+		response []byte
+	)
+	err = s.db.QueryRowContext(ctx, readKeySQL, key).Scan(&stored, &response)
+	switch {
+	case err == sql.ErrNoRows:
+		// released by a failed call in the meantime, the retry may claim it
+		return nil, idempotency.ErrInProgress
+	case err != nil:
+		return nil, err
+	case stored != hash:
+		return nil, idempotency.ErrMismatch
+	case response == nil:
+		return nil, idempotency.ErrInProgress
+	}
+	return response, nil
+}
+
+// Complete stores response for the window
+func (s *idempotencyStore) Complete(ctx context.Context, key string, response []byte) (err error) {
+	ctx, done := traceSQL(ctx, "idempotency.complete")
+	defer func() { done(err) }()
+
+	_, err = s.db.ExecContext(ctx, completeKeySQL, key, response, s.window.Seconds())
+	return err
+}
+
+// Release drops key unless its call completed
+func (s *idempotencyStore) Release(ctx context.Context, key string) (err error) {
+	ctx, done := traceSQL(ctx, "idempotency.release")
+	defer func() { done(err) }()
+
+	_, err = s.db.ExecContext(ctx, releaseKeySQL, key)
+	return err
+}
+
+// purge deletes expired keys every purgeInterval, failures are left to the next one
+func (s *idempotencyStore) purge(ctx context.Context) {
+	s.mu.Lock()
+	if time.Since(s.lastPurge) < purgeInterval {
+		s.mu.Unlock()
+		return
+	}
+	s.lastPurge = time.Now()
+	s.mu.Unlock()
+
+	qctx, done := traceSQL(ctx, "idempotency.purge")
+	_, err := s.db.ExecContext(qctx, purgeKeysSQL)
+	done(err)
+}
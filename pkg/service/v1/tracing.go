@@ -0,0 +1,40 @@
+package v1
+
+import (
+	"context"
+	"database/sql"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/radean0909/redeam-rest/pkg/service/v1"
+
+// traceSQL starts a client span named after a statement, e.g. "book.read", and returns the func
+// ending it. Neither the SQL text nor its parameters are recorded, they may hold personal data.
+// sql.ErrNoRows is a result rather than a failure and doesn't mark the span as failed.
+func traceSQL(ctx context.Context, statement string) (context.Context, func(error)) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, statement,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "postgresql"),
+			attribute.String("db.statement.name", statement),
+		))
+
+	return ctx, func(err error) {
+		if err != nil && err != sql.ErrNoRows {
+			span.RecordError(err)
+			span.SetStatus(otelcodes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
+// endRows closes rows and then ends the span of the query that returned them, failed when reading
+// the rows did. Spans of queries returning rows cover reading them, not only sending the query.
+func endRows(rows *sql.Rows, done func(error)) {
+	rows.Close()
+	done(rows.Err())
+}
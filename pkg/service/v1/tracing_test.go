@@ -0,0 +1,140 @@
+package v1
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func Test_traceSQL(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus codes.Code
+	}{
+		{"OK", nil, codes.Unset},
+		{"No rows", sql.ErrNoRows, codes.Unset},
+		{"Failure", errors.New("connection reset"), codes.Error},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, done := traceSQL(context.Background(), "book.read")
+			done(tt.err)
+
+			spans := rec.Ended()
+			span := spans[len(spans)-1]
+			if span.Name() != "book.read" || span.Status().Code != tt.wantStatus {
+				t.Errorf("traceSQL() span = %s %v, want book.read %v", span.Name(), span.Status().Code, tt.wantStatus)
+			}
+			for _, a := range span.Attributes() {
+				if a.Key == "db.statement" || a.Key == "db.query.text" {
+					t.Errorf("traceSQL() recorded the statement text")
+				}
+			}
+		})
+	}
+}
+
+// rowsDriver answers every query with n rows of one column, then err
+type rowsDriver struct {
+	n   int
+	err error
+}
+
+func (d rowsDriver) Open(string) (driver.Conn, error) { return d, nil }
+
+func (d rowsDriver) Prepare(string) (driver.Stmt, error) { return d, nil }
+
+func (d rowsDriver) Close() error { return nil }
+
+func (d rowsDriver) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+
+func (d rowsDriver) NumInput() int { return -1 }
+
+func (d rowsDriver) Exec([]driver.Value) (driver.Result, error) {
+	return nil, errors.New("not supported")
+}
+
+func (d rowsDriver) Query([]driver.Value) (driver.Rows, error) { return &driverRows{d: d}, nil }
+
+type driverRows struct {
+	d    rowsDriver
+	read int
+}
+
+func (r *driverRows) Columns() []string { return []string{"id"} }
+
+func (r *driverRows) Close() error { return nil }
+
+func (r *driverRows) Next(dest []driver.Value) error {
+	if r.read == r.d.n {
+		if r.d.err != nil {
+			return r.d.err
+		}
+		return io.EOF
+	}
+	r.read++
+	dest[0] = int64(r.read)
+	return nil
+}
+
+func Test_endRows(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus codes.Code
+	}{
+		{"OK", nil, codes.Unset},
+		{"Failure while reading", errors.New("connection reset"), codes.Error},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := sql.OpenDB(connector{rowsDriver{n: 2, err: tt.err}})
+			defer db.Close()
+
+			ctx, done := traceSQL(context.Background(), "book.list")
+			rows, err := db.QueryContext(ctx, "SELECT id FROM Book")
+			if err != nil {
+				t.Fatalf("QueryContext() error = %v", err)
+			}
+			ended := len(rec.Ended())
+			for rows.Next() {
+			}
+			if len(rec.Ended()) != ended {
+				t.Fatalf("span ended before its rows were read")
+			}
+
+			endRows(rows, done)
+			spans := rec.Ended()
+			if len(spans) != ended+1 {
+				t.Fatalf("endRows() ended %d spans, want 1", len(spans)-ended)
+			}
+			if span := spans[len(spans)-1]; span.Name() != "book.list" || span.Status().Code != tt.wantStatus {
+				t.Errorf("endRows() span = %s %v, want book.list %v", span.Name(), span.Status().Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+// connector opens connections of a driver value without registering it
+type connector struct {
+	d rowsDriver
+}
+
+func (c connector) Connect(context.Context) (driver.Conn, error) { return c.d, nil }
+
+func (c connector) Driver() driver.Driver { return c.d }
@@ -0,0 +1,76 @@
+// Package tracing sets up OpenTelemetry tracing with W3C trace-context propagation.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Exporters accepted by Init
+const (
+	ExporterNone   = "none"
+	ExporterOTLP   = "otlp"   // OTLP over gRPC, configured by the OTEL_EXPORTER_OTLP_* environment variables
+	ExporterStdout = "stdout" // pretty printed JSON on stdout
+	ExporterFile   = "file"   // one JSON span per line appended to a file
+)
+
+// Init installs the W3C trace-context and baggage propagators and, unless exporter is ExporterNone,
+// a global tracer provider sending the spans of serviceName to it. file is only used by ExporterFile.
+// The returned func flushes pending spans and must be called before exiting.
+func Init(ctx context.Context, serviceName, exporter, file string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var (
+		exp     sdktrace.SpanExporter
+		err     error
+		cleanup = func() error { return nil }
+	)
+	switch exporter {
+	case ExporterNone, "":
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		exp, err = otlptracegrpc.New(ctx)
+	case ExporterStdout:
+		exp, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case ExporterFile:
+		if file == "" {
+			return nil, fmt.Errorf("tracing: the %s exporter needs a file", ExporterFile)
+		}
+		f, ferr := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if ferr != nil {
+			return nil, fmt.Errorf("tracing: %v", ferr)
+		}
+		cleanup = f.Close
+		exp, err = stdouttrace.New(stdouttrace.WithWriter(f))
+	default:
+		return nil, fmt.Errorf("tracing: unknown exporter %q", exporter)
+	}
+	if err != nil {
+		cleanup()
+		return nil, fmt.Errorf("tracing: creating %s exporter: %v", exporter, err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(attribute.String("service.name", serviceName)))
+	if err != nil {
+		return nil, fmt.Errorf("tracing: %v", err)
+	}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exp), sdktrace.WithResource(res))
+	otel.SetTracerProvider(tp)
+
+	return func(ctx context.Context) error {
+		err := tp.Shutdown(ctx)
+		if cerr := cleanup(); err == nil {
+			err = cerr
+		}
+		return err
+	}, nil
+}
@@ -0,0 +1,55 @@
+package tracing
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+func TestInit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tracing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "traces.json")
+
+	shutdown, err := Init(context.Background(), "test", ExporterFile, file)
+	if err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+
+	// a W3C traceparent from the caller becomes the parent of local spans
+	carrier := propagation.MapCarrier{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), carrier)
+	_, span := otel.Tracer("test").Start(ctx, "book.read")
+	span.End()
+
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown() error = %v", err)
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"Name":"book.read"`, `"TraceID":"4bf92f3577b34da6a3ce929d0e0e4736"`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("exported spans %s don't contain %s", data, want)
+		}
+	}
+}
+
+func TestInit_Invalid(t *testing.T) {
+	for _, exporter := range []string{"jaeger", ExporterFile} {
+		if _, err := Init(context.Background(), "test", exporter, ""); err == nil {
+			t.Errorf("Init(%q) with no file succeeded", exporter)
+		}
+	}
+}
@@ -1,3 +1,19 @@
-protoc --proto_path=api/proto/v1 --proto_path=third_party --go_out=plugins=grpc:pkg/api/v1 api/proto/v1/redeam-rest.proto
-protoc --proto_path=api/proto/v1 --proto_path=third_party --plugin=protoc-gen-grpc-gateway=$GOPATH/bin/protoc-gen-grpc-gateway --grpc-gateway_out=logtostderr=true:pkg/api/v1 api/proto/v1/redeam-rest.proto
-protoc --proto_path=api/proto/v1 --proto_path=third_party --plugin=protoc-gen-swagger=$GOPATH/bin/protoc-gen-swagger --swagger_out=logtostderr=true:api/swagger/v1 api/proto/v1/redeam-rest.proto
\ No newline at end of file
+#!/bin/sh
+# Regenerates pkg/api/v1 and api/swagger/v1 from api/proto/v1, run from the repository root. The
+# plugins are pinned in third_party/protocgen/go.mod: protoc-gen-go of github.com/golang/protobuf
+# v1.5.4, which still generates the gRPC services with plugins=grpc and stamps its files with the
+# google.golang.org/protobuf version it is built on, v1.33.0, and protoc-gen-grpc-gateway and
+# protoc-gen-swagger of grpc-ecosystem/grpc-gateway v1.16.0. protocgen parses the protos in place
+# of protoc, only Go is needed.
+set -e
+BIN=$(mktemp -d)
+trap 'rm -rf "$BIN"' EXIT
+(cd third_party/protocgen && go build -o "$BIN/" . \
+	github.com/golang/protobuf/protoc-gen-go \
+	github.com/grpc-ecosystem/grpc-gateway/protoc-gen-grpc-gateway \
+	github.com/grpc-ecosystem/grpc-gateway/protoc-gen-swagger)
+
+GEN="$BIN/protocgen -I api/proto/v1:third_party"
+$GEN -plugin "$BIN/protoc-gen-go" -param plugins=grpc,paths=source_relative -out pkg/api/v1 redeam-rest.proto
+$GEN -plugin "$BIN/protoc-gen-grpc-gateway" -param logtostderr=true,paths=source_relative -out pkg/api/v1 redeam-rest.proto
+$GEN -plugin "$BIN/protoc-gen-swagger" -param logtostderr=true -out api/swagger/v1 redeam-rest.proto
@@ -0,0 +1,20 @@
+module github.com/radean0909/redeam-rest/third_party/protocgen
+
+go 1.22
+
+require (
+	github.com/golang/protobuf v1.5.4
+	github.com/grpc-ecosystem/grpc-gateway v1.16.0
+	github.com/jhump/protoreflect v1.15.3
+	google.golang.org/protobuf v1.33.0
+)
+
+require (
+	github.com/bufbuild/protocompile v0.6.0 // indirect
+	github.com/ghodss/yaml v1.0.1-0.20190212211648-25d852aebe32 // indirect
+	github.com/golang/glog v1.0.0 // indirect
+	github.com/google/go-cmp v0.5.9 // indirect
+	golang.org/x/sync v0.3.0 // indirect
+	google.golang.org/genproto v0.0.0-20230410155749-daa745c078e1 // indirect
+	gopkg.in/yaml.v2 v2.4.0 // indirect
+)
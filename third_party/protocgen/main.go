@@ -0,0 +1,86 @@
+// Command protocgen stands in for protoc: it parses .proto files, runs a protoc plugin on them and
+// writes the files the plugin generates. It keeps the generated code reproducible with nothing but
+// Go, see third_party/protoc-gen.sh.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/protoparse"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+func main() {
+	var paths, plugin, param, out string
+	flag.StringVar(&paths, "I", ".", "colon separated import paths")
+	flag.StringVar(&plugin, "plugin", "", "protoc plugin binary")
+	flag.StringVar(&param, "param", "", "parameter passed to the plugin")
+	flag.StringVar(&out, "out", ".", "directory the generated files are written to")
+	flag.Parse()
+
+	p := protoparse.Parser{ImportPaths: strings.Split(paths, ":"), IncludeSourceCodeInfo: true}
+	fds, err := p.ParseFiles(flag.Args()...)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// plugins expect every file after the files it imports
+	var files []*descriptorpb.FileDescriptorProto
+	seen := map[string]bool{}
+	var visit func(fd *desc.FileDescriptor)
+	visit = func(fd *desc.FileDescriptor) {
+		if seen[fd.GetName()] {
+			return
+		}
+		seen[fd.GetName()] = true
+		for _, d := range fd.GetDependencies() {
+			visit(d)
+		}
+		files = append(files, fd.AsFileDescriptorProto())
+	}
+	for _, fd := range fds {
+		visit(fd)
+	}
+
+	req := &pluginpb.CodeGeneratorRequest{FileToGenerate: flag.Args(), ProtoFile: files}
+	if param != "" {
+		req.Parameter = proto.String(param)
+	}
+	b, err := proto.Marshal(req)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cmd := exec.Command(plugin)
+	cmd.Stdin = bytes.NewReader(b)
+	cmd.Stderr = os.Stderr
+	o, err := cmd.Output()
+	if err != nil {
+		log.Fatalf("%s failed: %v", plugin, err)
+	}
+
+	var res pluginpb.CodeGeneratorResponse
+	if err := proto.Unmarshal(o, &res); err != nil {
+		log.Fatal(err)
+	}
+	if res.Error != nil {
+		log.Fatalf("%s failed: %s", plugin, res.GetError())
+	}
+	for _, f := range res.File {
+		name := filepath.Join(out, f.GetName())
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			log.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(f.GetContent()), 0644); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
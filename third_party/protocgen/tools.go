@@ -0,0 +1,10 @@
+//go:build tools
+
+// The protoc plugins, their versions are pinned by go.mod
+package main
+
+import (
+	_ "github.com/golang/protobuf/protoc-gen-go"
+	_ "github.com/grpc-ecosystem/grpc-gateway/protoc-gen-grpc-gateway"
+	_ "github.com/grpc-ecosystem/grpc-gateway/protoc-gen-swagger"
+)